@@ -0,0 +1,230 @@
+package miniredis
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// ClientInfo describes a single connection, the same as a CLIENT LIST line.
+type ClientInfo struct {
+	ID        int
+	Addr      string // "ip:port" of the client
+	LocalAddr string // "ip:port" of the server side of the connection
+	Name      string // set with CLIENT SETNAME
+	Age       time.Duration
+	Idle      time.Duration
+	Flags     string // "N", or a combination of "P" (pubsub), "x" (MULTI), "t" (TRACKING), "R" (broken redirect), "B" (BCAST), "e" (NO-EVICT), and "T" (NO-TOUCH)
+	DB        int
+	Sub       int    // number of channel subscriptions
+	Psub      int    // number of pattern subscriptions
+	Multi     int    // number of queued commands, -1 when not in MULTI
+	Watch     int    // number of WATCHed keys
+	Cmd       string // last command, lowercase
+	User      string
+	Redir     int // CLIENT TRACKING REDIRECT client. -1 if tracking is off
+	Resp      int
+	LibName   string // set with CLIENT SETINFO
+	LibVer    string // set with CLIENT SETINFO
+}
+
+// String formats the info the way CLIENT LIST does, without the newline.
+func (ci ClientInfo) String() string {
+	cmd := ci.Cmd
+	if cmd == "" {
+		cmd = "NULL"
+	}
+	return fmt.Sprintf(
+		"id=%d addr=%s laddr=%s name=%s age=%d idle=%d flags=%s db=%d sub=%d psub=%d multi=%d watch=%d cmd=%s user=%s redir=%d resp=%d lib-name=%s lib-ver=%s",
+		ci.ID,
+		ci.Addr,
+		ci.LocalAddr,
+		ci.Name,
+		int(ci.Age.Seconds()),
+		int(ci.Idle.Seconds()),
+		ci.Flags,
+		ci.DB,
+		ci.Sub,
+		ci.Psub,
+		ci.Multi,
+		ci.Watch,
+		cmd,
+		ci.User,
+		ci.Redir,
+		ci.Resp,
+		ci.LibName,
+		ci.LibVer,
+	)
+}
+
+// Clients returns all connected clients, ordered by ID. This is the same
+// info as CLIENT LIST.
+func (m *Miniredis) Clients() []ClientInfo {
+	m.Lock()
+	defer m.Unlock()
+	return m.clients()
+}
+
+// all clients. No locks!
+func (m *Miniredis) clients() []ClientInfo {
+	if m.srv == nil {
+		return nil
+	}
+	var res []ClientInfo
+	for _, p := range m.srv.Peers() {
+		res = append(res, clientInfo(p))
+	}
+	return res
+}
+
+// peer finds a connection by client ID. No locks!
+func (m *Miniredis) peer(id int) *server.Peer {
+	if m.srv == nil {
+		return nil
+	}
+	for _, p := range m.srv.Peers() {
+		if p.ID() == id {
+			return p
+		}
+	}
+	return nil
+}
+
+// clientInfo reads the state of a peer, which can be another connection.
+func clientInfo(p *server.Peer) ClientInfo {
+	now := time.Now()
+	ci := ClientInfo{
+		ID:        p.ID(),
+		Addr:      p.Addr(),
+		LocalAddr: p.LocalAddr(),
+		Age:       now.Sub(p.Created()),
+		Idle:      now.Sub(p.LastActive()),
+		Cmd:       p.LastCmd(),
+		User:      "default",
+		Redir:     -1,
+		Resp:      2,
+		Multi:     -1,
+	}
+	var (
+		sub              *Subscriber
+		noEvict, noTouch bool
+		track            tracking
+	)
+	p.Inspect(func() {
+		ci.Name = p.ClientName
+		ci.LibName = p.LibName
+		ci.LibVer = p.LibVer
+		if p.Resp3 {
+			ci.Resp = 3
+		}
+		ctx, ok := p.Ctx.(*connCtx)
+		if !ok {
+			return
+		}
+		ci.DB = ctx.selectedDB
+		if ctx.user != "" {
+			ci.User = ctx.user
+		}
+		if inTx(ctx) {
+			ci.Multi = len(ctx.transaction)
+		}
+		ci.Watch = len(ctx.watch)
+		sub = ctx.subscriber
+		noEvict = ctx.noEvict
+		noTouch = ctx.noTouch
+		ci.Redir = trackingRedirect(ctx.tracking)
+		if ctx.tracking != nil {
+			track = *ctx.tracking
+		}
+	})
+	// Subscriber has its own lock
+	if sub != nil {
+		ci.Sub = len(sub.Channels())
+		ci.Psub = len(sub.Patterns())
+	}
+
+	if sub != nil {
+		ci.Flags += "P"
+	}
+	if ci.Multi != -1 {
+		ci.Flags += "x"
+	}
+	if ci.Redir != -1 {
+		ci.Flags += "t"
+		if track.brokenRedir {
+			ci.Flags += "R"
+		}
+		if track.bcast {
+			ci.Flags += "B"
+		}
+	}
+	if noEvict {
+		ci.Flags += "e"
+	}
+	if noTouch {
+		ci.Flags += "T"
+	}
+	if ci.Flags == "" {
+		ci.Flags = "N"
+	}
+	return ci
+}
+
+// clientFilter has the options for CLIENT KILL
+type clientFilter struct {
+	id     int
+	typ    string
+	user   string
+	addr   string
+	laddr  string
+	skipMe bool
+	maxAge time.Duration
+}
+
+func (f clientFilter) match(self *server.Peer, ci ClientInfo) bool {
+	if f.skipMe && ci.ID == self.ID() {
+		return false
+	}
+	if f.id != 0 && ci.ID != f.id {
+		return false
+	}
+	if f.typ != "" && clientType(ci) != f.typ {
+		return false
+	}
+	if f.user != "" && ci.User != f.user {
+		return false
+	}
+	if f.addr != "" && ci.Addr != f.addr {
+		return false
+	}
+	if f.laddr != "" && ci.LocalAddr != f.laddr {
+		return false
+	}
+	if f.maxAge != 0 && ci.Age < f.maxAge {
+		return false
+	}
+	return true
+}
+
+// clientType is the TYPE as used in CLIENT LIST and CLIENT KILL. We don't
+// have masters or replicas.
+func clientType(ci ClientInfo) string {
+	if strings.Contains(ci.Flags, "P") {
+		return "pubsub"
+	}
+	return "normal"
+}
+
+// parseClientType returns the canonical type, or "" if the type is invalid.
+func parseClientType(t string) string {
+	switch t := strings.ToLower(t); t {
+	case "normal", "master", "replica", "pubsub":
+		return t
+	case "slave":
+		return "replica"
+	default:
+		return ""
+	}
+}
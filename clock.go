@@ -0,0 +1,114 @@
+package miniredis
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a source of time. See m.SetClock(). FakeClock is an
+// implementation for tests.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After works like time.After().
+	After(d time.Duration) <-chan time.Time
+}
+
+// SetClock makes miniredis use c for TTLs, which count down when the clock
+// moves, and for TIME, stream IDs, OBJECT IDLETIME, the idle times of stream
+// consumers and pending entries, the timeouts of blocking commands, and the
+// CLIENT PAUSE timeout. Use nil to go back to the real time, with TTLs which
+// only change with FastForward().
+//
+// The ages and idle times in CLIENT LIST and CLIENT INFO, MONITOR timestamps,
+// and SetBusyScriptTime() always use the real time.
+//
+// SetTime() takes precedence over the clock for TIME, stream IDs, and idle
+// times, and FastForward() still works as usual.
+func (m *Miniredis) SetClock(c Clock) {
+	m.Lock()
+	defer m.Unlock()
+	m.passTime()
+	m.clock = c
+	m.expireTick = m.clockNow()
+}
+
+// clockNow is the time of the SetClock() clock, or the real time. No locks!
+func (m *Miniredis) clockNow() time.Time {
+	if m.clock == nil {
+		return time.Now()
+	}
+	return m.clock.Now()
+}
+
+// clockAfter is time.After() on the SetClock() clock. No locks!
+func (m *Miniredis) clockAfter(d time.Duration) <-chan time.Time {
+	if m.clock == nil {
+		return time.After(d)
+	}
+	return m.clock.After(d)
+}
+
+// FakeClock is a Clock which only moves with Advance(). Use it with
+// m.SetClock(), and in your own code, to control time in a test:
+//
+//	clock := miniredis.NewFakeClock(time.Now())
+//	m.SetClock(clock)
+//	m.Set("foo", "bar")
+//	m.SetTTL("foo", time.Minute)
+//	clock.Advance(time.Minute) // "foo" is gone
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// NewFakeClock makes a FakeClock which starts at t.
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{
+		now: t,
+	}
+}
+
+// Now returns the current time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns a channel which gets the time once the clock has advanced by
+// d.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.timers = append(c.timers, fakeTimer{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock forward by d, and fires all After() channels which
+// are due.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	var left []fakeTimer
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			left = append(left, t)
+			continue
+		}
+		t.ch <- c.now
+	}
+	c.timers = left
+}
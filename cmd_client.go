@@ -2,7 +2,9 @@ package miniredis
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/alicebob/miniredis/v2/server"
 )
@@ -26,6 +28,34 @@ func (m *Miniredis) cmdClient(c *server.Peer, cmd string, args []string) {
 			m.cmdClientSetName(c, args[1:])
 		case "GETNAME":
 			m.cmdClientGetName(c, args[1:])
+		case "LIST":
+			m.cmdClientList(c, args[1:])
+		case "INFO":
+			m.cmdClientInfo(c, args[1:])
+		case "ID":
+			m.cmdClientID(c, args[1:])
+		case "KILL":
+			m.cmdClientKill(c, args[1:])
+		case "SETINFO":
+			m.cmdClientSetInfo(c, args[1:])
+		case "NO-EVICT":
+			m.cmdClientNoEvict(c, args[1:])
+		case "NO-TOUCH":
+			m.cmdClientNoTouch(c, args[1:])
+		case "REPLY":
+			m.cmdClientReply(c, args[1:])
+		case "PAUSE":
+			m.cmdClientPause(c, args[1:])
+		case "UNPAUSE":
+			m.cmdClientUnpause(c, args[1:])
+		case "TRACKING":
+			m.cmdClientTracking(c, ctx, args[1:])
+		case "CACHING":
+			m.cmdClientCaching(c, ctx, args[1:])
+		case "GETREDIR":
+			m.cmdClientGetRedir(c, ctx, args[1:])
+		case "TRACKINGINFO":
+			m.cmdClientTrackingInfo(c, ctx, args[1:])
 		default:
 			setDirty(c)
 			c.WriteError(fmt.Sprintf("ERR unknown subcommand '%s'. Try CLIENT HELP.", cmd))
@@ -48,7 +78,9 @@ func (m *Miniredis) cmdClientSetName(c *server.Peer, args []string) {
 		return
 
 	}
-	c.ClientName = name
+	c.Inspect(func() {
+		c.ClientName = name
+	})
 	c.WriteOK()
 }
 
@@ -60,9 +92,587 @@ func (m *Miniredis) cmdClientGetName(c *server.Peer, args []string) {
 		return
 	}
 
-	if c.ClientName == "" {
+	var name string
+	c.Inspect(func() {
+		name = c.ClientName
+	})
+	if name == "" {
 		c.WriteNull()
 	} else {
-		c.WriteBulk(c.ClientName)
+		c.WriteBulk(name)
+	}
+}
+
+// CLIENT SETINFO
+func (m *Miniredis) cmdClientSetInfo(c *server.Peer, args []string) {
+	if len(args) != 2 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|setinfo"))
+		return
+	}
+
+	attr, value := args[0], args[1]
+	var dest *string
+	switch strings.ToLower(attr) {
+	case "lib-name":
+		dest = &c.LibName
+	case "lib-ver":
+		dest = &c.LibVer
+	default:
+		setDirty(c)
+		c.WriteError(fmt.Sprintf("ERR Unrecognized option '%s'", attr))
+		return
+	}
+	for _, r := range value {
+		if r < '!' || r > '~' {
+			setDirty(c)
+			c.WriteError(fmt.Sprintf("ERR %s cannot contain spaces, newlines or special characters.", attr))
+			return
+		}
+	}
+	c.Inspect(func() {
+		*dest = value
+	})
+	c.WriteOK()
+}
+
+// CLIENT NO-EVICT
+func (m *Miniredis) cmdClientNoEvict(c *server.Peer, args []string) {
+	if len(args) != 1 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|no-evict"))
+		return
+	}
+
+	on, ok := parseOnOff(args[0])
+	if !ok {
+		setDirty(c)
+		c.WriteError(msgSyntaxError)
+		return
+	}
+	// we never evict anything, so it's only shown in CLIENT LIST.
+	getCtx(c).noEvict = on
+	c.WriteOK()
+}
+
+// CLIENT NO-TOUCH
+func (m *Miniredis) cmdClientNoTouch(c *server.Peer, args []string) {
+	if len(args) != 1 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|no-touch"))
+		return
+	}
+
+	on, ok := parseOnOff(args[0])
+	if !ok {
+		setDirty(c)
+		c.WriteError(msgSyntaxError)
+		return
+	}
+	getCtx(c).noTouch = on
+	c.WriteOK()
+}
+
+// CLIENT REPLY
+func (m *Miniredis) cmdClientReply(c *server.Peer, args []string) {
+	if len(args) != 1 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|reply"))
+		return
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "ON":
+		c.SetReplyMode(server.ReplyOn)
+		c.WriteOK()
+	case "OFF":
+		c.SetReplyMode(server.ReplyOff)
+	case "SKIP":
+		c.SetReplyMode(server.ReplySkip)
+	default:
+		setDirty(c)
+		c.WriteError(msgSyntaxError)
+	}
+}
+
+// CLIENT PAUSE
+func (m *Miniredis) cmdClientPause(c *server.Peer, args []string) {
+	if len(args) < 1 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|pause"))
+		return
+	}
+
+	ms, err := strconv.Atoi(args[0])
+	if err != nil {
+		setDirty(c)
+		c.WriteError(msgTimeoutNotInt)
+		return
+	}
+	if ms < 0 {
+		setDirty(c)
+		c.WriteError(msgTimeoutNegative)
+		return
+	}
+	mode := server.PauseAll
+	if len(args) > 1 {
+		switch strings.ToUpper(args[1]) {
+		case "WRITE":
+			mode = server.PauseWrite
+		case "ALL":
+		default:
+			setDirty(c)
+			c.WriteError("ERR CLIENT PAUSE mode must be WRITE or ALL")
+			return
+		}
+	}
+
+	// a new pause replaces the mode, but never shortens the timeout
+	if d := time.Duration(ms) * time.Millisecond; d > m.pauseLeft {
+		m.pauseLeft = d
+	}
+	if m.pauseLeft > 0 {
+		m.srv.Pause(mode)
+		m.pauseClock(m.pauseLeft)
+	}
+	c.WriteOK()
+}
+
+// CLIENT UNPAUSE
+func (m *Miniredis) cmdClientUnpause(c *server.Peer, args []string) {
+	if len(args) != 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|unpause"))
+		return
+	}
+
+	m.unpause()
+	c.WriteOK()
+}
+
+// unpause ends a CLIENT PAUSE. No locks!
+func (m *Miniredis) unpause() {
+	m.pauseLeft = 0
+	if m.pauseStop != nil {
+		close(m.pauseStop)
+		m.pauseStop = nil
+	}
+	if m.srv != nil {
+		m.srv.Unpause()
+	}
+}
+
+// passPause decreases the CLIENT PAUSE timeout, and ends the pause when it's
+// done. No locks!
+func (m *Miniredis) passPause(d time.Duration) {
+	if m.pauseLeft <= 0 {
+		return
+	}
+	m.pauseLeft -= d
+	if m.pauseLeft <= 0 {
+		m.unpause()
+	}
+}
+
+// pauseClock ends the pause once the SetClock() clock passes d. Nothing
+// happens without a clock. No locks!
+func (m *Miniredis) pauseClock(d time.Duration) {
+	if m.clock == nil {
+		return
+	}
+	if m.pauseStop != nil {
+		close(m.pauseStop)
+	}
+	stop := make(chan struct{})
+	m.pauseStop = stop
+	after := m.clockAfter(d)
+	go func() {
+		select {
+		case <-stop:
+		case <-after:
+			m.Lock()
+			defer m.Unlock()
+			m.passTime()
+		}
+	}()
+}
+
+// CLIENT TRACKING
+func (m *Miniredis) cmdClientTracking(c *server.Peer, ctx *connCtx, args []string) {
+	if len(args) < 1 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|tracking"))
+		return
+	}
+
+	onoff, args := args[0], args[1:]
+	var (
+		t        tracking
+		prefixes []string
+	)
+	for len(args) > 0 {
+		switch opt := strings.ToUpper(args[0]); {
+		case opt == "REDIRECT" && len(args) > 1:
+			if t.redirect != 0 {
+				setDirty(c)
+				c.WriteError("ERR A client can only redirect to a single other client")
+				return
+			}
+			id, err := strconv.Atoi(args[1])
+			if err != nil {
+				setDirty(c)
+				c.WriteError(msgInvalidInt)
+				return
+			}
+			if m.peer(id) == nil {
+				setDirty(c)
+				c.WriteError("ERR The client ID you want redirect to does not exist")
+				return
+			}
+			t.redirect = id
+			args = args[2:]
+		case opt == "PREFIX" && len(args) > 1:
+			prefixes = append(prefixes, args[1])
+			args = args[2:]
+		case opt == "BCAST":
+			t.bcast = true
+			args = args[1:]
+		case opt == "OPTIN":
+			t.optin = true
+			args = args[1:]
+		case opt == "OPTOUT":
+			t.optout = true
+			args = args[1:]
+		case opt == "NOLOOP":
+			t.noloop = true
+			args = args[1:]
+		default:
+			setDirty(c)
+			c.WriteError(msgSyntaxError)
+			return
+		}
+	}
+
+	switch strings.ToUpper(onoff) {
+	case "ON":
+		old := ctx.tracking
+		if !t.bcast && len(prefixes) > 0 {
+			setDirty(c)
+			c.WriteError("ERR PREFIX option requires BCAST mode to be enabled")
+			return
+		}
+		if old != nil && old.bcast != t.bcast {
+			setDirty(c)
+			c.WriteError("ERR You can't switch BCAST mode on/off before disabling tracking for this client, and then re-enabling it with a different mode.")
+			return
+		}
+		if t.bcast && (t.optin || t.optout) {
+			setDirty(c)
+			c.WriteError("ERR OPTIN and OPTOUT are not compatible with BCAST")
+			return
+		}
+		if t.optin && t.optout {
+			setDirty(c)
+			c.WriteError("ERR You can't use both OPTIN and OPTOUT")
+			return
+		}
+		if old != nil && ((t.optin && old.optout) || (t.optout && old.optin)) {
+			setDirty(c)
+			c.WriteError("ERR You can't switch OPTIN/OPTOUT mode before disabling tracking for this client, and then re-enabling it with a different mode.")
+			return
+		}
+		if t.bcast {
+			var oldPrefixes []string
+			if old != nil {
+				oldPrefixes = old.prefixes
+			}
+			if err := checkPrefixes(oldPrefixes, prefixes); err != nil {
+				setDirty(c)
+				c.WriteError(err.Error())
+				return
+			}
+		}
+		t.prefixes = prefixes
+		m.enableTracking(c, ctx, t)
+	case "OFF":
+		m.disableTracking(c, ctx)
+	default:
+		setDirty(c)
+		c.WriteError(msgSyntaxError)
+		return
+	}
+	c.WriteOK()
+}
+
+// CLIENT CACHING
+func (m *Miniredis) cmdClientCaching(c *server.Peer, ctx *connCtx, args []string) {
+	if len(args) != 1 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|caching"))
+		return
+	}
+
+	t := ctx.tracking
+	if t == nil {
+		setDirty(c)
+		c.WriteError("ERR CLIENT CACHING can be called only when the client is in tracking mode with OPTIN or OPTOUT mode enabled")
+		return
+	}
+	switch strings.ToUpper(args[0]) {
+	case "YES":
+		if !t.optin {
+			setDirty(c)
+			c.WriteError("ERR CLIENT CACHING YES is only valid when tracking is enabled in OPTIN mode.")
+			return
+		}
+	case "NO":
+		if !t.optout {
+			setDirty(c)
+			c.WriteError("ERR CLIENT CACHING NO is only valid when tracking is enabled in OPTOUT mode.")
+			return
+		}
+	default:
+		setDirty(c)
+		c.WriteError(msgSyntaxError)
+		return
+	}
+	t.caching = true
+	c.WriteOK()
+}
+
+// CLIENT GETREDIR
+func (m *Miniredis) cmdClientGetRedir(c *server.Peer, ctx *connCtx, args []string) {
+	if len(args) != 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|getredir"))
+		return
+	}
+
+	c.WriteInt(trackingRedirect(ctx.tracking))
+}
+
+// CLIENT TRACKINGINFO
+func (m *Miniredis) cmdClientTrackingInfo(c *server.Peer, ctx *connCtx, args []string) {
+	if len(args) != 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|trackinginfo"))
+		return
+	}
+
+	t := ctx.tracking
+	c.WriteMapLen(3)
+	c.WriteBulk("flags")
+	flags := t.flags()
+	c.WriteSetLen(len(flags))
+	for _, f := range flags {
+		c.WriteBulk(f)
+	}
+	c.WriteBulk("redirect")
+	c.WriteInt(trackingRedirect(t))
+	c.WriteBulk("prefixes")
+	var prefixes []string
+	if t != nil {
+		prefixes = t.prefixes
+	}
+	c.WriteStrings(prefixes)
+}
+
+// trackingRedirect is the REDIRECT client ID, as used by CLIENT GETREDIR.
+func trackingRedirect(t *tracking) int {
+	if t == nil {
+		return -1
+	}
+	return t.redirect
+}
+
+func parseOnOff(s string) (bool, bool) {
+	switch strings.ToLower(s) {
+	case "on":
+		return true, true
+	case "off":
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+// CLIENT LIST
+func (m *Miniredis) cmdClientList(c *server.Peer, args []string) {
+	clients := m.clients()
+
+	switch {
+	case len(args) == 0:
+	case len(args) == 2 && strings.ToUpper(args[0]) == "TYPE":
+		typ := parseClientType(args[1])
+		if typ == "" {
+			setDirty(c)
+			c.WriteError(fmt.Sprintf("ERR Unknown client type '%s'", args[1]))
+			return
+		}
+		var res []ClientInfo
+		for _, ci := range clients {
+			if clientType(ci) == typ {
+				res = append(res, ci)
+			}
+		}
+		clients = res
+	case len(args) > 1 && strings.ToUpper(args[0]) == "ID":
+		var res []ClientInfo
+		for _, a := range args[1:] {
+			id, err := strconv.Atoi(a)
+			if err != nil || id < 1 {
+				setDirty(c)
+				c.WriteError("ERR Invalid client ID")
+				return
+			}
+			for _, ci := range clients {
+				if ci.ID == id {
+					res = append(res, ci)
+				}
+			}
+		}
+		clients = res
+	default:
+		setDirty(c)
+		c.WriteError(msgSyntaxError)
+		return
+	}
+
+	var res strings.Builder
+	for _, ci := range clients {
+		res.WriteString(ci.String())
+		res.WriteString("\n")
+	}
+	c.WriteVerbatim("txt", res.String())
+}
+
+// CLIENT INFO
+func (m *Miniredis) cmdClientInfo(c *server.Peer, args []string) {
+	if len(args) != 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|info"))
+		return
+	}
+
+	c.WriteVerbatim("txt", clientInfo(c).String()+"\n")
+}
+
+// CLIENT ID
+func (m *Miniredis) cmdClientID(c *server.Peer, args []string) {
+	if len(args) != 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|id"))
+		return
+	}
+
+	c.WriteInt(c.ID())
+}
+
+// CLIENT KILL
+func (m *Miniredis) cmdClientKill(c *server.Peer, args []string) {
+	if len(args) == 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|kill"))
+		return
+	}
+
+	if len(args) == 1 {
+		// old style: CLIENT KILL addr:port. You can kill yourself this way.
+		for _, ci := range m.clients() {
+			if ci.Addr == args[0] {
+				c.WriteOK()
+				m.killClient(c, ci.ID)
+				return
+			}
+		}
+		c.WriteError("ERR No such client")
+		return
+	}
+
+	if len(args)%2 != 0 {
+		setDirty(c)
+		c.WriteError(msgSyntaxError)
+		return
+	}
+	filter := clientFilter{
+		skipMe: true,
+	}
+	for ; len(args) > 0; args = args[2:] {
+		switch opt, v := strings.ToUpper(args[0]), args[1]; opt {
+		case "ID":
+			id, err := strconv.Atoi(v)
+			if err != nil || id < 1 {
+				setDirty(c)
+				c.WriteError("ERR client-id should be greater than 0")
+				return
+			}
+			filter.id = id
+		case "TYPE":
+			filter.typ = parseClientType(v)
+			if filter.typ == "" {
+				setDirty(c)
+				c.WriteError(fmt.Sprintf("ERR Unknown client type '%s'", v))
+				return
+			}
+		case "USER":
+			if _, ok := m.passwords[v]; !ok && v != "default" {
+				setDirty(c)
+				c.WriteError(fmt.Sprintf("ERR No such user '%s'", v))
+				return
+			}
+			filter.user = v
+		case "ADDR":
+			filter.addr = v
+		case "LADDR":
+			filter.laddr = v
+		case "SKIPME":
+			switch strings.ToLower(v) {
+			case "yes":
+				filter.skipMe = true
+			case "no":
+				filter.skipMe = false
+			default:
+				setDirty(c)
+				c.WriteError(msgSyntaxError)
+				return
+			}
+		case "MAXAGE":
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				setDirty(c)
+				c.WriteError(msgInvalidInt)
+				return
+			}
+			filter.maxAge = time.Duration(n) * time.Second
+		default:
+			setDirty(c)
+			c.WriteError(msgSyntaxError)
+			return
+		}
+	}
+
+	var killed []int
+	for _, ci := range m.clients() {
+		if filter.match(c, ci) {
+			killed = append(killed, ci.ID)
+		}
+	}
+	c.WriteInt(len(killed))
+	for _, id := range killed {
+		m.killClient(c, id)
+	}
+}
+
+// killClient disconnects a client. If that's the current client it's closed
+// after the reply.
+func (m *Miniredis) killClient(c *server.Peer, id int) {
+	if id == c.ID() {
+		c.Close()
+		return
+	}
+	for _, p := range m.srv.Peers() {
+		if p.ID() == id {
+			p.Kill()
+		}
 	}
 }
@@ -1,7 +1,11 @@
 package miniredis
 
 import (
+	"bufio"
+	"net"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/alicebob/miniredis/v2/proto"
 )
@@ -34,3 +38,633 @@ func TestClient(t *testing.T) {
 		)
 	})
 }
+
+func TestClientList(t *testing.T) {
+	s, c := runWithClient(t)
+
+	c2, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c2.Close()
+	mustOK(t, c2, "CLIENT", "SETNAME", "second")
+	mustOK(t, c2, "SELECT", "3")
+
+	t.Run("id", func(t *testing.T) {
+		mustDo(t, c, "CLIENT", "ID", proto.Int(1))
+		mustDo(t, c2, "CLIENT", "ID", proto.Int(2))
+	})
+
+	t.Run("list", func(t *testing.T) {
+		res, err := c.Do("CLIENT", "LIST")
+		ok(t, err)
+		lines, err := proto.ReadString(res)
+		ok(t, err)
+		assert(t, strings.HasPrefix(lines, "id=1 addr="), "have %q", lines)
+		assert(t, strings.Contains(lines, " cmd=client user=default redir=-1 resp=2 lib-name= lib-ver=\n"), "have %q", lines)
+		assert(t, strings.Contains(lines, "\nid=2 addr=127.0.0.1:"), "have %q", lines)
+		assert(t, strings.Contains(lines, " name=second "), "have %q", lines)
+		assert(t, strings.Contains(lines, " flags=N db=3 "), "have %q", lines)
+		equals(t, 2, strings.Count(lines, "\n"))
+
+		mustContain(t, c, "CLIENT", "LIST", "ID", "2", "99", "id=2 ")
+		mustDo(t, c, "CLIENT", "LIST", "ID", "99", proto.String(""))
+		mustDo(t, c, "CLIENT", "LIST", "TYPE", "pubsub", proto.String(""))
+		mustContain(t, c, "CLIENT", "LIST", "TYPE", "normal", "id=2 ")
+
+		mustDo(t, c, "CLIENT", "LIST", "ID", "foo",
+			proto.Error("ERR Invalid client ID"),
+		)
+		mustDo(t, c, "CLIENT", "LIST", "ID", "0",
+			proto.Error("ERR Invalid client ID"),
+		)
+		mustDo(t, c, "CLIENT", "LIST", "ID", "2", "-1",
+			proto.Error("ERR Invalid client ID"),
+		)
+		mustDo(t, c, "CLIENT", "LIST", "TYPE", "foo",
+			proto.Error("ERR Unknown client type 'foo'"),
+		)
+		mustDo(t, c, "CLIENT", "LIST", "foo",
+			proto.Error(msgSyntaxError),
+		)
+	})
+
+	t.Run("info", func(t *testing.T) {
+		mustContain(t, c2, "CLIENT", "INFO", " name=second age=")
+		mustContain(t, c2, "CLIENT", "INFO", " db=3 sub=0 psub=0 multi=-1 watch=0 cmd=client ")
+		mustDo(t, c2, "CLIENT", "INFO", "foo",
+			proto.Error("ERR wrong number of arguments for 'client|info' command"),
+		)
+	})
+
+	t.Run("go", func(t *testing.T) {
+		cs := s.Clients()
+		equals(t, 2, len(cs))
+		equals(t, 1, cs[0].ID)
+		equals(t, "second", cs[1].Name)
+		equals(t, 3, cs[1].DB)
+		assert(t, cs[1].Addr != cs[0].Addr, "addr %q", cs[1].Addr)
+		equals(t, s.Addr(), cs[1].LocalAddr)
+	})
+
+	t.Run("multi and pubsub", func(t *testing.T) {
+		c3, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c3.Close()
+		mustOK(t, c3, "MULTI")
+		mustDo(t, c3, "SET", "foo", "bar", proto.Inline("QUEUED"))
+		mustContain(t, c, "CLIENT", "LIST", "ID", "3", " flags=x db=0 sub=0 psub=0 multi=1 ")
+		mustDo(t, c3, "EXEC", proto.Array(proto.Inline("OK")))
+
+		mustDo(t, c3,
+			"PSUBSCRIBE", "news*",
+			proto.Array(
+				proto.String("psubscribe"),
+				proto.String("news*"),
+				proto.Int(1),
+			),
+		)
+		mustContain(t, c, "CLIENT", "LIST", "TYPE", "pubsub", "id=3 ")
+		mustContain(t, c, "CLIENT", "LIST", "ID", "3", " flags=P db=0 sub=0 psub=1 multi=-1 ")
+	})
+}
+
+func TestClientKill(t *testing.T) {
+	t.Run("old style", func(t *testing.T) {
+		s, c := runWithClient(t)
+		c2, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c2.Close()
+		mustDo(t, c2, "PING", proto.Inline("PONG"))
+
+		addr := s.Clients()[1].Addr
+		mustOK(t, c, "CLIENT", "KILL", addr)
+		_, err = c2.Do("PING")
+		assert(t, err != nil, "c2 should be gone")
+		mustDo(t, c, "CLIENT", "KILL", addr,
+			proto.Error("ERR No such client"),
+		)
+
+		// you can kill yourself
+		addr = s.Clients()[0].Addr
+		mustOK(t, c, "CLIENT", "KILL", addr)
+		_, err = c.Do("PING")
+		assert(t, err != nil, "c should be gone")
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		s, c := runWithClient(t)
+		c2, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c2.Close()
+		mustDo(t, c2, "PING", proto.Inline("PONG"))
+
+		must0(t, c, "CLIENT", "KILL", "ID", "99")
+		must0(t, c, "CLIENT", "KILL", "TYPE", "pubsub")
+		must0(t, c, "CLIENT", "KILL", "ID", "1")
+		must0(t, c, "CLIENT", "KILL", "MAXAGE", "3600")
+		must0(t, c, "CLIENT", "KILL", "ADDR", "1.2.3.4:5", "SKIPME", "no")
+		must1(t, c, "CLIENT", "KILL", "TYPE", "normal", "USER", "default")
+		_, err = c2.Do("PING")
+		assert(t, err != nil, "c2 should be gone")
+		equals(t, 1, len(s.Clients()))
+
+		mustDo(t, c, "CLIENT", "KILL", "ID", "foo",
+			proto.Error("ERR client-id should be greater than 0"),
+		)
+		mustDo(t, c, "CLIENT", "KILL", "TYPE", "foo",
+			proto.Error("ERR Unknown client type 'foo'"),
+		)
+		mustDo(t, c, "CLIENT", "KILL", "USER", "foo",
+			proto.Error("ERR No such user 'foo'"),
+		)
+		mustDo(t, c, "CLIENT", "KILL", "SKIPME", "maybe",
+			proto.Error(msgSyntaxError),
+		)
+		mustDo(t, c, "CLIENT", "KILL", "MAXAGE", "foo",
+			proto.Error(msgInvalidInt),
+		)
+		mustDo(t, c, "CLIENT", "KILL", "ID", "1", "SKIPME",
+			proto.Error(msgSyntaxError),
+		)
+		mustDo(t, c, "CLIENT", "KILL", "FOO", "bar",
+			proto.Error(msgSyntaxError),
+		)
+
+		// kill ourselves, after the reply
+		must1(t, c, "CLIENT", "KILL", "ID", "1", "SKIPME", "no")
+		_, err = c.Do("PING")
+		assert(t, err != nil, "c should be gone")
+	})
+
+	t.Run("blocked client", func(t *testing.T) {
+		s, c := runWithClient(t)
+		c2, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c2.Close()
+
+		done := make(chan error)
+		go func() {
+			_, err := c2.Do("BLPOP", "nosuch", "0")
+			done <- err
+		}()
+		for len(s.Clients()) != 2 || s.Clients()[1].Cmd != "blpop" {
+			time.Sleep(time.Millisecond)
+		}
+		must1(t, c, "CLIENT", "KILL", "ID", "2")
+		assert(t, <-done != nil, "c2 should be gone")
+	})
+}
+
+func TestClientSetInfo(t *testing.T) {
+	s, c := runWithClient(t)
+
+	mustOK(t, c, "CLIENT", "SETINFO", "LIB-NAME", "go-redis(,go1.22)")
+	mustOK(t, c, "CLIENT", "SETINFO", "lib-ver", "9.5.1")
+	mustContain(t, c, "CLIENT", "INFO", " lib-name=go-redis(,go1.22) lib-ver=9.5.1\n")
+	equals(t, "9.5.1", s.Clients()[0].LibVer)
+
+	mustDo(t, c, "CLIENT", "SETINFO", "lib-name", "go redis",
+		proto.Error("ERR lib-name cannot contain spaces, newlines or special characters."),
+	)
+	mustDo(t, c, "CLIENT", "SETINFO", "foo", "bar",
+		proto.Error("ERR Unrecognized option 'foo'"),
+	)
+	mustDo(t, c, "CLIENT", "SETINFO", "lib-name",
+		proto.Error("ERR wrong number of arguments for 'client|setinfo' command"),
+	)
+
+	// clear it again
+	mustOK(t, c, "CLIENT", "SETINFO", "lib-name", "")
+	mustContain(t, c, "CLIENT", "INFO", " lib-name= lib-ver=9.5.1\n")
+}
+
+func TestClientNoEvictNoTouch(t *testing.T) {
+	s, c := runWithClient(t)
+
+	mustOK(t, c, "CLIENT", "NO-EVICT", "on")
+	mustContain(t, c, "CLIENT", "INFO", " flags=e ")
+	mustOK(t, c, "CLIENT", "NO-TOUCH", "ON")
+	mustContain(t, c, "CLIENT", "INFO", " flags=eT ")
+	mustOK(t, c, "CLIENT", "NO-EVICT", "off")
+	mustContain(t, c, "CLIENT", "INFO", " flags=T ")
+	mustDo(t, c, "CLIENT", "NO-TOUCH", "maybe",
+		proto.Error(msgSyntaxError),
+	)
+	mustDo(t, c, "CLIENT", "NO-EVICT",
+		proto.Error("ERR wrong number of arguments for 'client|no-evict' command"),
+	)
+
+	now := time.Now()
+	s.SetTime(now)
+	mustOK(t, c, "SET", "foo", "bar")
+	s.SetTime(now.Add(time.Minute))
+	mustDo(t, c, "GET", "foo", proto.String("bar"))
+	must1(t, c, "EXISTS", "foo")
+	mustDo(t, c, "OBJECT", "IDLETIME", "foo", proto.Int(60))
+
+	// TOUCH still touches
+	must1(t, c, "TOUCH", "foo")
+	mustDo(t, c, "OBJECT", "IDLETIME", "foo", proto.Int(0))
+
+	s.SetTime(now.Add(2 * time.Minute))
+	mustOK(t, c, "CLIENT", "NO-TOUCH", "off")
+	must1(t, c, "EXISTS", "foo")
+	mustDo(t, c, "OBJECT", "IDLETIME", "foo", proto.Int(0))
+}
+
+func TestClientReply(t *testing.T) {
+	s := RunT(t)
+	conn, err := net.Dial("tcp", s.Addr())
+	ok(t, err)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	// no reply for the CLIENT REPLY OFF and SKIP calls themselves
+	for _, cmd := range [][]string{
+		{"CLIENT", "REPLY", "OFF"},
+		{"SET", "foo", "bar"},
+		{"CLIENT", "REPLY", "ON"},
+		{"CLIENT", "REPLY", "SKIP"},
+		{"GET", "foo"},
+		{"GET", "foo"},
+		{"CLIENT", "REPLY", "foo"},
+	} {
+		ok(t, proto.Write(conn, cmd))
+	}
+	for _, want := range []string{
+		proto.Inline("OK"),
+		proto.String("bar"),
+		proto.Error(msgSyntaxError),
+	} {
+		have, err := proto.Read(r)
+		ok(t, err)
+		equals(t, want, have)
+	}
+}
+
+func TestClientPause(t *testing.T) {
+	t.Run("write", func(t *testing.T) {
+		s, c := runWithClient(t)
+		c2, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c2.Close()
+
+		mustOK(t, c, "CLIENT", "PAUSE", "10000", "WRITE")
+
+		// reads are fine
+		mustDo(t, c2, "GET", "foo", proto.Nil)
+		mustDo(t, c2, "PING", proto.Inline("PONG"))
+		mustDo(t, c2, "CLIENT", "SETNAME", "foo", proto.Inline("OK"))
+		mustDo(t, c2, "MULTI", proto.Inline("OK"))
+		mustDo(t, c2, "DISCARD", proto.Inline("OK"))
+		mustDo(t, c2, "FUNCTION", "LIST", proto.Array())
+		// that doesn't make them read-only
+		assert(t, !s.IsReadOnlyCommand("CLIENT"), "CLIENT is not read-only")
+
+		done := make(chan string)
+		go func() {
+			res, _ := c2.Do("SET", "foo", "bar")
+			done <- res
+		}()
+		select {
+		case <-done:
+			t.Fatal("SET should be paused")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		// time doesn't pass by itself
+		s.FastForward(5 * time.Second)
+		select {
+		case <-done:
+			t.Fatal("SET should be paused")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		s.FastForward(5 * time.Second)
+		equals(t, proto.Inline("OK"), <-done)
+		s.CheckGet(t, "foo", "bar")
+	})
+
+	t.Run("all", func(t *testing.T) {
+		s, c := runWithClient(t)
+		c2, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c2.Close()
+
+		mustOK(t, c, "CLIENT", "PAUSE", "10000")
+		done := make(chan string)
+		go func() {
+			res, _ := c2.Do("GET", "foo")
+			done <- res
+		}()
+		select {
+		case <-done:
+			t.Fatal("GET should be paused")
+		case <-time.After(20 * time.Millisecond):
+		}
+		s.Server().Unpause()
+		equals(t, proto.Nil, <-done)
+	})
+
+	t.Run("unpause", func(t *testing.T) {
+		s, c := runWithClient(t)
+		c2, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c2.Close()
+
+		mustOK(t, c, "CLIENT", "PAUSE", "10000", "WRITE")
+		done := make(chan string)
+		go func() {
+			res, _ := c2.Do("SET", "foo", "bar")
+			done <- res
+		}()
+		mustOK(t, c, "CLIENT", "UNPAUSE")
+		equals(t, proto.Inline("OK"), <-done)
+		mustOK(t, c, "SET", "foo", "baz")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, c := runWithClient(t)
+
+		mustDo(t, c, "CLIENT", "PAUSE",
+			proto.Error(errWrongNumber("client|pause")),
+		)
+		mustDo(t, c, "CLIENT", "PAUSE", "foo",
+			proto.Error(msgTimeoutNotInt),
+		)
+		mustDo(t, c, "CLIENT", "PAUSE", "-1",
+			proto.Error(msgTimeoutNegative),
+		)
+		mustDo(t, c, "CLIENT", "PAUSE", "100", "FOO",
+			proto.Error("ERR CLIENT PAUSE mode must be WRITE or ALL"),
+		)
+		mustDo(t, c, "CLIENT", "UNPAUSE", "foo",
+			proto.Error(errWrongNumber("client|unpause")),
+		)
+		// zero doesn't pause
+		mustOK(t, c, "CLIENT", "PAUSE", "0")
+		mustOK(t, c, "SET", "foo", "bar")
+	})
+}
+
+func TestClientTracking(t *testing.T) {
+	invalidate := func(keys ...string) string {
+		return proto.Push(proto.String("invalidate"), proto.Strings(keys...))
+	}
+
+	t.Run("default", func(t *testing.T) {
+		s, c := runWithClient(t)
+		useRESP3(t, c)
+		c2, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c2.Close()
+
+		mustOK(t, c, "CLIENT", "TRACKING", "ON")
+		mustDo(t, c, "GET", "foo", proto.NilResp3)
+		mustOK(t, c2, "SET", "foo", "bar")
+		mustRead(t, c, invalidate("foo"))
+
+		// not read again, so no new message
+		mustOK(t, c2, "SET", "foo", "baz")
+		mustDo(t, c, "PING", proto.Inline("PONG"))
+
+		// our own writes are sent after the reply
+		mustDo(t, c, "MGET", "foo", "bar", proto.Array(proto.String("baz"), proto.NilResp3))
+		mustOK(t, c, "SET", "bar", "1")
+		mustRead(t, c, invalidate("bar"))
+
+		// expired keys
+		mustDo(t, c, "GET", "foo", proto.String("baz"))
+		must1(t, c2, "EXPIRE", "foo", "10")
+		mustRead(t, c, invalidate("foo"))
+		mustDo(t, c, "TTL", "foo", proto.Int(10))
+		s.FastForward(20 * time.Second)
+		mustRead(t, c, invalidate("foo"))
+
+		mustOK(t, c2, "FLUSHALL")
+		mustRead(t, c, proto.Push(proto.String("invalidate"), proto.NilResp3))
+
+		mustOK(t, c, "CLIENT", "TRACKING", "OFF")
+		mustDo(t, c, "GET", "foo", proto.NilResp3)
+		mustOK(t, c2, "SET", "foo", "bar")
+		mustDo(t, c, "PING", proto.Inline("PONG"))
+	})
+
+	t.Run("cleanup", func(t *testing.T) {
+		s, c := runWithClient(t)
+		useRESP3(t, c)
+		trackedKeys := func() int {
+			s.Lock()
+			defer s.Unlock()
+			return len(s.tracking.keys)
+		}
+
+		mustOK(t, c, "CLIENT", "TRACKING", "ON")
+		mustDo(t, c, "GET", "foo", proto.NilResp3)
+		equals(t, 1, trackedKeys())
+		mustOK(t, c, "CLIENT", "TRACKING", "OFF")
+		equals(t, 0, trackedKeys())
+
+		c2, err := proto.Dial(s.Addr())
+		ok(t, err)
+		useRESP3(t, c2)
+		mustOK(t, c2, "CLIENT", "TRACKING", "ON")
+		mustDo(t, c2, "GET", "bar", proto.NilResp3)
+		equals(t, 1, trackedKeys())
+		c2.Close()
+		for i := 0; trackedKeys() != 0 && i < 100; i++ {
+			time.Sleep(time.Millisecond)
+		}
+		equals(t, 0, trackedKeys())
+	})
+
+	t.Run("transaction", func(t *testing.T) {
+		_, c := runWithClient(t)
+		useRESP3(t, c)
+
+		mustOK(t, c, "CLIENT", "TRACKING", "ON")
+		mustOK(t, c, "MULTI")
+		mustDo(t, c, "GET", "foo", proto.Inline("QUEUED"))
+		mustDo(t, c, "SET", "foo", "bar", proto.Inline("QUEUED"))
+		mustDo(t, c, "EXEC", proto.Array(proto.NilResp3, proto.Inline("OK")))
+		mustRead(t, c, invalidate("foo"))
+	})
+
+	t.Run("scripts", func(t *testing.T) {
+		s, c := runWithClient(t)
+		useRESP3(t, c)
+
+		mustOK(t, c, "CLIENT", "TRACKING", "ON")
+		mustDo(t, c, "EVAL", "return redis.call('GET', KEYS[1])", "1", "foo", proto.NilResp3)
+		s.Set("foo", "bar")
+		mustRead(t, c, invalidate("foo"))
+	})
+
+	t.Run("noloop", func(t *testing.T) {
+		s, c := runWithClient(t)
+		useRESP3(t, c)
+
+		mustOK(t, c, "CLIENT", "TRACKING", "ON", "NOLOOP")
+		mustDo(t, c, "GET", "foo", proto.NilResp3)
+		mustOK(t, c, "SET", "foo", "bar")
+		mustDo(t, c, "PING", proto.Inline("PONG"))
+
+		mustDo(t, c, "GET", "foo", proto.String("bar"))
+		s.Set("foo", "baz")
+		mustRead(t, c, invalidate("foo"))
+	})
+
+	t.Run("bcast", func(t *testing.T) {
+		s, c := runWithClient(t)
+		useRESP3(t, c)
+
+		mustOK(t, c, "CLIENT", "TRACKING", "ON", "BCAST", "PREFIX", "user:", "PREFIX", "session:")
+		s.Set("user:1", "foo")
+		mustRead(t, c, invalidate("user:1"))
+		s.Set("other", "foo")
+		s.HSet("session:1", "foo", "bar")
+		mustRead(t, c, invalidate("session:1"))
+
+		mustDo(t, c, "CLIENT", "TRACKINGINFO",
+			proto.Map(
+				proto.String("flags"), proto.StringSet("on", "bcast"),
+				proto.String("redirect"), proto.Int(0),
+				proto.String("prefixes"), proto.Strings("user:", "session:"),
+			),
+		)
+
+		mustDo(t, c, "CLIENT", "TRACKING", "ON", "BCAST", "PREFIX", "use",
+			proto.Error("ERR Prefix 'use' overlaps with an existing prefix 'user:'. Prefixes for a single client must not overlap."),
+		)
+		mustDo(t, c, "CLIENT", "TRACKING", "ON", "BCAST", "PREFIX", "a", "PREFIX", "ab",
+			proto.Error("ERR Prefix 'a' overlaps with another provided prefix 'ab'. Prefixes for a single client must not overlap."),
+		)
+		mustDo(t, c, "CLIENT", "TRACKING", "ON",
+			proto.Error("ERR You can't switch BCAST mode on/off before disabling tracking for this client, and then re-enabling it with a different mode."),
+		)
+	})
+
+	t.Run("optin and optout", func(t *testing.T) {
+		s, c := runWithClient(t)
+		useRESP3(t, c)
+
+		mustOK(t, c, "CLIENT", "TRACKING", "ON", "OPTIN")
+		mustDo(t, c, "GET", "foo", proto.NilResp3)
+		mustOK(t, c, "CLIENT", "CACHING", "YES")
+		mustDo(t, c, "CLIENT", "TRACKINGINFO",
+			proto.Map(
+				proto.String("flags"), proto.StringSet("on", "optin", "caching-yes"),
+				proto.String("redirect"), proto.Int(0),
+				proto.String("prefixes"), proto.Strings(),
+			),
+		)
+		mustDo(t, c, "GET", "bar", proto.NilResp3)
+		s.Set("foo", "1")
+		s.Set("bar", "1")
+		mustRead(t, c, invalidate("bar"))
+		mustDo(t, c, "CLIENT", "CACHING", "NO",
+			proto.Error("ERR CLIENT CACHING NO is only valid when tracking is enabled in OPTOUT mode."),
+		)
+
+		mustOK(t, c, "CLIENT", "TRACKING", "OFF")
+		mustOK(t, c, "CLIENT", "TRACKING", "ON", "OPTOUT")
+		mustOK(t, c, "CLIENT", "CACHING", "NO")
+		mustDo(t, c, "GET", "foo", proto.String("1"))
+		mustDo(t, c, "GET", "bar", proto.String("1"))
+		s.Set("foo", "2")
+		s.Set("bar", "2")
+		mustRead(t, c, invalidate("bar"))
+	})
+
+	t.Run("redirect", func(t *testing.T) {
+		s, c := runWithClient(t)
+		c2, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c2.Close()
+
+		mustDo(t, c2, "CLIENT", "ID", proto.Int(2))
+		mustDo(t, c2, "SUBSCRIBE", "__redis__:invalidate",
+			proto.Array(proto.String("subscribe"), proto.String("__redis__:invalidate"), proto.Int(1)),
+		)
+
+		mustDo(t, c, "CLIENT", "GETREDIR", proto.Int(-1))
+		mustOK(t, c, "CLIENT", "TRACKING", "ON", "REDIRECT", "2")
+		mustDo(t, c, "CLIENT", "GETREDIR", proto.Int(2))
+		mustDo(t, c, "GET", "foo", proto.Nil)
+		s.Set("foo", "bar")
+		mustRead(t, c2,
+			proto.Array(
+				proto.String("message"),
+				proto.String("__redis__:invalidate"),
+				proto.Strings("foo"),
+			),
+		)
+
+		flags := s.Clients()[0].Flags
+		equals(t, "t", flags)
+
+		c2.Close()
+		for len(s.Clients()) != 1 {
+			time.Sleep(time.Millisecond)
+		}
+		mustDo(t, c, "GET", "foo", proto.String("bar"))
+		s.Set("foo", "baz")
+		mustDo(t, c, "CLIENT", "TRACKINGINFO",
+			proto.Array(
+				proto.String("flags"), proto.Strings("on", "broken_redirect"),
+				proto.String("redirect"), proto.Int(2),
+				proto.String("prefixes"), proto.Strings(),
+			),
+		)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, c := runWithClient(t)
+
+		mustDo(t, c, "CLIENT", "TRACKING",
+			proto.Error(errWrongNumber("client|tracking")),
+		)
+		mustDo(t, c, "CLIENT", "TRACKING", "MAYBE",
+			proto.Error(msgSyntaxError),
+		)
+		mustDo(t, c, "CLIENT", "TRACKING", "ON", "FOO",
+			proto.Error(msgSyntaxError),
+		)
+		mustDo(t, c, "CLIENT", "TRACKING", "ON", "REDIRECT", "foo",
+			proto.Error(msgInvalidInt),
+		)
+		mustDo(t, c, "CLIENT", "TRACKING", "ON", "REDIRECT", "99",
+			proto.Error("ERR The client ID you want redirect to does not exist"),
+		)
+		mustDo(t, c, "CLIENT", "TRACKING", "ON", "REDIRECT", "1", "REDIRECT", "1",
+			proto.Error("ERR A client can only redirect to a single other client"),
+		)
+		mustDo(t, c, "CLIENT", "TRACKING", "ON", "PREFIX", "foo",
+			proto.Error("ERR PREFIX option requires BCAST mode to be enabled"),
+		)
+		mustDo(t, c, "CLIENT", "TRACKING", "ON", "BCAST", "OPTIN",
+			proto.Error("ERR OPTIN and OPTOUT are not compatible with BCAST"),
+		)
+		mustDo(t, c, "CLIENT", "TRACKING", "ON", "OPTIN", "OPTOUT",
+			proto.Error("ERR You can't use both OPTIN and OPTOUT"),
+		)
+		mustDo(t, c, "CLIENT", "CACHING", "YES",
+			proto.Error("ERR CLIENT CACHING can be called only when the client is in tracking mode with OPTIN or OPTOUT mode enabled"),
+		)
+		mustOK(t, c, "CLIENT", "TRACKING", "ON", "OPTIN")
+		mustDo(t, c, "CLIENT", "TRACKING", "ON", "OPTOUT",
+			proto.Error("ERR You can't switch OPTIN/OPTOUT mode before disabling tracking for this client, and then re-enabling it with a different mode."),
+		)
+		mustDo(t, c, "CLIENT", "CACHING", "MAYBE",
+			proto.Error(msgSyntaxError),
+		)
+		mustDo(t, c, "CLIENT", "CACHING",
+			proto.Error(errWrongNumber("client|caching")),
+		)
+		mustDo(t, c, "CLIENT", "GETREDIR", "foo",
+			proto.Error(errWrongNumber("client|getredir")),
+		)
+		mustDo(t, c, "CLIENT", "TRACKINGINFO", "foo",
+			proto.Error(errWrongNumber("client|trackinginfo")),
+		)
+	})
+}
@@ -9,6 +9,27 @@ import (
 	"github.com/alicebob/miniredis/v2/server"
 )
 
+const (
+	msgNoClusterScript = "ERR Can not run script on cluster, 'no-cluster' flag is set."
+	msgCrossSlotScript = "ERR Script attempted to access keys that do not hash to the same slot"
+)
+
+// EnableClusterMode makes scripts and functions run as they do on a cluster
+// node: scripts with the "no-cluster" flag are refused, and scripts without
+// the "allow-cross-slot-keys" flag can only use keys from a single hash slot.
+// EVAL scripts without a "#!lua" shebang line can always use any key, as in
+// Redis. StateClusterDown also makes scripts run this way.
+func (m *Miniredis) EnableClusterMode() {
+	m.Lock()
+	defer m.Unlock()
+	m.clusterMode = true
+}
+
+// inCluster is whether scripts run as on a cluster node. No locks!
+func (m *Miniredis) inCluster() bool {
+	return m.clusterMode || m.State() == StateClusterDown
+}
+
 // commandsCluster handles some cluster operations.
 func commandsCluster(m *Miniredis) {
 	m.srv.Register("CLUSTER", m.cmdCluster)
@@ -67,7 +88,7 @@ func (m *Miniredis) cmdClusterNodes(c *server.Peer, cmd string, args []string) {
 		// do not try to use m.Addr() here, as m is blocked by this tx.
 		addr := m.srv.Addr()
 		port := m.srv.Addr().Port
-		c.WriteBulk(fmt.Sprintf("e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca %s@%d myself,master - 0 0 1 connected 0-16383", addr, port))
+		c.WriteVerbatim("txt", fmt.Sprintf("e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca %s@%d myself,master - 0 0 1 connected 0-16383", addr, port))
 	})
 }
 
@@ -120,3 +141,58 @@ func (m *Miniredis) cmdClusterShards(c *server.Peer, cmd string, args []string)
 		c.WriteBulk("online")
 	})
 }
+
+// keySlot is the cluster hash slot of a key. Only the part between the first
+// "{" and the next "}" is used, if that's not empty.
+func keySlot(key string) int {
+	if i := strings.IndexByte(key, '{'); i >= 0 {
+		if j := strings.IndexByte(key[i+1:], '}'); j > 0 {
+			key = key[i+1 : i+1+j]
+		}
+	}
+	return int(crc16(key) % 16384)
+}
+
+// crc16 is the CRC16-CCITT (XMODEM) checksum, which cluster slots use.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// scriptSlot is the single hash slot a script can use keys from, as a script
+// without "allow-cross-slot-keys" on a cluster node.
+type scriptSlot struct {
+	slot int // -1 until the first key
+}
+
+// newScriptSlot uses the slot of the declared keys, if any.
+func newScriptSlot(keys []string) *scriptSlot {
+	s := &scriptSlot{slot: -1}
+	s.use(keys)
+	return s
+}
+
+// use checks the keys of a redis.call(). Returns false if they are not all in
+// the slot of the script.
+func (s *scriptSlot) use(keys []string) bool {
+	for _, k := range keys {
+		slot := keySlot(k)
+		if s.slot == -1 {
+			s.slot = slot
+		}
+		if slot != s.slot {
+			return false
+		}
+	}
+	return true
+}
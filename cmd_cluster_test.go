@@ -80,3 +80,10 @@ func TestCluster(t *testing.T) {
 		)
 	})
 }
+
+func TestKeySlot(t *testing.T) {
+	equals(t, 12182, keySlot("foo"))
+	equals(t, 5061, keySlot("bar"))
+	equals(t, keySlot("user1000"), keySlot("{user1000}.following"))
+	equals(t, uint16(0x31c3), crc16("123456789"))
+}
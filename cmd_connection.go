@@ -16,7 +16,7 @@ func commandsConnection(m *Miniredis) {
 	m.srv.Register("PING", m.cmdPing)
 	m.srv.Register("QUIT", m.cmdQuit)
 	m.srv.Register("SELECT", m.cmdSelect)
-	m.srv.Register("SWAPDB", m.cmdSwapdb)
+	m.srv.Register("SWAPDB", m.cmdSwapdb, server.WriteOption())
 }
 
 // PING
@@ -103,6 +103,7 @@ func (m *Miniredis) cmdAuth(c *server.Peer, cmd string, args []string) {
 		}
 
 		ctx.authenticated = true
+		ctx.user = opts.username
 		c.WriteOK()
 	})
 }
@@ -169,6 +170,7 @@ func (m *Miniredis) cmdHello(c *server.Peer, cmd string, args []string) {
 			return
 		}
 		getCtx(c).authenticated = true
+		getCtx(c).user = opts.username
 	}
 
 	c.Resp3 = opts.version == 3
@@ -177,7 +179,7 @@ func (m *Miniredis) cmdHello(c *server.Peer, cmd string, args []string) {
 	c.WriteBulk("server")
 	c.WriteBulk("miniredis")
 	c.WriteBulk("version")
-	c.WriteBulk("8.4.0")
+	c.WriteBulk(redisVersion)
 	c.WriteBulk("proto")
 	c.WriteInt(opts.version)
 	c.WriteBulk("id")
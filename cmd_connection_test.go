@@ -233,6 +233,181 @@ func TestSetError(t *testing.T) {
 	)
 }
 
+func TestSetState(t *testing.T) {
+	s, c := runWithClient(t)
+	s.Set("foo", "bar")
+
+	t.Run("loading", func(t *testing.T) {
+		s.SetState(StateLoading)
+		defer s.SetState(StateNormal)
+		mustDo(t, c, "GET", "foo", proto.Error(msgLoading))
+		mustDo(t, c, "PING", proto.Error(msgLoading))
+		mustContain(t, c, "INFO", "persistence", "loading:1")
+		mustOK(t, c, "SELECT", "0")
+		mustContain(t, c, "EVAL", "return 1", "0", msgLoading)
+		s.SetState(StateNormal)
+		mustContain(t, c, "INFO", "persistence", "loading:0")
+		mustDo(t, c, "GET", "foo", proto.String("bar"))
+	})
+
+	t.Run("busy", func(t *testing.T) {
+		s.SetState(StateBusy)
+		defer s.SetState(StateNormal)
+		mustDo(t, c, "GET", "foo", proto.Error(msgBusy))
+		mustDo(t, c, "INFO", proto.Error(msgBusy))
+		mustOK(t, c, "SCRIPT", "KILL")
+		equals(t, StateNormal, s.State())
+		mustDo(t, c, "GET", "foo", proto.String("bar"))
+	})
+
+	t.Run("masterdown", func(t *testing.T) {
+		s.SetState(StateMasterDown)
+		defer s.SetState(StateNormal)
+		mustDo(t, c, "GET", "foo", proto.Error(msgMasterDown))
+		mustContain(t, c, "INFO", "replication", "master_link_status:down")
+		must0(t, c, "PUBLISH", "chan", "hello")
+	})
+
+	t.Run("clusterdown", func(t *testing.T) {
+		s.SetState(StateClusterDown)
+		defer s.SetState(StateNormal)
+		mustDo(t, c, "GET", "foo", proto.Error(msgClusterDown))
+		mustDo(t, c, "MSET", "a", "1", "b", "2", proto.Error(msgClusterDown))
+		mustDo(t, c, "PING", proto.Inline("PONG"))
+		mustDo(t, c, "DBSIZE", proto.Int(1))
+		mustDo(t, c, "WATCH", "foo", proto.Error(msgClusterDown))
+		mustDo(t, c, "EVAL", "return 1", "1", "foo", proto.Error(msgClusterDown))
+		mustDo(t, c, "EVAL", "return 1", "0", proto.Int(1))
+		// keyless commands which aren't listed anywhere
+		mustContain(t, c, "LOLWUT", "Redis ver.")
+		mustDo(t, c, "ECHO", "hi", proto.String("hi"))
+	})
+
+	t.Run("readonly", func(t *testing.T) {
+		s.SetState(StateReadOnly)
+		defer s.SetState(StateNormal)
+		mustDo(t, c, "GET", "foo", proto.String("bar"))
+		mustDo(t, c, "SET", "foo", "baz", proto.Error(msgReadOnly))
+		mustContain(t, c, "INFO", "replication", "role:slave")
+		mustDo(t, c, "EVAL", "return redis.call('GET', 'foo')", "0", proto.String("bar"))
+		mustContain(t, c, "EVAL", "return redis.call('SET', 'foo', 'baz')", "0", msgReadOnly)
+		mustDo(t, c, "FUNCTION", "LOAD", "#!lua name=lib\nredis.register_function('f', function() end)", proto.Error(msgReadOnly))
+		mustDo(t, c, "FUNCTION", "DELETE", "lib", proto.Error(msgReadOnly))
+		mustDo(t, c, "FUNCTION", "FLUSH", proto.Error(msgReadOnly))
+		mustDo(t, c, "FUNCTION", "RESTORE", "payload", proto.Error(msgReadOnly))
+		mustDo(t, c, "FUNCTION", "LIST", proto.Array())
+
+		mustOK(t, c, "MULTI")
+		mustDo(t, c, "SET", "foo", "baz", proto.Error(msgReadOnly))
+		mustDo(t, c, "EXEC",
+			proto.Error("EXECABORT Transaction discarded because of previous errors."),
+		)
+
+		s.SetState(StateNormal)
+		mustContain(t, c, "INFO", "replication", "role:master")
+		mustOK(t, c, "SET", "foo", "bar")
+	})
+}
+
+func TestInjectError(t *testing.T) {
+	s, c := runWithClient(t)
+
+	t.Run("count", func(t *testing.T) {
+		rule := s.InjectError(ErrorRule{
+			Cmd:   "exec",
+			Count: 2,
+			Error: "EXECABORT Transaction discarded because of previous errors.",
+		})
+		for i := 0; i < 2; i++ {
+			mustOK(t, c, "MULTI")
+			mustDo(t, c, "SET", "foo", "bar", proto.Inline("QUEUED"))
+			mustDo(t, c, "EXEC",
+				proto.Error("EXECABORT Transaction discarded because of previous errors."),
+			)
+		}
+		equals(t, 2, rule.Fired())
+		mustOK(t, c, "MULTI")
+		mustDo(t, c, "SET", "foo", "bar", proto.Inline("QUEUED"))
+		mustDo(t, c, "EXEC", proto.Array(proto.Inline("OK")))
+		equals(t, 2, rule.Fired())
+	})
+
+	t.Run("keys", func(t *testing.T) {
+		s.Set("cfg:a", "1")
+		s.Set("other", "2")
+		rule := s.InjectError(ErrorRule{
+			Cmd:   "GET",
+			Key:   "cfg:*",
+			Count: 3,
+			Error: "LOADING Redis is loading the dataset in memory",
+		})
+		mustDo(t, c, "GET", "other", proto.String("2"))
+		mustDo(t, c, "MGET", "cfg:a", proto.Strings("1"))
+		for i := 0; i < 2; i++ {
+			mustDo(t, c, "GET", "cfg:a",
+				proto.Error("LOADING Redis is loading the dataset in memory"),
+			)
+		}
+		mustContain(t, c, "EVAL", "return redis.call('GET', KEYS[1])", "1", "cfg:a",
+			"LOADING Redis is loading the dataset in memory",
+		)
+		mustDo(t, c, "GET", "cfg:a", proto.String("1"))
+		equals(t, 3, rule.Fired())
+	})
+
+	t.Run("transaction", func(t *testing.T) {
+		rule := s.InjectError(ErrorRule{
+			Cmd:   "INCR",
+			Error: "TRYAGAIN Multiple keys request during rehashing of slot",
+		})
+		mustOK(t, c, "MULTI")
+		mustDo(t, c, "INCR", "n",
+			proto.Error("TRYAGAIN Multiple keys request during rehashing of slot"),
+		)
+		mustDo(t, c, "EXEC",
+			proto.Error("EXECABORT Transaction discarded because of previous errors."),
+		)
+		rule.Remove()
+		rule.Remove()
+		must1(t, c, "INCR", "n")
+		equals(t, 1, rule.Fired())
+	})
+
+	t.Run("probability", func(t *testing.T) {
+		run := func() []bool {
+			s.Seed(42)
+			rule := s.InjectError(ErrorRule{
+				WritesOnly:  true,
+				Probability: 0.1,
+				Error:       "TRYAGAIN Multiple keys request during rehashing of slot",
+			})
+			defer rule.Remove()
+			var failed []bool
+			n := 0
+			for i := 0; i < 200; i++ {
+				mustDo(t, c, "GET", "foo", proto.String("bar"))
+				res, err := c.Do("SET", "foo", "bar")
+				ok(t, err)
+				failed = append(failed, res != proto.Inline("OK"))
+				if res != proto.Inline("OK") {
+					n++
+				}
+			}
+			equals(t, n, rule.Fired())
+			assert(t, n > 5 && n < 50, "failed %d times", n)
+			return failed
+		}
+		equals(t, run(), run())
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		s.InjectError(ErrorRule{Error: "ERR nope"})
+		mustDo(t, c, "PING", proto.Error("ERR nope"))
+		s.ClearErrors()
+		mustDo(t, c, "PING", proto.Inline("PONG"))
+	})
+}
+
 func TestHello(t *testing.T) {
 	t.Run("default user", func(t *testing.T) {
 		s, c := runWithClient(t)
@@ -0,0 +1,495 @@
+// Commands from https://redis.io/docs/latest/operate/oss_and_stack/reference/internals/
+
+package miniredis
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/server"
+	"github.com/alicebob/miniredis/v2/size"
+)
+
+const (
+	msgDebugDisabled   = "ERR DEBUG command not allowed. If the enable-debug-command option is set to \"local\", you can run it from a local connection, otherwise you need to set this option in the configuration file, and then restart the server."
+	msgFDebugUsage     = "ERR unknown subcommand or wrong number of arguments for '%s'. Try DEBUG HELP."
+	msgDebugProtocol   = "ERR Wrong protocol type name. Please use one of the following: string|integer|double|bignum|null|array|set|map|attrib|push|verbatim|true|false"
+	msgDebugPushResp2  = "ERR RESP2 is not supported by this command"
+	msgDebugReloadOpts = "ERR DEBUG RELOAD only supports the MERGE, NOFLUSH and NOSAVE options."
+	msgDebugLoadFailed = "ERR Error trying to load the RDB dump, check server logs."
+	msgDebugThreshold  = "ERR argument must be a memory value bigger than 1 and smaller than 4gb"
+
+	// list-max-listpack-size -2: lists are a single listpack up to 8kb
+	listpackMaxBytes = 8 * 1024
+	// default of DEBUG QUICKLIST-PACKED-THRESHOLD
+	defaultPackedThreshold = 1 << 30
+)
+
+// debugState is everything DEBUG keeps between calls.
+type debugState struct {
+	enabled         bool             // see EnableDebugCommand()
+	dump            map[int]*RedisDB // the "RDB file" of DEBUG RELOAD
+	packedThreshold int              // DEBUG QUICKLIST-PACKED-THRESHOLD. 0 is the default
+}
+
+// EnableDebugCommand allows the DEBUG command, as if "enable-debug-command" is
+// set to "yes". DEBUG is refused by default, the same as in Redis.
+func (m *Miniredis) EnableDebugCommand() {
+	m.Lock()
+	defer m.Unlock()
+	m.debug.enabled = true
+}
+
+// commandsDebug handles the DEBUG command.
+func commandsDebug(m *Miniredis) {
+	m.srv.Register("DEBUG", m.cmdDebug)
+}
+
+// DEBUG
+func (m *Miniredis) cmdDebug(c *server.Peer, cmd string, args []string) {
+	if !m.isValidCMD(c, cmd, args, atLeast(1)) {
+		return
+	}
+	if ctx := getCtx(c); ctx.nested {
+		c.WriteError(msgNotFromScripts(ctx.nestedSHA))
+		return
+	}
+
+	// refused before MULTI queues it
+	m.Lock()
+	enabled := m.debug.enabled
+	m.Unlock()
+	if !enabled {
+		setDirty(c)
+		c.WriteError(msgDebugDisabled)
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		sub, subArgs := strings.ToLower(args[0]), args[1:]
+		switch {
+		case sub == "protocol" && len(subArgs) == 1:
+			m.cmdDebugProtocol(c, subArgs[0])
+		case sub == "sleep" && len(subArgs) == 1:
+			// like strtod(), anything which isn't a number is 0
+			secs, _ := strconv.ParseFloat(subArgs[0], 64)
+			if secs > 0 {
+				// we hold the lock, so this blocks all other clients
+				time.Sleep(time.Duration(secs * float64(time.Second)))
+			}
+			c.WriteOK()
+		case sub == "object" && len(subArgs) == 1:
+			m.cmdDebugObject(c, m.db(ctx.selectedDB), subArgs[0])
+		case sub == "set-active-expire" && len(subArgs) == 1:
+			// like atoi(). This is SetActiveExpire(): with 0, TTLs stop counting
+			// down in real time.
+			n, _ := strconv.Atoi(subArgs[0])
+			m.setActiveExpire(n != 0)
+			c.WriteOK()
+		case sub == "reload":
+			m.cmdDebugReload(c, subArgs)
+		case sub == "quicklist-packed-threshold" && len(subArgs) == 1:
+			n, ok := parseMemory(subArgs[0])
+			if !ok || n <= 1 || int64(n) >= 1<<32 {
+				c.WriteError(msgDebugThreshold)
+				return
+			}
+			m.debug.packedThreshold = n
+			c.WriteOK()
+		case sub == "change-repl-id" && len(subArgs) == 0:
+			// there is no replication
+			c.WriteOK()
+		case sub == "jmap" && len(subArgs) == 0:
+			// Redis logs the heap stats, we have nothing to log
+			c.WriteOK()
+		default:
+			c.WriteError(fmt.Sprintf(msgFDebugUsage, args[0]))
+		}
+	})
+}
+
+// DEBUG PROTOCOL. The replies are the ones Redis uses in its own tests.
+func (m *Miniredis) cmdDebugProtocol(c *server.Peer, typ string) {
+	switch strings.ToLower(typ) {
+	case "string":
+		c.WriteBulk("Hello World")
+	case "integer":
+		c.WriteInt(12345)
+	case "double":
+		c.WriteFloat(3.141)
+	case "bignum":
+		c.WriteBigNumber("1234567999999999999999999999999999999")
+	case "null":
+		c.WriteNull()
+	case "array":
+		c.WriteLen(3)
+		for i := 0; i < 3; i++ {
+			c.WriteInt(i)
+		}
+	case "set":
+		c.WriteSetLen(3)
+		for i := 0; i < 3; i++ {
+			c.WriteInt(i)
+		}
+	case "map":
+		c.WriteMapLen(3)
+		for i := 0; i < 3; i++ {
+			c.WriteInt(i)
+			c.WriteBool(i == 1)
+		}
+	case "attrib":
+		if c.Resp3 {
+			c.WriteAttributeLen(1)
+			c.WriteBulk("key-popularity")
+			c.WriteLen(2)
+			c.WriteBulk("key:123")
+			c.WriteInt(90)
+		}
+		// attributes are not a reply on their own
+		c.WriteBulk("Some real reply following the attribute")
+	case "push":
+		if !c.Resp3 {
+			c.WriteError(msgDebugPushResp2)
+			return
+		}
+		c.Push(func(w *server.Writer) {
+			w.WritePushLen(2)
+			w.WriteBulk("server-cpu-usage")
+			w.WriteInt(42)
+		})
+		c.WriteBulk("Some real reply following the push reply")
+	case "true":
+		c.WriteBool(true)
+	case "false":
+		c.WriteBool(false)
+	case "verbatim":
+		c.WriteVerbatim("txt", "This is a verbatim\nstring")
+	default:
+		c.WriteError(msgDebugProtocol)
+	}
+}
+
+// DEBUG OBJECT. Encodings follow the Redis defaults for the *-max-listpack-*
+// options. The address and serializedlength are made up, but stable.
+func (m *Miniredis) cmdDebugObject(c *server.Peer, db *RedisDB, key string) {
+	if !db.exists(key) {
+		c.WriteError(msgKeyNotFound)
+		return
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(key))
+
+	now := m.effectiveNow()
+	lru, ok := db.lru[key]
+	if !ok {
+		lru = now
+	}
+
+	enc := m.objectEncoding(db, key)
+	res := fmt.Sprintf(
+		"Value at:0x%012x refcount:1 encoding:%s serializedlength:%d lru:%d lru_seconds_idle:%d",
+		h.Sum64()&0xffffffffffff,
+		enc,
+		serializedLength(db, key),
+		lru.Unix()&(1<<24-1),
+		int(now.Sub(lru).Seconds()),
+	)
+	if enc == "quicklist" {
+		nodes, total := m.quicklistNodes(db.listKeys[key])
+		res += fmt.Sprintf(
+			" ql_nodes:%d ql_avg_node:%.2f ql_listpack_max:-2 ql_compressed:0 ql_uncompressed_size:%d",
+			nodes,
+			float64(len(db.listKeys[key]))/float64(nodes),
+			total,
+		)
+	}
+	c.WriteInline(res)
+}
+
+// DEBUG RELOAD [MERGE] [NOFLUSH] [NOSAVE]. There is no RDB file, the "dump"
+// is a copy of all databases, kept until the next DEBUG RELOAD.
+func (m *Miniredis) cmdDebugReload(c *server.Peer, args []string) {
+	var merge, noflush, nosave bool
+	for _, a := range args {
+		switch strings.ToLower(a) {
+		case "merge":
+			merge = true
+		case "noflush":
+			noflush = true
+		case "nosave":
+			nosave = true
+		default:
+			c.WriteError(msgDebugReloadOpts)
+			return
+		}
+	}
+
+	if !nosave {
+		m.debug.dump = m.snapshotDBs()
+	}
+	if m.debug.dump == nil {
+		c.WriteError(msgDebugLoadFailed)
+		return
+	}
+	if !noflush {
+		m.flushAll()
+	}
+
+	if !merge {
+		for id, src := range m.debug.dump {
+			db := m.db(id)
+			for k := range src.keys {
+				if db.exists(k) {
+					// Redis refuses duplicate keys
+					c.WriteError(msgDebugLoadFailed)
+					return
+				}
+			}
+		}
+	}
+	for id, src := range m.debug.dump {
+		db := m.db(id)
+		for k := range src.keys {
+			db.del(k, true)
+			m.copy(src, k, db, k)
+			if fields, ok := src.hashTTLs[k]; ok {
+				ttls := map[string]time.Duration{}
+				for f, ttl := range fields {
+					ttls[f] = ttl
+				}
+				db.hashTTLs[k] = ttls
+			}
+		}
+	}
+	c.WriteOK()
+}
+
+// objectEncoding is the encoding Redis would use for the key, with the default
+// config.
+func (m *Miniredis) objectEncoding(db *RedisDB, key string) string {
+	switch db.t(key) {
+	case keyTypeString:
+		v := db.stringKeys[key]
+		if isIntEncoded(v) {
+			return "int"
+		}
+		if len(v) <= 44 {
+			return "embstr"
+		}
+		return "raw"
+	case keyTypeHash:
+		h := db.hashKeys[key]
+		if len(h) > 128 {
+			return "hashtable"
+		}
+		for f, v := range h {
+			if len(f) > 64 || len(v) > 64 {
+				return "hashtable"
+			}
+		}
+		if len(db.hashTTLs[key]) > 0 {
+			return "listpackex"
+		}
+		return "listpack"
+	case keyTypeList:
+		l := db.listKeys[key]
+		threshold := m.packedThreshold()
+		n := 0
+		for _, v := range l {
+			if len(v) >= threshold {
+				return "quicklist"
+			}
+			n += len(v) + 2
+		}
+		if n > listpackMaxBytes {
+			return "quicklist"
+		}
+		return "listpack"
+	case keyTypeSet:
+		s := db.setKeys[key]
+		ints, short := true, true
+		for v := range s {
+			if !isIntEncoded(v) {
+				ints = false
+			}
+			if len(v) > 64 {
+				short = false
+			}
+		}
+		switch {
+		case ints && len(s) <= 512:
+			return "intset"
+		case short && len(s) <= 128:
+			return "listpack"
+		default:
+			return "hashtable"
+		}
+	case keyTypeSortedSet:
+		ss := db.sortedsetKeys[key]
+		if len(ss) > 128 {
+			return "skiplist"
+		}
+		for v := range ss {
+			if len(v) > 64 {
+				return "skiplist"
+			}
+		}
+		return "listpack"
+	case keyTypeStream:
+		return "stream"
+	case keyTypeHll:
+		return "raw"
+	default:
+		return "unknown"
+	}
+}
+
+func (m *Miniredis) packedThreshold() int {
+	if m.debug.packedThreshold == 0 {
+		return defaultPackedThreshold
+	}
+	return m.debug.packedThreshold
+}
+
+// quicklistNodes splits a list in 8kb nodes, with a node of its own for every
+// element over the packed threshold. Returns the number of nodes and the total
+// size.
+func (m *Miniredis) quicklistNodes(l listKey) (int, int) {
+	threshold := m.packedThreshold()
+	nodes, total, cur := 0, 0, 0
+	for _, v := range l {
+		total += len(v)
+		if len(v) >= threshold {
+			if cur > 0 {
+				nodes++
+				cur = 0
+			}
+			nodes++
+			continue
+		}
+		if cur > 0 && cur+len(v)+2 > listpackMaxBytes {
+			nodes++
+			cur = 0
+		}
+		cur += len(v) + 2
+	}
+	if cur > 0 {
+		nodes++
+	}
+	if nodes == 0 {
+		nodes = 1
+	}
+	return nodes, total
+}
+
+// serializedLength estimates the size of the key in an RDB file.
+func serializedLength(db *RedisDB, key string) int {
+	switch db.t(key) {
+	case keyTypeString:
+		return rdbStringLen(db.stringKeys[key])
+	case keyTypeHash:
+		n := rdbLenLen(len(db.hashKeys[key]))
+		for f, v := range db.hashKeys[key] {
+			n += rdbStringLen(f) + rdbStringLen(v)
+		}
+		return n
+	case keyTypeList:
+		n := rdbLenLen(len(db.listKeys[key]))
+		for _, v := range db.listKeys[key] {
+			n += rdbStringLen(v)
+		}
+		return n
+	case keyTypeSet:
+		n := rdbLenLen(len(db.setKeys[key]))
+		for v := range db.setKeys[key] {
+			n += rdbStringLen(v)
+		}
+		return n
+	case keyTypeSortedSet:
+		n := rdbLenLen(len(db.sortedsetKeys[key]))
+		for v := range db.sortedsetKeys[key] {
+			n += rdbStringLen(v) + 8 // binary double
+		}
+		return n
+	case keyTypeStream:
+		return size.Of(db.streamKeys[key])
+	case keyTypeHll:
+		return rdbStringLen(string(db.hllKeys[key].Bytes()))
+	default:
+		return 0
+	}
+}
+
+// rdbStringLen is the size of an RDB encoded string
+func rdbStringLen(s string) int {
+	if isIntEncoded(s) {
+		n, _ := strconv.ParseInt(s, 10, 64)
+		switch {
+		case n >= -1<<7 && n < 1<<7:
+			return 2
+		case n >= -1<<15 && n < 1<<15:
+			return 3
+		case n >= -1<<31 && n < 1<<31:
+			return 5
+		}
+	}
+	return rdbLenLen(len(s)) + len(s)
+}
+
+// rdbLenLen is the size of an RDB encoded length
+func rdbLenLen(n int) int {
+	switch {
+	case n < 1<<6:
+		return 1
+	case n < 1<<14:
+		return 2
+	case int64(n) < 1<<32:
+		return 5
+	default:
+		return 9
+	}
+}
+
+// isIntEncoded is true for strings Redis stores as a number: decimal, fits in
+// an int64, and no leading zeros or '+'.
+func isIntEncoded(s string) bool {
+	if len(s) == 0 || len(s) > 20 {
+		return false
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	return err == nil && strconv.FormatInt(n, 10) == s
+}
+
+// parseMemory parses values such as "100", "1k", "1kb", "5mb", and "1gb", the
+// way Redis parses memory config options.
+func parseMemory(s string) (int, bool) {
+	s = strings.ToLower(s)
+	mul := 1
+	for _, u := range []struct {
+		suffix string
+		mul    int
+	}{
+		{"kb", 1024},
+		{"mb", 1024 * 1024},
+		{"gb", 1024 * 1024 * 1024},
+		{"k", 1000},
+		{"m", 1000 * 1000},
+		{"g", 1000 * 1000 * 1000},
+		{"b", 1},
+	} {
+		if strings.HasSuffix(s, u.suffix) {
+			s = strings.TrimSuffix(s, u.suffix)
+			mul = u.mul
+			break
+		}
+	}
+	n, err := strconv.ParseUint(s, 10, 63)
+	if err != nil {
+		return 0, false
+	}
+	return int(n) * mul, true
+}
@@ -0,0 +1,283 @@
+package miniredis
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/proto"
+)
+
+func TestDebug(t *testing.T) {
+	s, c := runWithClient(t)
+
+	t.Run("disabled", func(t *testing.T) {
+		mustContain(t, c,
+			"DEBUG", "PROTOCOL", "string",
+			"DEBUG command not allowed",
+		)
+		mustDo(t, c,
+			"DEBUG",
+			proto.Error(errWrongNumber("debug")),
+		)
+
+		// refused when it's queued
+		mustOK(t, c, "MULTI")
+		mustContain(t, c,
+			"DEBUG", "PROTOCOL", "string",
+			"DEBUG command not allowed",
+		)
+		mustContain(t, c, "EXEC", "EXECABORT")
+	})
+
+	s.EnableDebugCommand()
+
+	t.Run("errors", func(t *testing.T) {
+		mustDo(t, c,
+			"DEBUG", "NOSUCH",
+			proto.Error("ERR unknown subcommand or wrong number of arguments for 'NOSUCH'. Try DEBUG HELP."),
+		)
+		mustDo(t, c,
+			"DEBUG", "PROTOCOL",
+			proto.Error("ERR unknown subcommand or wrong number of arguments for 'PROTOCOL'. Try DEBUG HELP."),
+		)
+		mustContain(t, c,
+			"DEBUG", "PROTOCOL", "nosuch",
+			"Wrong protocol type name",
+		)
+		mustContain(t, c,
+			"EVAL", `return redis.call("DEBUG", "SLEEP", "0")`, "0",
+			"This Redis command is not allowed from script",
+		)
+	})
+}
+
+func TestDebugProtocol(t *testing.T) {
+	s, c := runWithClient(t)
+	s.EnableDebugCommand()
+
+	t.Run("RESP2", func(t *testing.T) {
+		mustDo(t, c, "DEBUG", "PROTOCOL", "string", proto.String("Hello World"))
+		mustDo(t, c, "DEBUG", "PROTOCOL", "integer", proto.Int(12345))
+		mustDo(t, c, "DEBUG", "PROTOCOL", "double", proto.String("3.141"))
+		mustDo(t, c, "DEBUG", "PROTOCOL", "bignum", proto.String("1234567999999999999999999999999999999"))
+		mustNil(t, c, "DEBUG", "PROTOCOL", "null")
+		mustDo(t, c, "DEBUG", "PROTOCOL", "array", proto.Ints(0, 1, 2))
+		mustDo(t, c, "DEBUG", "PROTOCOL", "set", proto.Ints(0, 1, 2))
+		mustDo(t, c, "DEBUG", "PROTOCOL", "map", proto.Ints(0, 0, 1, 1, 2, 0))
+		mustDo(t, c, "DEBUG", "PROTOCOL", "attrib", proto.String("Some real reply following the attribute"))
+		mustDo(t, c, "DEBUG", "PROTOCOL", "push", proto.Error("ERR RESP2 is not supported by this command"))
+		mustDo(t, c, "DEBUG", "PROTOCOL", "verbatim", proto.String("This is a verbatim\nstring"))
+		must1(t, c, "DEBUG", "PROTOCOL", "true")
+		must0(t, c, "DEBUG", "PROTOCOL", "false")
+	})
+
+	t.Run("RESP3", func(t *testing.T) {
+		useRESP3(t, c)
+		mustDo(t, c, "DEBUG", "PROTOCOL", "double", proto.Float(3.141))
+		mustDo(t, c, "DEBUG", "PROTOCOL", "bignum", proto.BigNumber("1234567999999999999999999999999999999"))
+		mustDo(t, c, "DEBUG", "PROTOCOL", "null", proto.NilResp3)
+		mustDo(t, c, "DEBUG", "PROTOCOL", "set", proto.Set(proto.Int(0), proto.Int(1), proto.Int(2)))
+		mustDo(t, c, "DEBUG", "PROTOCOL", "map",
+			proto.Map(
+				proto.Int(0), proto.Bool(false),
+				proto.Int(1), proto.Bool(true),
+				proto.Int(2), proto.Bool(false),
+			),
+		)
+		mustDo(t, c, "DEBUG", "PROTOCOL", "attrib",
+			proto.Attribute(
+				proto.String("Some real reply following the attribute"),
+				proto.String("key-popularity"),
+				proto.Array(proto.String("key:123"), proto.Int(90)),
+			),
+		)
+		var pushed []proto.Value
+		c.OnPush(func(v proto.Value) { pushed = append(pushed, v) })
+		mustDo(t, c, "DEBUG", "PROTOCOL", "push",
+			proto.String("Some real reply following the push reply"),
+		)
+		c.OnPush(nil)
+		equals(t, 1, len(pushed))
+		equals(t, proto.KindPush, pushed[0].Kind)
+		equals(t, "server-cpu-usage", pushed[0].Array[0].Str)
+		equals(t, 42, pushed[0].Array[1].Int)
+		mustDo(t, c, "DEBUG", "PROTOCOL", "verbatim", proto.Verbatim("This is a verbatim\nstring"))
+		mustDo(t, c, "DEBUG", "PROTOCOL", "true", proto.Bool(true))
+		mustDo(t, c, "DEBUG", "PROTOCOL", "false", proto.Bool(false))
+	})
+}
+
+func TestDebugSleep(t *testing.T) {
+	s, c := runWithClient(t)
+	s.EnableDebugCommand()
+
+	start := time.Now()
+	mustOK(t, c, "DEBUG", "SLEEP", "0.1")
+	assert(t, time.Since(start) >= 100*time.Millisecond, "slept")
+
+	// other clients wait
+	c2, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c2.Close()
+	ok(t, c.Send("DEBUG", "SLEEP", "0.2"))
+	ok(t, c.Flush())
+	time.Sleep(20 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = c2.DoContext(ctx, "PING")
+	equals(t, context.DeadlineExceeded, err)
+	mustRead(t, c, proto.Inline("OK"))
+
+	mustOK(t, c, "DEBUG", "SLEEP", "0")
+	mustOK(t, c, "DEBUG", "SLEEP", "foo")
+}
+
+func TestDebugObject(t *testing.T) {
+	s, c := runWithClient(t)
+	s.EnableDebugCommand()
+
+	encoding := func(t *testing.T, key, want string) {
+		t.Helper()
+		res, err := c.Do("DEBUG", "OBJECT", key)
+		ok(t, err)
+		assert(t, strings.Contains(res, " encoding:"+want+" "), "encoding %q in %q", want, res)
+	}
+
+	s.Set("int", "12345")
+	encoding(t, "int", "int")
+	s.Set("short", "hello")
+	encoding(t, "short", "embstr")
+	s.Set("long", strings.Repeat("a", 45))
+	encoding(t, "long", "raw")
+	s.Set("zero", "0123")
+	encoding(t, "zero", "embstr")
+
+	s.HSet("hash", "f", "v")
+	encoding(t, "hash", "listpack")
+	s.HSet("bighash", "f", strings.Repeat("v", 65))
+	encoding(t, "bighash", "hashtable")
+
+	s.Push("list", "a", "b")
+	encoding(t, "list", "listpack")
+	s.Push("biglist", strings.Repeat("a", 5000), strings.Repeat("b", 5000))
+	encoding(t, "biglist", "quicklist")
+	mustContain(t, c, "DEBUG", "OBJECT", "biglist", " ql_nodes:2 ")
+
+	s.SetAdd("ints", "1", "2")
+	encoding(t, "ints", "intset")
+	s.SetAdd("strs", "a", "b")
+	encoding(t, "strs", "listpack")
+
+	s.ZAdd("zset", 1, "a")
+	encoding(t, "zset", "listpack")
+	s.ZAdd("bigzset", 1, strings.Repeat("a", 65))
+	encoding(t, "bigzset", "skiplist")
+
+	mustDo(t, c, "XADD", "stream", "1-1", "f", "v", proto.String("1-1"))
+	encoding(t, "stream", "stream")
+
+	mustContain(t, c,
+		"DEBUG", "OBJECT", "short",
+		" refcount:1 encoding:embstr serializedlength:6 lru:"+lruClock(s.effectiveNow())+" lru_seconds_idle:0",
+	)
+
+	mustDo(t, c,
+		"DEBUG", "OBJECT", "nosuch",
+		proto.Error(msgKeyNotFound),
+	)
+
+	t.Run("packed threshold", func(t *testing.T) {
+		mustOK(t, c, "DEBUG", "QUICKLIST-PACKED-THRESHOLD", "10b")
+		s.Push("plain", strings.Repeat("a", 20))
+		encoding(t, "plain", "quicklist")
+
+		mustOK(t, c, "DEBUG", "QUICKLIST-PACKED-THRESHOLD", "1gb")
+		encoding(t, "plain", "listpack")
+
+		mustContain(t, c,
+			"DEBUG", "QUICKLIST-PACKED-THRESHOLD", "1",
+			"argument must be a memory value",
+		)
+		mustContain(t, c,
+			"DEBUG", "QUICKLIST-PACKED-THRESHOLD", "5gb",
+			"argument must be a memory value",
+		)
+		mustContain(t, c,
+			"DEBUG", "QUICKLIST-PACKED-THRESHOLD", "foo",
+			"argument must be a memory value",
+		)
+	})
+}
+
+func lruClock(t time.Time) string {
+	return strconv.Itoa(int(t.Unix() & (1<<24 - 1)))
+}
+
+func TestDebugSetActiveExpire(t *testing.T) {
+	s, c := runWithClient(t)
+	s.EnableDebugCommand()
+
+	mustOK(t, c, "DEBUG", "SET-ACTIVE-EXPIRE", "1")
+	mustOK(t, c, "SET", "foo", "bar", "PX", "10")
+	time.Sleep(50 * time.Millisecond)
+	must0(t, c, "EXISTS", "foo")
+
+	mustOK(t, c, "DEBUG", "SET-ACTIVE-EXPIRE", "0")
+	mustOK(t, c, "SET", "foo", "bar", "PX", "10")
+	time.Sleep(50 * time.Millisecond)
+	must1(t, c, "EXISTS", "foo")
+}
+
+func TestDebugReload(t *testing.T) {
+	s, c := runWithClient(t)
+	s.EnableDebugCommand()
+
+	mustDo(t, c,
+		"DEBUG", "RELOAD", "NOSAVE",
+		proto.Error("ERR Error trying to load the RDB dump, check server logs."),
+	)
+
+	s.Set("foo", "bar")
+	s.SetTTL("foo", time.Minute)
+	s.HSet("hash", "f", "v")
+	s.Select(2)
+	s.Set("two", "2")
+	s.Select(0)
+
+	mustOK(t, c, "DEBUG", "RELOAD")
+	equals(t, "bar", s.DB(0).stringKeys["foo"])
+	equals(t, time.Minute, s.TTL("foo"))
+	s.CheckGet(t, "foo", "bar")
+	s.Select(2)
+	s.CheckGet(t, "two", "2")
+	s.Select(0)
+
+	// NOSAVE loads the previous dump
+	s.Set("foo", "changed")
+	s.Set("new", "new")
+	mustOK(t, c, "DEBUG", "RELOAD", "NOSAVE")
+	s.CheckGet(t, "foo", "bar")
+	equals(t, false, s.Exists("new"))
+
+	// duplicate keys
+	mustDo(t, c,
+		"DEBUG", "RELOAD", "NOFLUSH",
+		proto.Error("ERR Error trying to load the RDB dump, check server logs."),
+	)
+	s.Set("foo", "changed")
+	s.Set("new", "new")
+	mustOK(t, c, "DEBUG", "RELOAD", "NOSAVE", "NOFLUSH", "MERGE")
+	s.CheckGet(t, "foo", "bar")
+	s.CheckGet(t, "new", "new")
+
+	mustDo(t, c,
+		"DEBUG", "RELOAD", "foo",
+		proto.Error("ERR DEBUG RELOAD only supports the MERGE, NOFLUSH and NOSAVE options."),
+	)
+
+	mustOK(t, c, "DEBUG", "CHANGE-REPL-ID")
+	mustOK(t, c, "DEBUG", "JMAP")
+}
@@ -0,0 +1,880 @@
+// Commands from https://redis.io/commands#scripting
+
+package miniredis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+const (
+	msgFunctionNotFound    = "ERR Function not found"
+	msgLibraryNotFound     = "ERR Library not found"
+	msgMissingMetadata     = "ERR Missing library metadata"
+	msgNoLibraryName       = "ERR Library name was not given"
+	msgInvalidLibraryName  = "ERR Library names can only contain letters, numbers, or underscores(_) and must be at least one character long"
+	msgInvalidFunctionName = "Function names can only contain letters, numbers, or underscores(_) and must be at least one character long"
+	msgNoFunctions         = "ERR No functions registered"
+	msgFunctionWriteRO     = "ERR Can not execute a script with write flag using *_ro command."
+	msgFunctionFlush       = "ERR FUNCTION FLUSH only supports SYNC|ASYNC option"
+	msgRestorePolicy       = "ERR Wrong restore policy given, value should be either FLUSH, APPEND or REPLACE."
+	msgRestorePayload      = "ERR payload version or checksum are wrong"
+	msgRegisterNotLoading  = "redis.register_function can only be called on FUNCTION LOAD command"
+)
+
+// functionDumpVersion is the version of the FUNCTION DUMP payload.
+const functionDumpVersion = 1
+
+var (
+	validFunctionName = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+	luaPosition       = regexp.MustCompile(`^[^ ]*:[0-9]+: `) // "<string>:3: "
+	crcTable          = crc64.MakeTable(crc64.ECMA)
+)
+
+// functionFlags are the flags redis.register_function() and "#!lua flags="
+// shebangs accept.
+var functionFlags = map[string]bool{
+	"no-writes":             true,
+	"allow-oom":             true,
+	"allow-stale":           true,
+	"no-cluster":            true,
+	"allow-cross-slot-keys": true,
+}
+
+// luaLibrary is a library loaded with FUNCTION LOAD. The library code runs
+// once, and every FCALL uses the same Lua state, as in Redis.
+type luaLibrary struct {
+	name      string
+	code      string // as given to FUNCTION LOAD
+	body      string // the code without the shebang line
+	functions map[string]*luaFunction
+	state     *lua.LState
+	callbacks map[string]*lua.LFunction // the registered functions, from state
+	hooked    bool                      // state runs with line hooks, for coverage
+	lines     []int                     // the lines with a statement, if hooked
+}
+
+// luaFunction is a function registered by a library.
+type luaFunction struct {
+	name  string
+	desc  string
+	flags []string
+	lib   *luaLibrary
+}
+
+func (f *luaFunction) noWrites() bool {
+	return hasFlag(f.flags, "no-writes")
+}
+
+func commandsFunctions(m *Miniredis) {
+	m.srv.Register("FCALL", m.cmdFcall, server.WriteOption())
+	m.srv.Register("FCALL_RO", m.cmdFcallRo, server.ReadOnlyOption())
+	m.srv.Register("FUNCTION", m.cmdFunction, server.WriteSubcommandsOption("LOAD", "DELETE", "FLUSH", "RESTORE"))
+}
+
+// FCALL
+func (m *Miniredis) cmdFcall(c *server.Peer, cmd string, args []string) {
+	m.cmdFcallShared(c, cmd, false, args)
+}
+
+// FCALL_RO
+func (m *Miniredis) cmdFcallRo(c *server.Peer, cmd string, args []string) {
+	m.cmdFcallShared(c, cmd, true, args)
+}
+
+// Shared implementation for FCALL and FCALL_RO
+func (m *Miniredis) cmdFcallShared(c *server.Peer, cmd string, readOnly bool, args []string) {
+	if !m.isValidCMD(c, cmd, args, atLeast(2)) {
+		return
+	}
+
+	ctx := getCtx(c)
+	if ctx.nested {
+		c.WriteError(msgNotFromScripts(ctx.nestedSHA))
+		return
+	}
+
+	name, args := args[0], args[1:]
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		f := m.findFunction(name)
+		if f == nil {
+			c.WriteError(msgFunctionNotFound)
+			return
+		}
+		if msg := m.scriptFlagsError(f.flags, readOnly); msg != "" {
+			c.WriteError(msg)
+			return
+		}
+		m.runLuaFunction(c, cmd, f, readOnly || f.noWrites(), args)
+	})
+}
+
+// FUNCTION
+func (m *Miniredis) cmdFunction(c *server.Peer, cmd string, args []string) {
+	if !m.isValidCMD(c, cmd, args, atLeast(1)) {
+		return
+	}
+
+	ctx := getCtx(c)
+	if ctx.nested {
+		c.WriteError(msgNotFromScripts(ctx.nestedSHA))
+		return
+	}
+
+	subcmd, args := strings.ToUpper(args[0]), args[1:]
+	switch subcmd {
+	case "LOAD":
+		m.cmdFunctionLoad(c, args)
+	case "LIST":
+		m.cmdFunctionList(c, args)
+	case "DELETE":
+		m.cmdFunctionDelete(c, args)
+	case "FLUSH":
+		m.cmdFunctionFlush(c, args)
+	case "DUMP":
+		m.cmdFunctionDump(c, args)
+	case "RESTORE":
+		m.cmdFunctionRestore(c, args)
+	case "STATS":
+		m.cmdFunctionStats(c, args)
+	case "KILL":
+		m.cmdFunctionKill(c, args)
+	default:
+		setDirty(c)
+		c.WriteError(fmt.Sprintf("ERR unknown subcommand '%s'. Try FUNCTION HELP.", subcmd))
+	}
+}
+
+// FUNCTION LOAD [REPLACE] code
+func (m *Miniredis) cmdFunctionLoad(c *server.Peer, args []string) {
+	if len(args) == 0 || len(args) > 2 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("function|load"))
+		return
+	}
+	replace := false
+	if len(args) == 2 {
+		if !strings.EqualFold(args[0], "REPLACE") {
+			setDirty(c)
+			c.WriteError(fmt.Sprintf("ERR Unknown option given: %s", args[0]))
+			return
+		}
+		replace = true
+	}
+	code := args[len(args)-1]
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		lib, err := parseLibrary(code, m.cover)
+		if err != nil {
+			c.WriteError(err.Error())
+			return
+		}
+		libs := copyLibraries(m.libraries)
+		if err := addLibrary(libs, lib, replace); err != nil {
+			lib.state.Close()
+			c.WriteError(err.Error())
+			return
+		}
+		m.setLibraries(libs)
+		c.WriteBulk(lib.name)
+	})
+}
+
+// FUNCTION LIST [LIBRARYNAME pattern] [WITHCODE]
+func (m *Miniredis) cmdFunctionList(c *server.Peer, args []string) {
+	var opts struct {
+		pattern     string
+		withPattern bool
+		withCode    bool
+	}
+	for len(args) > 0 {
+		switch strings.ToUpper(args[0]) {
+		case "LIBRARYNAME":
+			if opts.withPattern {
+				setDirty(c)
+				c.WriteError("ERR library name can be given once")
+				return
+			}
+			if len(args) < 2 {
+				setDirty(c)
+				c.WriteError("ERR library name argument was not given")
+				return
+			}
+			opts.pattern, opts.withPattern = args[1], true
+			args = args[2:]
+		case "WITHCODE":
+			opts.withCode = true
+			args = args[1:]
+		default:
+			setDirty(c)
+			c.WriteError(fmt.Sprintf("ERR Unknown argument %s", args[0]))
+			return
+		}
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		var re *regexp.Regexp
+		if opts.withPattern {
+			re = patternRE(opts.pattern)
+		}
+		var libs []*luaLibrary
+		for _, lib := range sortedLibraries(m.libraries) {
+			if opts.withPattern && (re == nil || !re.MatchString(lib.name)) {
+				continue
+			}
+			libs = append(libs, lib)
+		}
+
+		c.WriteLen(len(libs))
+		for _, lib := range libs {
+			if opts.withCode {
+				c.WriteMapLen(4)
+			} else {
+				c.WriteMapLen(3)
+			}
+			c.WriteBulk("library_name")
+			c.WriteBulk(lib.name)
+			c.WriteBulk("engine")
+			c.WriteBulk("LUA")
+			c.WriteBulk("functions")
+			c.WriteLen(len(lib.functions))
+			for _, f := range sortedFunctions(lib) {
+				c.WriteMapLen(3)
+				c.WriteBulk("name")
+				c.WriteBulk(f.name)
+				c.WriteBulk("description")
+				if f.desc == "" {
+					c.WriteNull()
+				} else {
+					c.WriteBulk(f.desc)
+				}
+				c.WriteBulk("flags")
+				c.WriteSetLen(len(f.flags))
+				for _, fl := range f.flags {
+					c.WriteBulk(fl)
+				}
+			}
+			if opts.withCode {
+				c.WriteBulk("library_code")
+				c.WriteBulk(lib.code)
+			}
+		}
+	})
+}
+
+// FUNCTION DELETE library
+func (m *Miniredis) cmdFunctionDelete(c *server.Peer, args []string) {
+	if len(args) != 1 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("function|delete"))
+		return
+	}
+	name := args[0]
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		if _, ok := m.libraries[name]; !ok {
+			c.WriteError(msgLibraryNotFound)
+			return
+		}
+		libs := copyLibraries(m.libraries)
+		delete(libs, name)
+		m.setLibraries(libs)
+		c.WriteOK()
+	})
+}
+
+// FUNCTION FLUSH [ASYNC|SYNC]
+func (m *Miniredis) cmdFunctionFlush(c *server.Peer, args []string) {
+	if len(args) == 1 {
+		switch strings.ToUpper(args[0]) {
+		case "SYNC", "ASYNC":
+			args = args[1:]
+		default:
+		}
+	}
+	if len(args) != 0 {
+		setDirty(c)
+		c.WriteError(msgFunctionFlush)
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		m.setLibraries(map[string]*luaLibrary{})
+		c.WriteOK()
+	})
+}
+
+// FUNCTION DUMP
+func (m *Miniredis) cmdFunctionDump(c *server.Peer, args []string) {
+	if len(args) != 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("function|dump"))
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		c.WriteBulk(dumpLibraries(sortedLibraries(m.libraries)))
+	})
+}
+
+// FUNCTION RESTORE payload [FLUSH|APPEND|REPLACE]
+func (m *Miniredis) cmdFunctionRestore(c *server.Peer, args []string) {
+	if len(args) == 0 || len(args) > 2 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("function|restore"))
+		return
+	}
+	payload, policy := args[0], "APPEND"
+	if len(args) == 2 {
+		policy = strings.ToUpper(args[1])
+		switch policy {
+		case "FLUSH", "APPEND", "REPLACE":
+		default:
+			setDirty(c)
+			c.WriteError(msgRestorePolicy)
+			return
+		}
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		codes, ok := undumpLibraries(payload)
+		if !ok {
+			c.WriteError(msgRestorePayload)
+			return
+		}
+		libs := copyLibraries(m.libraries)
+		if policy == "FLUSH" {
+			libs = map[string]*luaLibrary{}
+		}
+		for _, code := range codes {
+			lib, err := parseLibrary(code, m.cover)
+			if err != nil {
+				c.WriteError(err.Error())
+				return
+			}
+			if err := addLibrary(libs, lib, policy == "REPLACE"); err != nil {
+				lib.state.Close()
+				c.WriteError(err.Error())
+				return
+			}
+		}
+		m.setLibraries(libs)
+		c.WriteOK()
+	})
+}
+
+// FUNCTION STATS
+func (m *Miniredis) cmdFunctionStats(c *server.Peer, args []string) {
+	if len(args) != 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("function|stats"))
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		// a running function is handled by functionStats()
+		writeFunctionStats(c, m.libraries, nil, 0)
+	})
+}
+
+// writeFunctionStats writes the FUNCTION STATS reply. fn is the running
+// function, if any, which runs for d.
+func writeFunctionStats(c *server.Peer, libs map[string]*luaLibrary, fn *runningFunction, d time.Duration) {
+	n := 0
+	for _, lib := range libs {
+		n += len(lib.functions)
+	}
+	c.WriteMapLen(2)
+	c.WriteBulk("running_script")
+	if fn == nil {
+		c.WriteNull()
+	} else {
+		c.WriteMapLen(3)
+		c.WriteBulk("name")
+		c.WriteBulk(fn.name)
+		c.WriteBulk("command")
+		c.WriteStrings(fn.cmd)
+		c.WriteBulk("duration_ms")
+		c.WriteInt(int(d.Milliseconds()))
+	}
+	c.WriteBulk("engines")
+	c.WriteMapLen(1)
+	c.WriteBulk("LUA")
+	c.WriteMapLen(2)
+	c.WriteBulk("libraries_count")
+	c.WriteInt(len(libs))
+	c.WriteBulk("functions_count")
+	c.WriteInt(n)
+}
+
+// FUNCTION KILL
+func (m *Miniredis) cmdFunctionKill(c *server.Peer, args []string) {
+	if len(args) != 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("function|kill"))
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		// a running function is handled by scriptKill()
+		c.WriteError(msgNotBusy)
+	})
+}
+
+// findFunction finds a function in any library, or nil.
+func (m *Miniredis) findFunction(name string) *luaFunction {
+	for _, lib := range m.libraries {
+		if f, ok := lib.functions[name]; ok {
+			return f
+		}
+	}
+	return nil
+}
+
+// Execute a function. Needs to run m.Lock()ed, from within withTx().
+func (m *Miniredis) runLuaFunction(c *server.Peer, cmd string, f *luaFunction, readOnly bool, args []string) {
+	fn := &runningFunction{
+		name: f.name,
+		cmd:  append([]string{cmd, f.name}, args...),
+		libs: m.libraries,
+	}
+	keys, args, ok := splitKeys(c, args)
+	if !ok {
+		return
+	}
+
+	lib := f.lib
+	if m.cover != nil && !lib.hooked {
+		// coverage was enabled after the library was loaded
+		if err := m.reloadLibrary(lib); err != nil {
+			c.WriteError(err.Error())
+			return
+		}
+	}
+	var slot *scriptSlot
+	if !hasFlag(f.flags, "allow-cross-slot-keys") && m.inCluster() {
+		slot = newScriptSlot(keys)
+	}
+	var trace *ScriptTrace
+	if m.cover != nil {
+		trace = m.cover.trace(cmd, f.name)
+		setLineHook(lib.state, m.cover.hook(lib.name, lib.code, lib.lines))
+	}
+	cb, ok := lib.callbacks[f.name]
+	if !ok {
+		c.WriteError(msgFunctionNotFound)
+		return
+	}
+
+	// the redis.* functions are for this call only
+	l := lib.state
+	l.SetTop(0)
+	redisFuncs, _ := mkLua(m.srv, c, f.name, readOnly, slot, &m.script, trace)
+	redisMod := l.GetGlobal("redis").(*lua.LTable)
+	for name, rf := range redisFuncs {
+		redisMod.RawSetString(name, l.NewFunction(rf))
+	}
+	redisMod.RawSetString("register_function", l.NewFunction(func(l *lua.LState) int {
+		l.RaiseError(msgRegisterNotLoading)
+		return 0
+	}))
+
+	// lua can call redis.setresp(...), but it's tmp state.
+	oldresp := c.Resp3
+	defer func() {
+		c.Resp3 = oldresp
+		c.SwitchResp3 = nil
+	}()
+	l.SetContext(m.script.begin(fn))
+	err := l.CallByParam(lua.P{
+		Fn:      cb,
+		NRet:    1,
+		Protect: true,
+	}, luaStrings(l, keys), luaStrings(l, args))
+	l.RemoveContext()
+	if err != nil {
+		err = errors.New(errLuaRuntime(err))
+	}
+	if m.script.end() {
+		c.WriteError(msgFunctionKilled)
+		return
+	}
+	if err != nil {
+		c.WriteError(err.Error())
+		return
+	}
+
+	luaToRedis(l, c, l.Get(-1))
+	l.Pop(1)
+}
+
+// reloadLibrary runs the code of a library again, in a new Lua state with line
+// hooks.
+func (m *Miniredis) reloadLibrary(lib *luaLibrary) error {
+	nlib, err := parseLibrary(lib.code, m.cover)
+	if err != nil {
+		return err
+	}
+	lib.state.Close()
+	lib.state, lib.callbacks, lib.hooked, lib.lines = nlib.state, nlib.callbacks, nlib.hooked, nlib.lines
+	return nil
+}
+
+// setLibraries replaces m.libraries, and closes the Lua state of every library
+// which is gone. No locks!
+func (m *Miniredis) setLibraries(libs map[string]*luaLibrary) {
+	for name, lib := range m.libraries {
+		if libs[name] != lib {
+			lib.state.Close()
+		}
+	}
+	m.libraries = libs
+}
+
+// parseLibrary checks the code of a library, and runs it to find its
+// functions. With cover the library runs with line hooks.
+func parseLibrary(code string, cover *scriptCover) (*luaLibrary, error) {
+	name, body, err := parseShebang(code)
+	if err != nil {
+		return nil, err
+	}
+	lib := &luaLibrary{
+		name:      name,
+		code:      code,
+		body:      body,
+		functions: map[string]*luaFunction{},
+	}
+
+	// While loading only register_function() and log() are available.
+	callbacks := map[string]*lua.LFunction{}
+	redisFuncs := map[string]lua.LGFunction{
+		"register_function": registerFunction(lib.functions, callbacks),
+		"log": func(l *lua.LState) int {
+			return 0
+		},
+	}
+	l := newLua(redisFuncs, luaRedisConstants)
+	_ = doScript(l, protectGlobals)
+
+	if cover != nil {
+		err = runCoveredLibrary(l, cover, lib)
+	} else {
+		err = runLibrary(l, body)
+	}
+	if err == nil && len(lib.functions) == 0 {
+		err = fmt.Errorf(msgNoFunctions)
+	}
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	for _, f := range lib.functions {
+		f.lib = lib
+	}
+	lib.state = l
+	lib.callbacks = callbacks
+	return lib, nil
+}
+
+// parseShebang parses the "#!lua name=mylib" first line of a library. Returns
+// the library name and the code without the shebang.
+func parseShebang(code string) (string, string, error) {
+	if !strings.HasPrefix(code, "#!") {
+		return "", "", fmt.Errorf(msgMissingMetadata)
+	}
+	line, body := code, ""
+	if i := strings.IndexByte(code, '\n'); i >= 0 {
+		// keep the newline, so line numbers in errors are right
+		line, body = code[:i], code[i:]
+	}
+	parts := strings.Fields(line[2:])
+	if len(parts) == 0 || !strings.EqualFold(parts[0], "lua") {
+		engine := ""
+		if len(parts) > 0 {
+			engine = parts[0]
+		}
+		return "", "", fmt.Errorf("ERR Engine '%s' not found", engine)
+	}
+	name := ""
+	for _, p := range parts[1:] {
+		if !strings.HasPrefix(p, "name=") {
+			return "", "", fmt.Errorf("ERR Invalid metadata value given: %s", p)
+		}
+		name = p[len("name="):]
+	}
+	if name == "" {
+		return "", "", fmt.Errorf(msgNoLibraryName)
+	}
+	if !validFunctionName.MatchString(name) {
+		return "", "", fmt.Errorf(msgInvalidLibraryName)
+	}
+	return name, body, nil
+}
+
+// runLibrary runs the code of a library, which registers its functions.
+func runLibrary(l *lua.LState, body string) error {
+	proto, err := compile(body)
+	if err != nil {
+		return fmt.Errorf("ERR Error compiling function: %s", err.Error())
+	}
+	return runLibraryProto(l, proto)
+}
+
+// runCoveredLibrary is runLibrary(), but counts the lines which run.
+func runCoveredLibrary(l *lua.LState, cover *scriptCover, lib *luaLibrary) error {
+	hs, err := compileHooked(lib.body)
+	if err != nil {
+		return fmt.Errorf("ERR Error compiling function: %s", err.Error())
+	}
+	setLineHook(l, cover.hook(lib.name, lib.code, hs.lines))
+	lib.hooked, lib.lines = true, hs.lines
+	return runLibraryProto(l, hs.proto)
+}
+
+// runLibraryProto runs the compiled code of a library.
+func runLibraryProto(l *lua.LState, proto *lua.FunctionProto) error {
+	l.Push(l.NewFunctionFromProto(proto))
+	if err := l.PCall(0, 0, nil); err != nil {
+		return fmt.Errorf("ERR Error registering functions: %s", luaErrorMsg(err))
+	}
+	return nil
+}
+
+// registerFunction is redis.register_function(). It adds the functions to
+// fns, and their callbacks to callbacks. Both forms are supported:
+//
+//	redis.register_function('name', callback)
+//	redis.register_function{function_name='name', callback=callback, flags={'no-writes'}, description='...'}
+func registerFunction(fns map[string]*luaFunction, callbacks map[string]*lua.LFunction) lua.LGFunction {
+	return func(l *lua.LState) int {
+		var (
+			f  = &luaFunction{}
+			cb *lua.LFunction
+		)
+		switch l.GetTop() {
+		case 1:
+			t, ok := l.Get(1).(*lua.LTable)
+			if !ok {
+				l.RaiseError("calling redis.register_function with a single argument is only applicable to Lua table (representing named arguments).")
+				return 0
+			}
+			var err string
+			t.ForEach(func(k, v lua.LValue) {
+				if err != "" {
+					return
+				}
+				switch lua.LVAsString(k) {
+				case "function_name":
+					s, ok := v.(lua.LString)
+					if !ok {
+						err = "function_name argument given to redis.register_function must be a string"
+						return
+					}
+					f.name = string(s)
+				case "callback":
+					fn, ok := v.(*lua.LFunction)
+					if !ok {
+						err = "callback argument given to redis.register_function must be a function"
+						return
+					}
+					cb = fn
+				case "description":
+					s, ok := v.(lua.LString)
+					if !ok {
+						err = "description argument given to redis.register_function must be a string"
+						return
+					}
+					f.desc = string(s)
+				case "flags":
+					ft, ok := v.(*lua.LTable)
+					if !ok {
+						err = "flags argument to redis.register_function must be a table representing function flags"
+						return
+					}
+					ft.ForEach(func(_, fl lua.LValue) {
+						if !functionFlags[lua.LVAsString(fl)] {
+							err = "unknown flag given"
+							return
+						}
+						f.flags = append(f.flags, lua.LVAsString(fl))
+					})
+				default:
+					err = "unknown argument given to redis.register_function"
+				}
+			})
+			if err != "" {
+				l.RaiseError(err)
+				return 0
+			}
+			if f.name == "" {
+				l.RaiseError("redis.register_function must get a function name argument")
+				return 0
+			}
+			if cb == nil {
+				l.RaiseError("redis.register_function must get a callback argument")
+				return 0
+			}
+		case 2:
+			s, ok := l.Get(1).(lua.LString)
+			if !ok {
+				l.RaiseError("function_name argument given to redis.register_function must be a string")
+				return 0
+			}
+			f.name = string(s)
+			fn, ok := l.Get(2).(*lua.LFunction)
+			if !ok {
+				l.RaiseError("callback argument given to redis.register_function must be a function")
+				return 0
+			}
+			cb = fn
+		default:
+			l.RaiseError("wrong number of arguments to redis.register_function")
+			return 0
+		}
+
+		if !validFunctionName.MatchString(f.name) {
+			l.RaiseError(msgInvalidFunctionName)
+			return 0
+		}
+		if _, ok := fns[f.name]; ok {
+			l.RaiseError("Function already exists in the library")
+			return 0
+		}
+		fns[f.name] = f
+		callbacks[f.name] = cb
+		return 0
+	}
+}
+
+// addLibrary adds a library to libs, unless that gives a conflict.
+func addLibrary(libs map[string]*luaLibrary, lib *luaLibrary, replace bool) error {
+	if _, ok := libs[lib.name]; ok && !replace {
+		return fmt.Errorf("ERR Library '%s' already exists", lib.name)
+	}
+	for _, other := range libs {
+		if other.name == lib.name {
+			continue
+		}
+		for name := range lib.functions {
+			if _, ok := other.functions[name]; ok {
+				return fmt.Errorf("ERR Function %s already exists", name)
+			}
+		}
+	}
+	libs[lib.name] = lib
+	return nil
+}
+
+func copyLibraries(libs map[string]*luaLibrary) map[string]*luaLibrary {
+	cp := make(map[string]*luaLibrary, len(libs))
+	for k, v := range libs {
+		cp[k] = v
+	}
+	return cp
+}
+
+func sortedLibraries(libs map[string]*luaLibrary) []*luaLibrary {
+	var res []*luaLibrary
+	for _, lib := range libs {
+		res = append(res, lib)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].name < res[j].name })
+	return res
+}
+
+func sortedFunctions(lib *luaLibrary) []*luaFunction {
+	var res []*luaFunction
+	for _, f := range lib.functions {
+		res = append(res, f)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].name < res[j].name })
+	return res
+}
+
+// dumpLibraries makes the FUNCTION DUMP payload: the code of every library,
+// prefixed with its length, followed by a version and a checksum.
+func dumpLibraries(libs []*luaLibrary) string {
+	var (
+		buf = &bytes.Buffer{}
+		tmp = make([]byte, binary.MaxVarintLen64)
+	)
+	for _, lib := range libs {
+		n := binary.PutUvarint(tmp, uint64(len(lib.code)))
+		buf.Write(tmp[:n])
+		buf.WriteString(lib.code)
+	}
+	binary.Write(buf, binary.LittleEndian, uint16(functionDumpVersion))
+	binary.Write(buf, binary.LittleEndian, crc64.Checksum(buf.Bytes(), crcTable))
+	return buf.String()
+}
+
+// undumpLibraries is the reverse of dumpLibraries().
+func undumpLibraries(payload string) ([]string, bool) {
+	b := []byte(payload)
+	if len(b) < 10 {
+		return nil, false
+	}
+	body, footer := b[:len(b)-10], b[len(b)-10:]
+	if binary.LittleEndian.Uint16(footer) != functionDumpVersion {
+		return nil, false
+	}
+	if binary.LittleEndian.Uint64(footer[2:]) != crc64.Checksum(b[:len(b)-8], crcTable) {
+		return nil, false
+	}
+	var codes []string
+	for len(body) > 0 {
+		l, n := binary.Uvarint(body)
+		if n <= 0 || uint64(len(body)-n) < l {
+			return nil, false
+		}
+		codes = append(codes, string(body[n:n+int(l)]))
+		body = body[n+int(l):]
+	}
+	return codes, true
+}
+
+// luaStrings makes a Lua table with strings.
+func luaStrings(l *lua.LState, strs []string) *lua.LTable {
+	t := l.CreateTable(len(strs), 0)
+	for i, s := range strs {
+		l.RawSet(t, lua.LNumber(i+1), lua.LString(s))
+	}
+	return t
+}
+
+// luaErrorMsg is the message of a Lua error, without the stack trace.
+func luaErrorMsg(err error) string {
+	if e, ok := err.(*lua.ApiError); ok {
+		return e.Object.String()
+	}
+	return err.Error()
+}
+
+// errLuaRuntime is the reply for an error while running a function. Errors
+// from redis.call() and redis.error_reply() are returned as they are.
+func errLuaRuntime(err error) string {
+	if e, ok := err.(*lua.ApiError); ok {
+		if t, ok := e.Object.(*lua.LTable); ok {
+			if s := t.RawGetString("err"); s.Type() != lua.LTNil {
+				return s.String()
+			}
+		}
+	}
+	msg := luaPosition.ReplaceAllString(luaErrorMsg(err), "")
+	if code := strings.SplitN(msg, " ", 2)[0]; code == "" || strings.ToUpper(code) != code {
+		msg = "ERR " + msg
+	}
+	return msg
+}
@@ -0,0 +1,318 @@
+package miniredis
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2/proto"
+)
+
+const testLibrary = `#!lua name=mylib
+local function get(keys, args)
+  return redis.call('GET', keys[1])
+end
+redis.register_function('myset', function(keys, args)
+  return redis.call('SET', keys[1], args[1])
+end)
+redis.register_function{
+  function_name='myget',
+  callback=get,
+  flags={'no-writes'},
+  description='get a key',
+}
+`
+
+func TestFunction(t *testing.T) {
+	s, c := runWithClient(t)
+
+	t.Run("LOAD", func(t *testing.T) {
+		mustDo(t, c,
+			"FUNCTION", "LOAD", testLibrary,
+			proto.String("mylib"),
+		)
+		mustDo(t, c,
+			"FUNCTION", "LOAD", testLibrary,
+			proto.Error("ERR Library 'mylib' already exists"),
+		)
+		mustDo(t, c,
+			"FUNCTION", "LOAD", "REPLACE", testLibrary,
+			proto.String("mylib"),
+		)
+		mustDo(t, c,
+			"FUNCTION", "LOAD", "#!lua name=other\nredis.register_function('myget', function() return 1 end)",
+			proto.Error("ERR Function myget already exists"),
+		)
+
+		mustDo(t, c,
+			"FUNCTION", "LOAD", "return 1",
+			proto.Error(msgMissingMetadata),
+		)
+		mustDo(t, c,
+			"FUNCTION", "LOAD", "#!lua\nreturn 1",
+			proto.Error(msgNoLibraryName),
+		)
+		mustDo(t, c,
+			"FUNCTION", "LOAD", "#!js name=foo\nreturn 1",
+			proto.Error("ERR Engine 'js' not found"),
+		)
+		mustDo(t, c,
+			"FUNCTION", "LOAD", "#!lua name=foo version=2\nreturn 1",
+			proto.Error("ERR Invalid metadata value given: version=2"),
+		)
+		mustDo(t, c,
+			"FUNCTION", "LOAD", "#!lua name=foo-bar\nreturn 1",
+			proto.Error(msgInvalidLibraryName),
+		)
+		mustDo(t, c,
+			"FUNCTION", "LOAD", "#!lua name=foo\nreturn 1",
+			proto.Error(msgNoFunctions),
+		)
+		mustContain(t, c,
+			"FUNCTION", "LOAD", "#!lua name=foo\nredis.call('SET', 'foo', 'bar')",
+			"ERR Error registering functions",
+		)
+		mustContain(t, c,
+			"FUNCTION", "LOAD", "#!lua name=foo\nredis.register_function('my-func', function() end)",
+			msgInvalidFunctionName,
+		)
+		mustContain(t, c,
+			"FUNCTION", "LOAD", "#!lua name=foo\nredis.register_function{function_name='f', callback=function() end, flags={'foo'}}",
+			"unknown flag given",
+		)
+		mustDo(t, c,
+			"FUNCTION", "LOAD", "FOO", testLibrary,
+			proto.Error("ERR Unknown option given: FOO"),
+		)
+	})
+
+	t.Run("FCALL", func(t *testing.T) {
+		mustDo(t, c,
+			"FCALL", "myset", "1", "foo", "bar",
+			proto.Inline("OK"),
+		)
+		mustDo(t, c,
+			"FCALL", "myget", "1", "foo",
+			proto.String("bar"),
+		)
+		mustDo(t, c,
+			"FCALL_RO", "myget", "1", "foo",
+			proto.String("bar"),
+		)
+		mustDo(t, c,
+			"FCALL_RO", "myset", "1", "foo", "bar",
+			proto.Error(msgFunctionWriteRO),
+		)
+		mustDo(t, c,
+			"FCALL", "nosuch", "0",
+			proto.Error(msgFunctionNotFound),
+		)
+		mustDo(t, c,
+			"FCALL", "myget", "2", "foo",
+			proto.Error(msgInvalidKeysNumber),
+		)
+		mustDo(t, c,
+			"FCALL", "myget",
+			proto.Error(errWrongNumber("fcall")),
+		)
+
+		s.HSet("ahash", "f", "v")
+		mustDo(t, c,
+			"FCALL", "myget", "1", "ahash",
+			proto.Error(msgWrongType),
+		)
+	})
+
+	t.Run("no-writes", func(t *testing.T) {
+		mustDo(t, c,
+			"FUNCTION", "LOAD", "#!lua name=ro\nredis.register_function{function_name='rowrite', callback=function(keys) return redis.call('SET', keys[1], 'x') end, flags={'no-writes'}}",
+			proto.String("ro"),
+		)
+		mustContain(t, c,
+			"FCALL", "rowrite", "1", "foo",
+			"Write commands are not allowed",
+		)
+		s.CheckGet(t, "foo", "bar")
+	})
+
+	t.Run("LIST", func(t *testing.T) {
+		mustDo(t, c,
+			"FUNCTION", "LIST", "LIBRARYNAME", "my*",
+			proto.Array(
+				proto.Array(
+					proto.String("library_name"), proto.String("mylib"),
+					proto.String("engine"), proto.String("LUA"),
+					proto.String("functions"), proto.Array(
+						proto.Array(
+							proto.String("name"), proto.String("myget"),
+							proto.String("description"), proto.String("get a key"),
+							proto.String("flags"), proto.Strings("no-writes"),
+						),
+						proto.Array(
+							proto.String("name"), proto.String("myset"),
+							proto.String("description"), proto.Nil,
+							proto.String("flags"), proto.Strings(),
+						),
+					),
+				),
+			),
+		)
+		mustContain(t, c,
+			"FUNCTION", "LIST", "WITHCODE",
+			"redis.register_function('myset'",
+		)
+		mustDo(t, c,
+			"FUNCTION", "LIST", "FOO",
+			proto.Error("ERR Unknown argument FOO"),
+		)
+	})
+
+	t.Run("STATS", func(t *testing.T) {
+		mustDo(t, c,
+			"FUNCTION", "STATS",
+			proto.Array(
+				proto.String("running_script"), proto.Nil,
+				proto.String("engines"), proto.Array(
+					proto.String("LUA"), proto.Array(
+						proto.String("libraries_count"), proto.Int(2),
+						proto.String("functions_count"), proto.Int(3),
+					),
+				),
+			),
+		)
+	})
+
+	t.Run("DUMP and RESTORE", func(t *testing.T) {
+		dump, err := c.Do("FUNCTION", "DUMP")
+		ok(t, err)
+		payload, err := proto.Parse(dump)
+		ok(t, err)
+
+		mustOK(t, c, "FUNCTION", "FLUSH")
+		mustDo(t, c,
+			"FCALL", "myget", "1", "foo",
+			proto.Error(msgFunctionNotFound),
+		)
+		mustOK(t, c, "FUNCTION", "RESTORE", payload.(string))
+		mustDo(t, c,
+			"FCALL", "myget", "1", "foo",
+			proto.String("bar"),
+		)
+		mustDo(t, c,
+			"FUNCTION", "RESTORE", payload.(string),
+			proto.Error("ERR Library 'mylib' already exists"),
+		)
+		mustOK(t, c, "FUNCTION", "RESTORE", payload.(string), "REPLACE")
+		mustOK(t, c, "FUNCTION", "RESTORE", payload.(string), "FLUSH")
+		mustDo(t, c,
+			"FUNCTION", "RESTORE", payload.(string), "FOO",
+			proto.Error(msgRestorePolicy),
+		)
+		mustDo(t, c,
+			"FUNCTION", "RESTORE", "garbage",
+			proto.Error(msgRestorePayload),
+		)
+	})
+
+	t.Run("DELETE", func(t *testing.T) {
+		mustOK(t, c, "FUNCTION", "DELETE", "ro")
+		mustDo(t, c,
+			"FUNCTION", "DELETE", "ro",
+			proto.Error(msgLibraryNotFound),
+		)
+	})
+
+	t.Run("restart", func(t *testing.T) {
+		s.Close()
+		ok(t, s.Restart())
+		c2, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c2.Close()
+		mustDo(t, c2,
+			"FCALL", "myget", "1", "foo",
+			proto.String("bar"),
+		)
+	})
+}
+
+func TestFunctionState(t *testing.T) {
+	s, c := runWithClient(t)
+
+	t.Run("library state", func(t *testing.T) {
+		mustDo(t, c,
+			"FUNCTION", "LOAD", `#!lua name=counter
+local n = 0
+redis.register_function('incr', function(keys, args)
+  n = n + 1
+  return n
+end)
+redis.register_function('register', function(keys, args)
+  redis.register_function('other', function() end)
+end)`,
+			proto.String("counter"),
+		)
+		mustDo(t, c, "FCALL", "incr", "0", proto.Int(1))
+		mustDo(t, c, "FCALL", "incr", "0", proto.Int(2))
+		mustContain(t, c, "FCALL", "register", "0", msgRegisterNotLoading)
+
+		// a new library starts over
+		code, err := c.Do("FUNCTION", "DUMP")
+		ok(t, err)
+		payload, err := proto.Parse(code)
+		ok(t, err)
+		mustOK(t, c, "FUNCTION", "RESTORE", payload.(string), "REPLACE")
+		mustDo(t, c, "FCALL", "incr", "0", proto.Int(1))
+	})
+
+	t.Run("setresp", func(t *testing.T) {
+		mustDo(t, c,
+			"FUNCTION", "LOAD", `#!lua name=resp
+redis.register_function('fail', function(keys, args)
+  redis.setresp(3)
+  error('oops')
+end)`,
+			proto.String("resp"),
+		)
+		mustContain(t, c, "FCALL", "fail", "0", "oops")
+		mustNil(t, c, "GET", "nosuch")
+
+		mustContain(t, c, "EVAL", "redis.setresp(3); error('oops')", "0", "oops")
+		mustNil(t, c, "GET", "nosuch")
+		mustOK(t, c, "FUNCTION", "DELETE", "resp")
+	})
+
+	t.Run("STATS", func(t *testing.T) {
+		c2, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c2.Close()
+		useRESP3(t, c)
+
+		s.SetBusyScriptTime(0)
+		mustDo(t, c,
+			"FUNCTION", "LOAD", "#!lua name=loop\nredis.register_function('loop', function() while true do end end)",
+			proto.String("loop"),
+		)
+		done := make(chan string, 1)
+		go func() {
+			res, err := c2.Do("FCALL", "loop", "0")
+			ok(t, err)
+			done <- res
+		}()
+		waitBusy(t, c, msgBusyFunction)
+
+		stats, err := c.DoValue("FUNCTION", "STATS")
+		ok(t, err)
+		running, _ := stats.Get("running_script")
+		name, _ := running.Get("name")
+		equals(t, "loop", name.Str)
+		cmd, _ := running.Get("command")
+		equals(t, 3, len(cmd.Array))
+		equals(t, "loop", cmd.Array[1].Str)
+		engines, _ := stats.Get("engines")
+		lua, _ := engines.Get("LUA")
+		count, _ := lua.Get("libraries_count")
+		equals(t, 2, count.Int)
+
+		mustOK(t, c, "FUNCTION", "KILL")
+		equals(t, proto.Error(msgFunctionKilled), <-done)
+		mustContain(t, c, "FUNCTION", "STATS", "running_script")
+	})
+}
@@ -30,32 +30,32 @@ func inMilliSeconds(t time.Time) int {
 
 // commandsGeneric handles EXPIRE, TTL, PERSIST, &c.
 func commandsGeneric(m *Miniredis) {
-	m.srv.Register("COPY", m.cmdCopy)
-	m.srv.Register("DEL", m.cmdDel)
+	m.srv.Register("COPY", m.cmdCopy, server.WriteOption())
+	m.srv.Register("DEL", m.cmdDel, server.WriteOption())
 	m.srv.Register("DUMP", m.cmdDump, server.ReadOnlyOption())
 	m.srv.Register("EXISTS", m.cmdExists, server.ReadOnlyOption())
-	m.srv.Register("EXPIRE", makeCmdExpire(m, false, time.Second))
-	m.srv.Register("EXPIREAT", makeCmdExpire(m, true, time.Second))
+	m.srv.Register("EXPIRE", makeCmdExpire(m, false, time.Second), server.WriteOption())
+	m.srv.Register("EXPIREAT", makeCmdExpire(m, true, time.Second), server.WriteOption())
 	m.srv.Register("EXPIRETIME", m.makeCmdExpireTime(inSeconds), server.ReadOnlyOption())
 	m.srv.Register("PEXPIRETIME", m.makeCmdExpireTime(inMilliSeconds), server.ReadOnlyOption())
 	m.srv.Register("KEYS", m.cmdKeys, server.ReadOnlyOption())
 	// MIGRATE
-	m.srv.Register("MOVE", m.cmdMove)
+	m.srv.Register("MOVE", m.cmdMove, server.WriteOption())
 	// OBJECT
-	m.srv.Register("PERSIST", m.cmdPersist)
-	m.srv.Register("PEXPIRE", makeCmdExpire(m, false, time.Millisecond))
-	m.srv.Register("PEXPIREAT", makeCmdExpire(m, true, time.Millisecond))
+	m.srv.Register("PERSIST", m.cmdPersist, server.WriteOption())
+	m.srv.Register("PEXPIRE", makeCmdExpire(m, false, time.Millisecond), server.WriteOption())
+	m.srv.Register("PEXPIREAT", makeCmdExpire(m, true, time.Millisecond), server.WriteOption())
 	m.srv.Register("PTTL", m.cmdPTTL, server.ReadOnlyOption())
 	m.srv.Register("RANDOMKEY", m.cmdRandomkey, server.ReadOnlyOption())
-	m.srv.Register("RENAME", m.cmdRename)
-	m.srv.Register("RENAMENX", m.cmdRenamenx)
-	m.srv.Register("RESTORE", m.cmdRestore)
+	m.srv.Register("RENAME", m.cmdRename, server.WriteOption())
+	m.srv.Register("RENAMENX", m.cmdRenamenx, server.WriteOption())
+	m.srv.Register("RESTORE", m.cmdRestore, server.WriteOption())
 	m.srv.Register("TOUCH", m.cmdTouch, server.ReadOnlyOption())
 	m.srv.Register("TTL", m.cmdTTL, server.ReadOnlyOption())
 	m.srv.Register("TYPE", m.cmdType, server.ReadOnlyOption())
 	m.srv.Register("SCAN", m.cmdScan, server.ReadOnlyOption())
 	// SORT
-	m.srv.Register("UNLINK", m.cmdDel)
+	m.srv.Register("UNLINK", m.cmdDel, server.WriteOption())
 	m.srv.Register("WAIT", m.cmdWait)
 }
 
@@ -207,6 +207,8 @@ func (m *Miniredis) cmdTouch(c *server.Peer, cmd string, args []string) {
 		count := 0
 		for _, key := range args {
 			if db.exists(key) {
+				// TOUCH also works for NO-TOUCH clients
+				db.lru[key] = m.effectiveNow()
 				count++
 			}
 		}
@@ -784,6 +786,21 @@ func (m *Miniredis) cmdWait(c *server.Peer, cmd string, args []string) {
 		c.WriteError(msgTimeoutNegative)
 		return
 	}
-	// WAIT always returns 0 when called on a standalone instance
-	c.WriteInt(0)
+	blocking(
+		m,
+		c,
+		time.Duration(timeout)*time.Millisecond,
+		func(c *server.Peer, ctx *connCtx) bool {
+			if nReplicas == 0 || !m.virtualTO || ctx.nested {
+				// WAIT always returns 0 when called on a standalone instance
+				c.WriteInt(0)
+				return true
+			}
+			// no replica will ever acknowledge
+			return false
+		},
+		func(c *server.Peer) {
+			c.WriteInt(0)
+		},
+	)
 }
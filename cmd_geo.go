@@ -13,12 +13,12 @@ import (
 
 // commandsGeo handles GEOADD, GEORADIUS etc.
 func commandsGeo(m *Miniredis) {
-	m.srv.Register("GEOADD", m.cmdGeoadd)
+	m.srv.Register("GEOADD", m.cmdGeoadd, server.WriteOption())
 	m.srv.Register("GEODIST", m.cmdGeodist, server.ReadOnlyOption())
 	m.srv.Register("GEOPOS", m.cmdGeopos, server.ReadOnlyOption())
-	m.srv.Register("GEORADIUS", m.cmdGeoradius)
+	m.srv.Register("GEORADIUS", m.cmdGeoradius, server.WriteOption())
 	m.srv.Register("GEORADIUS_RO", m.cmdGeoradius, server.ReadOnlyOption())
-	m.srv.Register("GEORADIUSBYMEMBER", m.cmdGeoradiusbymember)
+	m.srv.Register("GEORADIUSBYMEMBER", m.cmdGeoradiusbymember, server.WriteOption())
 	m.srv.Register("GEORADIUSBYMEMBER_RO", m.cmdGeoradiusbymember, server.ReadOnlyOption())
 }
 
@@ -155,8 +155,8 @@ func (m *Miniredis) cmdGeopos(c *server.Peer, cmd string, args []string) {
 			score := db.ssetScore(key, l)
 			c.WriteLen(2)
 			long, lat := fromGeohash(uint64(score))
-			c.WriteBulk(fmt.Sprintf("%f", long))
-			c.WriteBulk(fmt.Sprintf("%f", lat))
+			writeCoord(c, long)
+			writeCoord(c, lat)
 		}
 	})
 }
@@ -341,8 +341,8 @@ func (m *Miniredis) cmdGeoradius(c *server.Peer, cmd string, args []string) {
 			}
 			if opts.withCoord {
 				c.WriteLen(2)
-				c.WriteBulk(fmt.Sprintf("%f", member.Longitude))
-				c.WriteBulk(fmt.Sprintf("%f", member.Latitude))
+				writeCoord(c, member.Longitude)
+				writeCoord(c, member.Latitude)
 			}
 		}
 	})
@@ -535,8 +535,8 @@ func (m *Miniredis) cmdGeoradiusbymember(c *server.Peer, cmd string, args []stri
 			}
 			if opts.withCoord {
 				c.WriteLen(2)
-				c.WriteBulk(fmt.Sprintf("%f", member.Longitude))
-				c.WriteBulk(fmt.Sprintf("%f", member.Latitude))
+				writeCoord(c, member.Longitude)
+				writeCoord(c, member.Latitude)
 			}
 		}
 	})
@@ -575,3 +575,13 @@ func parseUnit(u string) float64 {
 		return 0
 	}
 }
+
+// writeCoord writes a longitude or a latitude. That's a string in RESP2, and a
+// double in RESP3.
+func writeCoord(c *server.Peer, v float64) {
+	if isResp3(c) {
+		c.WriteFloat(v)
+		return
+	}
+	c.WriteBulk(fmt.Sprintf("%f", v))
+}
@@ -1,6 +1,7 @@
 package miniredis
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/alicebob/miniredis/v2/proto"
@@ -75,6 +76,14 @@ func TestGeopos(t *testing.T) {
 			proto.Error(msgWrongType),
 		)
 	})
+
+	useRESP3(t, c)
+	t.Run("RESP3", func(t *testing.T) {
+		res, err := c.Do("GEOPOS", "Sicily", "Palermo", "Corleone")
+		ok(t, err)
+		assert(t, strings.HasPrefix(res, "*2\r\n*2\r\n,13.3613"), "GEOPOS gives doubles: %q", res)
+		assert(t, strings.HasSuffix(res, "_\r\n"), "GEOPOS gives a null: %q", res)
+	})
 }
 
 // Test GEOADD / GEORADIUS / GEORADIUS_RO
@@ -14,23 +14,23 @@ import (
 
 // commandsHash handles all hash value operations.
 func commandsHash(m *Miniredis) {
-	m.srv.Register("HDEL", m.cmdHdel)
+	m.srv.Register("HDEL", m.cmdHdel, server.WriteOption())
 	m.srv.Register("HEXISTS", m.cmdHexists, server.ReadOnlyOption())
 	m.srv.Register("HGET", m.cmdHget, server.ReadOnlyOption())
 	m.srv.Register("HGETALL", m.cmdHgetall, server.ReadOnlyOption())
-	m.srv.Register("HINCRBY", m.cmdHincrby)
-	m.srv.Register("HINCRBYFLOAT", m.cmdHincrbyfloat)
+	m.srv.Register("HINCRBY", m.cmdHincrby, server.WriteOption())
+	m.srv.Register("HINCRBYFLOAT", m.cmdHincrbyfloat, server.WriteOption())
 	m.srv.Register("HKEYS", m.cmdHkeys, server.ReadOnlyOption())
 	m.srv.Register("HLEN", m.cmdHlen, server.ReadOnlyOption())
 	m.srv.Register("HMGET", m.cmdHmget, server.ReadOnlyOption())
-	m.srv.Register("HMSET", m.cmdHmset)
-	m.srv.Register("HSET", m.cmdHset)
-	m.srv.Register("HSETNX", m.cmdHsetnx)
+	m.srv.Register("HMSET", m.cmdHmset, server.WriteOption())
+	m.srv.Register("HSET", m.cmdHset, server.WriteOption())
+	m.srv.Register("HSETNX", m.cmdHsetnx, server.WriteOption())
 	m.srv.Register("HSTRLEN", m.cmdHstrlen, server.ReadOnlyOption())
 	m.srv.Register("HVALS", m.cmdHvals, server.ReadOnlyOption())
 	m.srv.Register("HSCAN", m.cmdHscan, server.ReadOnlyOption())
 	m.srv.Register("HRANDFIELD", m.cmdHrandfield, server.ReadOnlyOption())
-	m.srv.Register("HEXPIRE", m.cmdHexpire)
+	m.srv.Register("HEXPIRE", m.cmdHexpire, server.WriteOption())
 }
 
 // HSET
@@ -630,8 +630,17 @@ func (m *Miniredis) cmdHrandfield(c *server.Peer, cmd string, args []string) {
 		}
 
 		if opts.withValues {
-			peer.WriteMapLen(len(members))
+			// RESP3 gives [field, value] pairs, since there can be duplicates
+			resp3 := isResp3(peer)
+			if resp3 {
+				peer.WriteLen(len(members))
+			} else {
+				peer.WriteLen(len(members) * 2)
+			}
 			for _, m := range members {
+				if resp3 {
+					peer.WriteLen(2)
+				}
 				peer.WriteBulk(m)
 				peer.WriteBulk(db.hashGet(opts.key, m))
 			}
@@ -226,6 +226,12 @@ func TestHashGetall(t *testing.T) {
 		mustDo(t, c, "HGETALL", "nosuch",
 			proto.StringMap(),
 		)
+
+		res, err := c.Do("HGETALL", "wim")
+		ok(t, err)
+		var all map[string]string
+		ok(t, proto.Unmarshal(res, &all))
+		equals(t, map[string]string{"gijs": "lam", "kees": "bok", "teun": "vuur", "zus": "jet"}, all)
 	})
 }
 
@@ -683,6 +689,18 @@ func TestHashRandField(t *testing.T) {
 		"HRANDFIELD", "wim", "zus",
 		proto.Error(msgInvalidInt),
 	)
+
+	useRESP3(t, c)
+	t.Run("RESP3", func(t *testing.T) {
+		s.HSet("single", "zus", "jet")
+		mustDo(t, c,
+			"HRANDFIELD", "single", "-2", "WITHVALUES",
+			proto.Array(
+				proto.Strings("zus", "jet"),
+				proto.Strings("zus", "jet"),
+			),
+		)
+	})
 }
 
 func TestParseHExpireArgs(t *testing.T) {
@@ -4,9 +4,9 @@ import "github.com/alicebob/miniredis/v2/server"
 
 // commandsHll handles all hll related operations.
 func commandsHll(m *Miniredis) {
-	m.srv.Register("PFADD", m.cmdPfadd)
+	m.srv.Register("PFADD", m.cmdPfadd, server.WriteOption())
 	m.srv.Register("PFCOUNT", m.cmdPfcount, server.ReadOnlyOption())
-	m.srv.Register("PFMERGE", m.cmdPfmerge)
+	m.srv.Register("PFMERGE", m.cmdPfmerge, server.WriteOption())
 }
 
 // PFADD
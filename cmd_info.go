@@ -12,7 +12,12 @@ const (
 	clientsSectionContent = "# Clients\nconnected_clients:%d\r\n"
 
 	statsSectionName    = "stats"
-	statsSectionContent = "# Stats\ntotal_connections_received:%d\r\ntotal_commands_processed:%d\r\n"
+	statsSectionContent = "# Stats\ntotal_connections_received:%d\r\ntotal_commands_processed:%d\r\nexpired_keys:%d\r\n"
+
+	persistenceSectionName    = "persistence"
+	persistenceSectionContent = "# Persistence\nloading:%d\r\nasync_loading:0\r\n"
+
+	replicationSectionName = "replication"
 )
 
 // Command 'INFO' from https://redis.io/commands/info/
@@ -20,24 +25,48 @@ func (m *Miniredis) cmdInfo(c *server.Peer, cmd string, args []string) {
 	if !m.isValidCMD(c, cmd, args, between(0, 1)) {
 		return
 	}
-	var result string
-	if len(args) == 0 {
-		result = fmt.Sprintf(clientsSectionContent, m.Server().ClientsLen()) + fmt.Sprintf(statsSectionContent, m.Server().TotalConnections(), m.Server().TotalCommands())
-		c.WriteBulk(result)
-		return
-	}
-
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		var result string
+		if len(args) == 0 {
+			result = fmt.Sprintf(clientsSectionContent, m.Server().ClientsLen()) + m.statsSection()
+			c.WriteVerbatim("txt", result)
+			return
+		}
+
 		switch section := strings.ToLower(args[0]); section {
 		case clientsSectionName:
 			result = fmt.Sprintf(clientsSectionContent, m.Server().ClientsLen())
 		case statsSectionName:
-			result = fmt.Sprintf(statsSectionContent, m.Server().TotalConnections(), m.Server().TotalCommands())
+			result = m.statsSection()
+		case persistenceSectionName:
+			loading := 0
+			if m.State() == StateLoading {
+				loading = 1
+			}
+			result = fmt.Sprintf(persistenceSectionContent, loading)
+		case replicationSectionName:
+			result = replicationSection(m.State())
 		default:
 			setDirty(c)
 			c.WriteError(fmt.Sprintf("section (%s) is not supported", section))
 			return
 		}
-		c.WriteBulk(result)
+		c.WriteVerbatim("txt", result)
 	})
 }
+
+// statsSection needs the lock.
+func (m *Miniredis) statsSection() string {
+	return fmt.Sprintf(statsSectionContent, m.Server().TotalConnections(), m.Server().TotalCommands(), m.expiredKeys)
+}
+
+func replicationSection(s State) string {
+	switch s {
+	case StateReadOnly:
+		return "# Replication\nrole:slave\r\nmaster_link_status:up\r\nslave_read_only:1\r\nconnected_slaves:0\r\n"
+	case StateMasterDown:
+		return "# Replication\nrole:slave\r\nmaster_link_status:down\r\nslave_read_only:1\r\nconnected_slaves:0\r\n"
+	default:
+		return "# Replication\nrole:master\r\nconnected_slaves:0\r\n"
+	}
+}
@@ -20,7 +20,7 @@ func TestMiniredis_cmdInfo(t *testing.T) {
 		_, c := runWithClient(t)
 		mustDo(t, c,
 			"INFO",
-			proto.String("# Clients\nconnected_clients:1\r\n# Stats\ntotal_connections_received:1\r\ntotal_commands_processed:1\r\n"),
+			proto.String("# Clients\nconnected_clients:1\r\n# Stats\ntotal_connections_received:1\r\ntotal_commands_processed:1\r\nexpired_keys:0\r\n"),
 		)
 	})
 
@@ -54,14 +54,14 @@ func TestMiniredis_cmdInfo(t *testing.T) {
 		s, c := runWithClient(t)
 		mustDo(t, c,
 			"INFO", "stats",
-			proto.String("# Stats\ntotal_connections_received:1\r\ntotal_commands_processed:1\r\n"),
+			proto.String("# Stats\ntotal_connections_received:1\r\ntotal_commands_processed:1\r\nexpired_keys:0\r\n"),
 		)
 
 		c2, err := proto.Dial(s.Addr())
 		ok(t, err)
 		mustDo(t, c2,
 			"INFO", "stats",
-			proto.String("# Stats\ntotal_connections_received:2\r\ntotal_commands_processed:2\r\n"),
+			proto.String("# Stats\ntotal_connections_received:2\r\ntotal_commands_processed:2\r\nexpired_keys:0\r\n"),
 		)
 		c2.Close()
 
@@ -72,7 +72,16 @@ func TestMiniredis_cmdInfo(t *testing.T) {
 		defer c3.Close()
 		mustDo(t, c3,
 			"INFO", "stats",
-			proto.String("# Stats\ntotal_connections_received:3\r\ntotal_commands_processed:3\r\n"),
+			proto.String("# Stats\ntotal_connections_received:3\r\ntotal_commands_processed:3\r\nexpired_keys:0\r\n"),
+		)
+	})
+
+	t.Run("RESP3", func(t *testing.T) {
+		_, c := runWithClient(t)
+		useRESP3(t, c)
+		mustDo(t, c,
+			"INFO", "clients",
+			proto.Verbatim("# Clients\nconnected_clients:1\r\n"),
 		)
 	})
 }
@@ -19,26 +19,26 @@ const (
 
 // commandsList handles list commands (mostly L*)
 func commandsList(m *Miniredis) {
-	m.srv.Register("BLPOP", m.cmdBlpop)
-	m.srv.Register("BRPOP", m.cmdBrpop)
-	m.srv.Register("BRPOPLPUSH", m.cmdBrpoplpush)
+	m.srv.Register("BLPOP", m.cmdBlpop, server.WriteOption())
+	m.srv.Register("BRPOP", m.cmdBrpop, server.WriteOption())
+	m.srv.Register("BRPOPLPUSH", m.cmdBrpoplpush, server.WriteOption())
 	m.srv.Register("LINDEX", m.cmdLindex, server.ReadOnlyOption())
 	m.srv.Register("LPOS", m.cmdLpos, server.ReadOnlyOption())
-	m.srv.Register("LINSERT", m.cmdLinsert)
+	m.srv.Register("LINSERT", m.cmdLinsert, server.WriteOption())
 	m.srv.Register("LLEN", m.cmdLlen, server.ReadOnlyOption())
-	m.srv.Register("LPOP", m.cmdLpop)
-	m.srv.Register("LPUSH", m.cmdLpush)
-	m.srv.Register("LPUSHX", m.cmdLpushx)
+	m.srv.Register("LPOP", m.cmdLpop, server.WriteOption())
+	m.srv.Register("LPUSH", m.cmdLpush, server.WriteOption())
+	m.srv.Register("LPUSHX", m.cmdLpushx, server.WriteOption())
 	m.srv.Register("LRANGE", m.cmdLrange, server.ReadOnlyOption())
-	m.srv.Register("LREM", m.cmdLrem)
-	m.srv.Register("LSET", m.cmdLset)
-	m.srv.Register("LTRIM", m.cmdLtrim)
-	m.srv.Register("RPOP", m.cmdRpop)
-	m.srv.Register("RPOPLPUSH", m.cmdRpoplpush)
-	m.srv.Register("RPUSH", m.cmdRpush)
-	m.srv.Register("RPUSHX", m.cmdRpushx)
-	m.srv.Register("LMOVE", m.cmdLmove)
-	m.srv.Register("BLMOVE", m.cmdBlmove)
+	m.srv.Register("LREM", m.cmdLrem, server.WriteOption())
+	m.srv.Register("LSET", m.cmdLset, server.WriteOption())
+	m.srv.Register("LTRIM", m.cmdLtrim, server.WriteOption())
+	m.srv.Register("RPOP", m.cmdRpop, server.WriteOption())
+	m.srv.Register("RPOPLPUSH", m.cmdRpoplpush, server.WriteOption())
+	m.srv.Register("RPUSH", m.cmdRpush, server.WriteOption())
+	m.srv.Register("RPUSHX", m.cmdRpushx, server.WriteOption())
+	m.srv.Register("LMOVE", m.cmdLmove, server.WriteOption())
+	m.srv.Register("BLMOVE", m.cmdBlmove, server.WriteOption())
 }
 
 // BLPOP
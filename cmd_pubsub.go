@@ -15,7 +15,7 @@ func commandsPubsub(m *Miniredis) {
 	m.srv.Register("UNSUBSCRIBE", m.cmdUnsubscribe)
 	m.srv.Register("PSUBSCRIBE", m.cmdPsubscribe)
 	m.srv.Register("PUNSUBSCRIBE", m.cmdPunsubscribe)
-	m.srv.Register("PUBLISH", m.cmdPublish)
+	m.srv.Register("PUBLISH", m.cmdPublish, server.WriteOption())
 	m.srv.Register("PUBSUB", m.cmdPubSub)
 }
 
@@ -17,9 +17,9 @@ import (
 )
 
 func commandsScripting(m *Miniredis) {
-	m.srv.Register("EVAL", m.cmdEval)
+	m.srv.Register("EVAL", m.cmdEval, server.WriteOption())
 	m.srv.Register("EVAL_RO", m.cmdEvalro, server.ReadOnlyOption())
-	m.srv.Register("EVALSHA", m.cmdEvalsha)
+	m.srv.Register("EVALSHA", m.cmdEvalsha, server.WriteOption())
 	m.srv.Register("EVALSHA_RO", m.cmdEvalshaRo, server.ReadOnlyOption())
 	m.srv.Register("SCRIPT", m.cmdScript)
 }
@@ -28,12 +28,186 @@ var (
 	parsedScripts = sync.Map{}
 )
 
+const (
+	msgShebangEngine = "ERR Unexpected engine in script shebang: %s"
+	msgShebangOption = "ERR Unknown lua shebang option: %s"
+	msgShebangFlag   = "ERR Unexpected flag in script shebang: %s"
+)
+
 // Execute lua. Needs to run m.Lock()ed, from within withTx().
 // Returns true if the lua was OK (and hence should be cached).
-func (m *Miniredis) runLuaScript(c *server.Peer, sha, script string, readOnly bool, args []string) bool {
-	l := lua.NewState(lua.Options{SkipOpenLibs: true})
+func (m *Miniredis) runLuaScript(c *server.Peer, cmd, sha, script string, readOnly bool, args []string) bool {
+	flags, shebang, body, err := parseScriptShebang(script)
+	if err != nil {
+		c.WriteError(err.Error())
+		return false
+	}
+	if shebang {
+		if msg := m.scriptFlagsError(flags, readOnly); msg != "" {
+			c.WriteError(msg)
+			return false
+		}
+		readOnly = readOnly || hasFlag(flags, "no-writes")
+	}
+
+	keys, args, ok := splitKeys(c, args)
+	if !ok {
+		return false
+	}
+
+	var slot *scriptSlot
+	if shebang && !hasFlag(flags, "allow-cross-slot-keys") && m.inCluster() {
+		slot = newScriptSlot(keys)
+	}
+	var trace *ScriptTrace
+	if m.cover != nil {
+		trace = m.cover.trace(cmd, sha)
+	}
+	l := m.newLuaState(c, sha, readOnly, slot, trace)
 	defer l.Close()
 
+	// set global variable KEYS
+	keysTable := l.NewTable()
+	for i, k := range keys {
+		l.RawSet(keysTable, lua.LNumber(i+1), lua.LString(k))
+	}
+	l.SetGlobal("KEYS", keysTable)
+
+	argvTable := l.NewTable()
+	for i, a := range args {
+		l.RawSet(argvTable, lua.LNumber(i+1), lua.LString(a))
+	}
+	l.SetGlobal("ARGV", argvTable)
+
+	_ = doScript(l, protectGlobals)
+
+	// lua can call redis.setresp(...), but it's tmp state.
+	oldresp := c.Resp3
+	defer func() {
+		c.Resp3 = oldresp
+		c.SwitchResp3 = nil
+	}()
+	l.SetContext(m.script.begin(nil))
+	debug := getCtx(c).ldb
+	if m.cover != nil || debug != nil {
+		err = m.doHookedScript(l, sha, script, body, debug)
+	} else {
+		err = doScript(l, body)
+	}
+	if m.script.end() {
+		c.WriteError(msgScriptKilled)
+		return true
+	}
+	if err != nil {
+		c.WriteError(err.Error())
+		return false
+	}
+
+	luaToRedis(l, c, l.Get(1))
+	return true
+}
+
+// parseScriptShebang parses the optional "#!lua flags=no-writes,allow-stale"
+// first line of an EVAL script. Returns the flags, whether there was a
+// shebang at all, and the script without the shebang line. Scripts without a
+// shebang skip all flag checks, as in Redis.
+func parseScriptShebang(script string) ([]string, bool, string, error) {
+	if !strings.HasPrefix(script, "#!") {
+		return nil, false, script, nil
+	}
+	line, body := script, ""
+	if i := strings.IndexByte(script, '\n'); i >= 0 {
+		// keep the newline, so line numbers in errors are right
+		line, body = script[:i], script[i:]
+	}
+	parts := strings.Fields(line)
+	if parts[0] != "#!lua" {
+		return nil, false, "", fmt.Errorf(msgShebangEngine, parts[0])
+	}
+	var flags []string
+	for _, p := range parts[1:] {
+		if !strings.HasPrefix(p, "flags=") {
+			return nil, false, "", fmt.Errorf(msgShebangOption, p)
+		}
+		p = p[len("flags="):]
+		if p == "" {
+			continue
+		}
+		for _, f := range strings.Split(p, ",") {
+			if !functionFlags[f] {
+				return nil, false, "", fmt.Errorf(msgShebangFlag, f)
+			}
+			flags = append(flags, f)
+		}
+	}
+	return flags, true, body, nil
+}
+
+// scriptFlagsError gives the error Redis gives before it runs a script or
+// function with these flags, if any. miniredis has no memory limit, so
+// "allow-oom" changes nothing. "allow-cross-slot-keys" is checked by the
+// script's redis.call()s, see EnableClusterMode().
+func (m *Miniredis) scriptFlagsError(flags []string, readOnly bool) string {
+	noWrites := hasFlag(flags, "no-writes")
+	if readOnly && !noWrites {
+		return msgFunctionWriteRO
+	}
+	if hasFlag(flags, "no-cluster") && m.inCluster() {
+		return msgNoClusterScript
+	}
+	switch m.State() {
+	case StateMasterDown:
+		if !hasFlag(flags, "allow-stale") {
+			return msgMasterDown
+		}
+	case StateReadOnly:
+		if !noWrites {
+			return msgReadOnly
+		}
+	}
+	return ""
+}
+
+func hasFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// splitKeys splits "numkeys key [key ...] arg [arg ...]" in keys and args.
+// Writes the error if numkeys is invalid.
+func splitKeys(c *server.Peer, args []string) ([]string, []string, bool) {
+	keysS, args := args[0], args[1:]
+	keysLen, err := strconv.Atoi(keysS)
+	if err != nil {
+		c.WriteError(msgInvalidInt)
+		return nil, nil, false
+	}
+	if keysLen < 0 {
+		c.WriteError(msgNegativeKeysNumber)
+		return nil, nil, false
+	}
+	if keysLen > len(args) {
+		c.WriteError(msgInvalidKeysNumber)
+		return nil, nil, false
+	}
+	return args[:keysLen], args[keysLen:], true
+}
+
+// newLuaState makes a Lua state with the standard libraries and the "redis"
+// module. Close() it when done.
+func (m *Miniredis) newLuaState(c *server.Peer, sha string, readOnly bool, slot *scriptSlot, trace *ScriptTrace) *lua.LState {
+	return newLua(mkLua(m.srv, c, sha, readOnly, slot, &m.script, trace))
+}
+
+// newLua makes a Lua state with the standard libraries, and a "redis" module
+// with the given functions and constants.
+func newLua(redisFuncs map[string]lua.LGFunction, redisConstants map[string]lua.LValue) *lua.LState {
+	l := lua.NewState(lua.Options{SkipOpenLibs: true})
+
 	// Taken from the go-lua manual
 	for _, pair := range []struct {
 		n string
@@ -59,35 +233,6 @@ func (m *Miniredis) runLuaScript(c *server.Peer, sha, script string, readOnly bo
 	luajson.Preload(l)
 	requireGlobal(l, "cjson", "json")
 
-	// set global variable KEYS
-	keysTable := l.NewTable()
-	keysS, args := args[0], args[1:]
-	keysLen, err := strconv.Atoi(keysS)
-	if err != nil {
-		c.WriteError(msgInvalidInt)
-		return false
-	}
-	if keysLen < 0 {
-		c.WriteError(msgNegativeKeysNumber)
-		return false
-	}
-	if keysLen > len(args) {
-		c.WriteError(msgInvalidKeysNumber)
-		return false
-	}
-	keys, args := args[:keysLen], args[keysLen:]
-	for i, k := range keys {
-		l.RawSet(keysTable, lua.LNumber(i+1), lua.LString(k))
-	}
-	l.SetGlobal("KEYS", keysTable)
-
-	argvTable := l.NewTable()
-	for i, a := range args {
-		l.RawSet(argvTable, lua.LNumber(i+1), lua.LString(a))
-	}
-	l.SetGlobal("ARGV", argvTable)
-
-	redisFuncs, redisConstants := mkLua(m.srv, c, sha, readOnly)
 	redisMod := l.CreateTable(0, len(redisFuncs)+len(redisConstants))
 	for fname, fn := range redisFuncs {
 		redisMod.RawSetString(fname, l.NewFunction(fn))
@@ -100,20 +245,10 @@ func (m *Miniredis) runLuaScript(c *server.Peer, sha, script string, readOnly bo
 	}
 
 	l.RegisterModule("os", mkLuaOS())
-
-	_ = doScript(l, protectGlobals)
-
-	// lua can call redis.setresp(...), but it's tmp state.
-	oldresp := c.Resp3
-	if err := doScript(l, script); err != nil {
-		c.WriteError(err.Error())
-		return false
-	}
-
-	luaToRedis(l, c, l.Get(1))
-	c.Resp3 = oldresp
-	c.SwitchResp3 = nil
-	return true
+	l.RegisterModule("bit", mkLuaBit())
+	l.RegisterModule("struct", mkLuaStruct())
+	l.RegisterModule("cmsgpack", mkLuaMsgpack())
+	return l
 }
 
 // doScript pre-compiles the given script into a Lua prototype,
@@ -125,7 +260,29 @@ func doScript(l *lua.LState, script string) error {
 	if err != nil {
 		return fmt.Errorf(errLuaParseError(err))
 	}
+	return doProto(l, proto)
+}
 
+// doHookedScript is doScript(), but with the line hooks for coverage and the
+// debugger. debug can be nil.
+func (m *Miniredis) doHookedScript(l *lua.LState, sha, script, body string, debug *ldb) error {
+	hs, err := compileHooked(body)
+	if err != nil {
+		return fmt.Errorf(errLuaParseError(err))
+	}
+	var hooks []func(*lua.LState, int)
+	if m.cover != nil {
+		hooks = append(hooks, m.cover.hook(sha, script, hs.lines))
+	}
+	if debug != nil {
+		hooks = append(hooks, debug.lineHook)
+	}
+	setLineHook(l, hooks...)
+	return doProto(l, hs.proto)
+}
+
+// doProto executes a compiled script.
+func doProto(l *lua.LState, proto *lua.FunctionProto) error {
 	lfunc := l.NewFunctionFromProto(proto)
 	l.Push(lfunc)
 	if err := l.PCall(0, lua.MultRet, nil); err != nil {
@@ -165,10 +322,15 @@ func (m *Miniredis) cmdEvalShared(c *server.Peer, cmd string, readOnly bool, arg
 	}
 
 	script, args := args[0], args[1:]
+	debug := ctx.scriptDebug != debugNo && !inTx(ctx)
 
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		if debug {
+			m.debugScript(c, ctx, cmd, script, readOnly, args)
+			return
+		}
 		sha := sha1Hex(script)
-		ok := m.runLuaScript(c, sha, script, readOnly, args)
+		ok := m.runLuaScript(c, cmd, sha, script, readOnly, args)
 		if ok {
 			m.scripts[sha] = script
 		}
@@ -192,6 +354,11 @@ func (m *Miniredis) cmdEvalshaShared(c *server.Peer, cmd string, readOnly bool,
 		return
 	}
 
+	if ctx.scriptDebug != debugNo {
+		c.WriteError(msgDebugEvalsha)
+		return
+	}
+
 	sha, args := args[0], args[1:]
 
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
@@ -201,7 +368,7 @@ func (m *Miniredis) cmdEvalshaShared(c *server.Peer, cmd string, readOnly bool,
 			return
 		}
 
-		m.runLuaScript(c, sha, script, readOnly, args)
+		m.runLuaScript(c, cmd, sha, script, readOnly, args)
 	})
 }
 
@@ -252,6 +419,18 @@ func (m *Miniredis) cmdScript(c *server.Peer, cmd string, args []string) {
 			c.WriteError(errWrongNumber("script|exists"))
 			return
 		}
+	case "kill":
+		if len(args) != 0 {
+			setDirty(c)
+			c.WriteError(fmt.Sprintf(msgFScriptUsage, "KILL"))
+			return
+		}
+	case "debug":
+		if len(args) != 1 {
+			setDirty(c)
+			c.WriteError(fmt.Sprintf(msgFScriptUsage, "DEBUG"))
+			return
+		}
 	case "flush":
 		if len(args) == 1 {
 			switch strings.ToUpper(args[0]) {
@@ -271,10 +450,16 @@ func (m *Miniredis) cmdScript(c *server.Peer, cmd string, args []string) {
 		return
 	}
 
+	queued := inTx(ctx)
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		switch strings.ToLower(opts.subcmd) {
 		case "load":
-			if _, err := parse.Parse(strings.NewReader(opts.script), "user_script"); err != nil {
+			_, _, body, err := parseScriptShebang(opts.script)
+			if err != nil {
+				c.WriteError(err.Error())
+				return
+			}
+			if _, err := parse.Parse(strings.NewReader(body), "user_script"); err != nil {
 				c.WriteError(errLuaParseError(err))
 				return
 			}
@@ -293,6 +478,26 @@ func (m *Miniredis) cmdScript(c *server.Peer, cmd string, args []string) {
 		case "flush":
 			m.scripts = map[string]string{}
 			c.WriteOK()
+		case "kill":
+			// a running script is handled by scriptKill()
+			c.WriteError(msgNotBusy)
+		case "debug":
+			if queued {
+				c.WriteError(msgDebugMulti)
+				return
+			}
+			switch strings.ToLower(args[0]) {
+			case "no":
+				ctx.scriptDebug = debugNo
+			case "yes":
+				ctx.scriptDebug = debugYes
+			case "sync":
+				ctx.scriptDebug = debugSync
+			default:
+				c.WriteError(msgDebugUsage)
+				return
+			}
+			c.WriteOK()
 		}
 	})
 }
@@ -329,7 +534,7 @@ mt.__newindex = function (t, n, v)
   if dbg.getinfo(2) then
     local w = dbg.getinfo(2, "S").what
     if w ~= "C" then
-      error("Script attempted to create global variable '"..tostring(n).."'", 2)
+      error("Attempt to modify a readonly table", 2)
     end
   end
   rawset(t, n, v)
@@ -1,7 +1,9 @@
 package miniredis
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/alicebob/miniredis/v2/proto"
 )
@@ -72,7 +74,7 @@ func TestEval(t *testing.T) {
 
 	mustContain(t, c,
 		"EVAL", "someGlobal = 5", "0",
-		"Script attempted to create global variable 'someGlobal'",
+		"Attempt to modify a readonly table",
 	)
 
 	t.Run("bigger float value", func(t *testing.T) {
@@ -733,3 +735,653 @@ return res;
 		)
 	})
 }
+
+func TestEvalShebang(t *testing.T) {
+	s, c := runWithClient(t)
+
+	t.Run("flags", func(t *testing.T) {
+		mustOK(t, c, "SET", "foo", "bar")
+		mustDo(t, c,
+			"EVAL", "#!lua\nreturn redis.call('GET', KEYS[1])", "1", "foo",
+			proto.String("bar"),
+		)
+		mustDo(t, c,
+			"EVAL", "#!lua flags=no-writes,allow-oom,no-cluster,allow-stale,allow-cross-slot-keys\nreturn redis.call('GET', KEYS[1])", "1", "foo",
+			proto.String("bar"),
+		)
+		mustDo(t, c,
+			"EVAL", "#!lua flags=\nreturn 1", "0",
+			proto.Int(1),
+		)
+		mustContain(t, c,
+			"EVAL", "#!lua flags=no-writes\nreturn redis.call('SET', KEYS[1], 'x')", "1", "foo",
+			"Write commands are not allowed in read-only scripts",
+		)
+		s.CheckGet(t, "foo", "bar")
+		mustContain(t, c,
+			"EVAL", "#!lua\n\nerror('oops')", "0",
+			":3: oops",
+		)
+	})
+
+	t.Run("EVAL_RO", func(t *testing.T) {
+		mustDo(t, c,
+			"EVAL_RO", "#!lua flags=no-writes\nreturn redis.call('GET', KEYS[1])", "1", "foo",
+			proto.String("bar"),
+		)
+		mustDo(t, c,
+			"EVAL_RO", "#!lua\nreturn redis.call('GET', KEYS[1])", "1", "foo",
+			proto.Error(msgFunctionWriteRO),
+		)
+		// scripts without a shebang still work
+		mustDo(t, c,
+			"EVAL_RO", "return redis.call('GET', KEYS[1])", "1", "foo",
+			proto.String("bar"),
+		)
+	})
+
+	t.Run("SCRIPT LOAD", func(t *testing.T) {
+		script := "#!lua flags=no-writes\nreturn redis.call('GET', KEYS[1])"
+		mustDo(t, c,
+			"SCRIPT", "LOAD", script,
+			proto.String(sha1Hex(script)),
+		)
+		mustDo(t, c,
+			"EVALSHA_RO", sha1Hex(script), "1", "foo",
+			proto.String("bar"),
+		)
+		mustDo(t, c,
+			"SCRIPT", "LOAD", "#!lua flags=foo\nreturn 1",
+			proto.Error("ERR Unexpected flag in script shebang: foo"),
+		)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		mustDo(t, c,
+			"EVAL", "#!js\nreturn 1", "0",
+			proto.Error("ERR Unexpected engine in script shebang: #!js"),
+		)
+		mustDo(t, c,
+			"EVAL", "#!lua name=foo\nreturn 1", "0",
+			proto.Error("ERR Unknown lua shebang option: name=foo"),
+		)
+		mustDo(t, c,
+			"EVAL", "#!lua flags=no-writes,foo\nreturn 1", "0",
+			proto.Error("ERR Unexpected flag in script shebang: foo"),
+		)
+		mustDo(t, c,
+			"SCRIPT", "EXISTS", sha1Hex("#!js\nreturn 1"),
+			proto.Ints(0),
+		)
+	})
+
+	t.Run("states", func(t *testing.T) {
+		s.SetState(StateMasterDown)
+		defer s.SetState(StateNormal)
+		mustDo(t, c,
+			"EVAL", "#!lua\nreturn 1", "0",
+			proto.Error(msgMasterDown),
+		)
+		mustDo(t, c,
+			"EVAL", "#!lua flags=allow-stale\nreturn 1", "0",
+			proto.Int(1),
+		)
+		mustContain(t, c,
+			"EVAL", "return redis.call('GET', 'foo')", "0",
+			msgMasterDown,
+		)
+
+		s.SetState(StateReadOnly)
+		mustDo(t, c,
+			"EVAL", "#!lua\nreturn 1", "0",
+			proto.Error(msgReadOnly),
+		)
+		mustDo(t, c,
+			"EVAL", "#!lua flags=no-writes\nreturn redis.call('GET', 'foo')", "0",
+			proto.String("bar"),
+		)
+
+		s.SetState(StateClusterDown)
+		mustDo(t, c,
+			"EVAL", "#!lua flags=no-cluster\nreturn 1", "0",
+			proto.Error(msgNoClusterScript),
+		)
+		mustDo(t, c,
+			"EVAL", "#!lua\nreturn 1", "0",
+			proto.Int(1),
+		)
+	})
+
+	t.Run("cluster", func(t *testing.T) {
+		mustDo(t, c,
+			"EVAL", "#!lua flags=no-cluster\nreturn 1", "0",
+			proto.Int(1),
+		)
+		// "foo" and "bar" are in different slots
+		mustOK(t, c, "SET", "bar", "baz")
+		script := "#!lua\nreturn {redis.call('GET', KEYS[1]), redis.call('GET', 'bar')}"
+		mustDo(t, c,
+			"EVAL", script, "1", "foo",
+			proto.Strings("bar", "baz"),
+		)
+
+		s.EnableClusterMode()
+		mustDo(t, c,
+			"EVAL", "#!lua flags=no-cluster\nreturn 1", "0",
+			proto.Error(msgNoClusterScript),
+		)
+		mustContain(t, c,
+			"EVAL", script, "1", "foo",
+			msgCrossSlotScript,
+		)
+		mustDo(t, c,
+			"EVAL", "#!lua\nreturn redis.pcall('GET', 'bar')", "1", "foo",
+			proto.Error(msgCrossSlotScript),
+		)
+		mustDo(t, c,
+			"EVAL", "#!lua flags=allow-cross-slot-keys\n"+script[len("#!lua\n"):], "1", "foo",
+			proto.Strings("bar", "baz"),
+		)
+		mustDo(t, c,
+			"EVAL", "#!lua\nreturn redis.call('GET', 'bar')", "1", "{bar}foo",
+			proto.String("baz"),
+		)
+		// without a shebang anything goes
+		mustDo(t, c,
+			"EVAL", script[len("#!lua\n"):], "1", "foo",
+			proto.Strings("bar", "baz"),
+		)
+
+		mustDo(t, c,
+			"FUNCTION", "LOAD", "#!lua name=slots\nredis.register_function('getbar', function(keys) return redis.call('GET', 'bar') end)",
+			proto.String("slots"),
+		)
+		mustContain(t, c,
+			"FCALL", "getbar", "1", "foo",
+			msgCrossSlotScript,
+		)
+		mustDo(t, c,
+			"FCALL", "getbar", "0",
+			proto.String("baz"),
+		)
+	})
+}
+
+func TestScriptCoverage(t *testing.T) {
+	s, c := runWithClient(t)
+
+	// not enabled
+	mustDo(t, c, "EVAL", "return 1", "0", proto.Int(1))
+	equals(t, 0, len(s.ScriptCoverage()))
+	equals(t, 0, len(s.ScriptTraces()))
+
+	s.EnableScriptCoverage()
+	script := `local v = redis.call('GET', KEYS[1])
+if v then
+  return v
+end
+local function set(k)
+  redis.pcall('INCR', 'nosuchcmd', 'x')
+  return redis.call('SET', k, 'new')
+end
+return set(KEYS[1])
+`
+	sha := sha1Hex(script)
+	mustDo(t, c, "EVAL", script, "1", "foo", proto.Inline("OK"))
+	mustDo(t, c, "EVALSHA", sha, "1", "foo", proto.String("new"))
+
+	cov := s.ScriptCoverage()
+	equals(t, 1, len(cov))
+	equals(t, sha, cov[0].Name)
+	equals(t, script, cov[0].Source)
+	equals(t, map[int]int{1: 2, 2: 2, 3: 1, 5: 1, 6: 1, 7: 1, 9: 1}, cov[0].Lines)
+
+	traces := s.ScriptTraces()
+	equals(t, []ScriptTrace{
+		{
+			Cmd:  "EVAL",
+			Name: sha,
+			Calls: []ScriptCall{
+				{Args: []string{"GET", "foo"}, Reply: proto.Nil},
+				{Args: []string{"INCR", "nosuchcmd", "x"}, Reply: proto.Error("ERR wrong number of arguments for 'incr' command")},
+				{Args: []string{"SET", "foo", "new"}, Reply: proto.Inline("OK")},
+			},
+		},
+		{
+			Cmd:  "EVALSHA",
+			Name: sha,
+			Calls: []ScriptCall{
+				{Args: []string{"GET", "foo"}, Reply: proto.String("new")},
+			},
+		},
+	}, traces)
+
+	t.Run("lcov", func(t *testing.T) {
+		var b strings.Builder
+		ok(t, s.WriteScriptCoverage(&b))
+		equals(t, "TN:\nSF:"+sha+".lua\nDA:1,2\nDA:2,2\nDA:3,1\nDA:5,1\nDA:6,1\nDA:7,1\nDA:9,1\nLF:7\nLH:7\nend_of_record\n", b.String())
+	})
+
+	t.Run("functions", func(t *testing.T) {
+		s.ResetScriptCoverage()
+		mustDo(t, c,
+			"FUNCTION", "LOAD", testLibrary,
+			proto.String("mylib"),
+		)
+		mustDo(t, c,
+			"FCALL_RO", "myget", "1", "foo",
+			proto.String("new"),
+		)
+		cov := s.ScriptCoverage()
+		equals(t, 1, len(cov))
+		equals(t, "mylib", cov[0].Name)
+		equals(t, map[int]int{2: 1, 3: 1, 5: 1, 6: 0, 8: 1}, cov[0].Lines)
+		equals(t, []ScriptTrace{
+			{
+				Cmd:  "FCALL_RO",
+				Name: "myget",
+				Calls: []ScriptCall{
+					{Args: []string{"GET", "foo"}, Reply: proto.String("new")},
+				},
+			},
+		}, s.ScriptTraces())
+
+		// the library itself only ran once
+		mustDo(t, c,
+			"FCALL_RO", "myget", "1", "foo",
+			proto.String("new"),
+		)
+		equals(t, map[int]int{2: 1, 3: 2, 5: 1, 6: 0, 8: 1}, s.ScriptCoverage()[0].Lines)
+	})
+
+	t.Run("read-only", func(t *testing.T) {
+		s.ResetScriptCoverage()
+		mustContain(t, c,
+			"EVAL_RO", "return redis.call('SET', 'foo', 'bar')", "0",
+			"Write commands are not allowed",
+		)
+		equals(t, []ScriptCall{
+			{Args: []string{"SET", "foo", "bar"}, Reply: proto.Error("Write commands are not allowed in read-only scripts")},
+		}, s.ScriptTraces()[0].Calls)
+	})
+}
+
+func TestScriptDebug(t *testing.T) {
+	s := RunT(t)
+
+	// debugger replies are arrays of status lines
+	logs := func(lines ...string) string {
+		var res []string
+		for _, l := range lines {
+			res = append(res, proto.Inline(l))
+		}
+		return proto.Array(res...)
+	}
+	script := `local a = 1
+redis.call('SET', KEYS[1], 'bar')
+local t = {a, 'two'}
+redis.debug(t, a)
+return a`
+
+	t.Run("sync", func(t *testing.T) {
+		c, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c.Close()
+
+		mustOK(t, c, "SCRIPT", "DEBUG", "SYNC")
+		mustDo(t, c,
+			"EVAL", script, "1", "foo",
+			logs("* Stopped at 1, stop reason = step over", "-> 1   local a = 1"),
+		)
+		mustDo(t, c,
+			"s",
+			logs("* Stopped at 2, stop reason = step over", "-> 2   redis.call('SET', KEYS[1], 'bar')"),
+		)
+		mustDo(t, c,
+			"p", "a",
+			logs("<value> 1"),
+		)
+		mustDo(t, c,
+			"p", "KEYS",
+			logs(`<value> {"foo"}`),
+		)
+		mustDo(t, c,
+			"p", "nosuch",
+			logs("No such variable."),
+		)
+		mustDo(t, c,
+			"b", "5",
+			logs("   4   redis.debug(t, a)", "  #5   return a"),
+		)
+		mustDo(t, c,
+			"s",
+			logs(
+				"<redis> SET foo bar",
+				"<reply> +OK",
+				"* Stopped at 3, stop reason = step over",
+				"-> 3   local t = {a, 'two'}",
+			),
+		)
+		mustDo(t, c,
+			"e", "redis.call('GET', 'foo')",
+			logs("<retval> \"bar\""),
+		)
+		mustDo(t, c,
+			"r", "GET", "foo",
+			logs("<redis> GET foo", "<reply> \"bar\""),
+		)
+		mustDo(t, c,
+			"c",
+			logs(
+				`<debug> line 4: {1; "two"}, 1`,
+				"* Stopped at 5, stop reason = break point",
+				"->#5   return a",
+			),
+		)
+		mustDo(t, c,
+			"p",
+			logs("<value> a = 1", `<value> t = {1; "two"}`),
+		)
+		mustDo(t, c,
+			"t",
+			logs("In top level:", "->#5   return a"),
+		)
+		mustDo(t, c,
+			"foo",
+			logs("<error> Unknown Redis Lua debugger command or wrong number of arguments."),
+		)
+		mustDo(t, c,
+			"c",
+			logs("<endsession>"),
+		)
+		res, err := c.Read()
+		ok(t, err)
+		equals(t, proto.Int(1), res)
+		// the connection is closed after a session
+		_, err = c.Read()
+		assert(t, err != nil, "closed connection")
+
+		s.CheckGet(t, "foo", "bar")
+	})
+
+	t.Run("yes", func(t *testing.T) {
+		c, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c.Close()
+
+		mustOK(t, c, "SCRIPT", "DEBUG", "YES")
+		mustDo(t, c,
+			"EVAL", "redis.call('SET', 'foo', 'changed')\nredis.breakpoint()\nreturn redis.call('GET', 'foo')", "0",
+			logs("* Stopped at 1, stop reason = step over", "-> 1   redis.call('SET', 'foo', 'changed')"),
+		)
+		mustDo(t, c,
+			"c",
+			logs("* Stopped at 3, stop reason = redis.breakpoint() called", "-> 3   return redis.call('GET', 'foo')"),
+		)
+		mustDo(t, c,
+			"c",
+			logs("<endsession>"),
+		)
+		res, err := c.Read()
+		ok(t, err)
+		equals(t, proto.String("changed"), res)
+
+		// rolled back
+		s.CheckGet(t, "foo", "bar")
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		c, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c.Close()
+
+		mustOK(t, c, "SCRIPT", "DEBUG", "SYNC")
+		mustDo(t, c,
+			"EVAL", "return 1", "0",
+			logs("* Stopped at 1, stop reason = step over", "-> 1   return 1"),
+		)
+		mustDo(t, c,
+			"a",
+			logs("<endsession>"),
+		)
+		res, err := c.Read()
+		ok(t, err)
+		assert(t, strings.Contains(res, "script aborted for user request"), "abort error")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		c, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c.Close()
+
+		mustDo(t, c,
+			"SCRIPT", "DEBUG", "FOO",
+			proto.Error(msgDebugUsage),
+		)
+		mustDo(t, c,
+			"SCRIPT", "DEBUG",
+			proto.Error("ERR unknown subcommand or wrong number of arguments for 'DEBUG'. Try SCRIPT HELP."),
+		)
+		mustOK(t, c, "MULTI")
+		mustDo(t, c, "SCRIPT", "DEBUG", "YES", proto.Inline("QUEUED"))
+		mustDo(t, c, "EXEC", proto.Array(proto.Error(msgDebugMulti)))
+
+		mustOK(t, c, "SCRIPT", "DEBUG", "YES")
+		mustDo(t, c,
+			"EVALSHA", "1fa00e76656cc152ad327c13fe365858fd7be306", "0",
+			proto.Error(msgDebugEvalsha),
+		)
+		mustOK(t, c, "SCRIPT", "DEBUG", "NO")
+		mustDo(t, c,
+			"EVAL", "return 1", "0",
+			proto.Int(1),
+		)
+	})
+}
+
+func TestScriptKill(t *testing.T) {
+	s, c := runWithClient(t)
+	c2, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c2.Close()
+
+	mustDo(t, c, "SCRIPT", "KILL", proto.Error(msgNotBusy))
+	mustDo(t, c, "FUNCTION", "KILL", proto.Error(msgNotBusy))
+
+	// run runs a command on c2 in the background
+	run := func(args ...string) chan string {
+		done := make(chan string, 1)
+		go func() {
+			res, err := c2.Do(args...)
+			ok(t, err)
+			done <- res
+		}()
+		return done
+	}
+
+	t.Run("SCRIPT KILL", func(t *testing.T) {
+		s.SetBusyScriptTime(50 * time.Millisecond)
+		done := run("EVAL", "while true do end", "0")
+		time.Sleep(100 * time.Millisecond)
+		mustDo(t, c, "PING", proto.Error(msgBusy))
+		mustDo(t, c, "FUNCTION", "KILL", proto.Error(msgBusy))
+		mustOK(t, c, "SCRIPT", "KILL")
+		equals(t, proto.Error(msgScriptKilled), <-done)
+		mustDo(t, c, "PING", proto.Inline("PONG"))
+	})
+
+	t.Run("before busy", func(t *testing.T) {
+		s.SetBusyScriptTime(50 * time.Millisecond)
+		done := run("EVAL", "while true do end", "0")
+		time.Sleep(10 * time.Millisecond)
+		// waits until the script is busy
+		mustDo(t, c, "GET", "foo", proto.Error(msgBusy))
+		mustOK(t, c, "SCRIPT", "KILL")
+		equals(t, proto.Error(msgScriptKilled), <-done)
+	})
+
+	t.Run("no writes", func(t *testing.T) {
+		s.SetBusyScriptTime(0)
+		// PING is not a write, so this can be killed
+		done := run("EVAL", "while true do redis.call('PING') end", "0")
+		waitBusy(t, c, msgBusy)
+		mustOK(t, c, "SCRIPT", "KILL")
+		equals(t, proto.Error(msgScriptKilled), <-done)
+	})
+
+	t.Run("FUNCTION KILL", func(t *testing.T) {
+		s.SetBusyScriptTime(0)
+		mustDo(t, c,
+			"FUNCTION", "LOAD", "#!lua name=loop\nredis.register_function('loop', function() while true do end end)",
+			proto.String("loop"),
+		)
+		done := run("FCALL", "loop", "0")
+		waitBusy(t, c, msgBusyFunction)
+		mustDo(t, c, "SCRIPT", "KILL", proto.Error(msgBusyFunction))
+		mustOK(t, c, "FUNCTION", "KILL")
+		equals(t, proto.Error(msgFunctionKilled), <-done)
+	})
+
+	t.Run("UNKILLABLE", func(t *testing.T) {
+		s.SetBusyScriptTime(0)
+		// writes, and then runs for 200ms
+		done := run("EVAL", `
+redis.call('SET', KEYS[1], 'bar')
+local t = redis.call('TIME')
+local stop = t[1] * 1000000 + t[2] + 200000
+while true do
+  t = redis.call('TIME')
+  if t[1] * 1000000 + t[2] > stop then break end
+end
+return 'done'`, "1", "foo")
+		waitBusy(t, c, msgBusy)
+		mustDo(t, c, "SCRIPT", "KILL", proto.Error(msgUnkillable))
+		equals(t, proto.String("done"), <-done)
+		mustDo(t, c, "GET", "foo", proto.String("bar"))
+	})
+}
+
+// waitBusy waits until a script makes other clients get a BUSY error.
+func waitBusy(t *testing.T, c *proto.Client, msg string) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		res, err := c.Do("PING")
+		ok(t, err)
+		if res == proto.Error(msg) {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("not busy")
+}
+
+func TestLuaLibraries(t *testing.T) {
+	_, c := runWithClient(t)
+
+	t.Run("redis", func(t *testing.T) {
+		mustDo(t, c,
+			"EVAL", "return {redis.REDIS_VERSION, redis.REDIS_VERSION_NUM, redis.LOG_WARNING, redis.REPL_ALL}", "0",
+			proto.Array(
+				proto.String("8.4.0"),
+				proto.Int(0x080400),
+				proto.Int(3),
+				proto.Int(3),
+			),
+		)
+		must1(t, c, "EVAL", "return redis.acl_check_cmd('get', 'foo')", "0")
+		mustContain(t, c,
+			"EVAL", "return redis.acl_check_cmd('nosuch')", "0",
+			"Invalid command passed to redis.acl_check_cmd()",
+		)
+		mustNil(t, c, "EVAL", "return redis.breakpoint()", "0")
+	})
+
+	t.Run("bit", func(t *testing.T) {
+		mustDo(t, c,
+			"EVAL", `return {
+				bit.band(5, 3),
+				bit.bor(5, 3, 8),
+				bit.bxor(1, 3),
+				bit.bnot(0),
+				bit.lshift(1, 31),
+				bit.rshift(-1, 28),
+				bit.arshift(-256, 4),
+				bit.rol(0x12345678, 4),
+				bit.ror(0x12345678, 4),
+				bit.bswap(0x12345678),
+				bit.tobit(0xffffffff),
+				bit.tohex(255),
+				bit.tohex(-1, -4),
+			}`, "0",
+			proto.Array(
+				proto.Int(1),
+				proto.Int(15),
+				proto.Int(2),
+				proto.Int(-1),
+				proto.Int(-2147483648),
+				proto.Int(15),
+				proto.Int(-16),
+				proto.Int(0x23456781),
+				proto.Int(-2128394905), // 0x81234567
+				proto.Int(0x78563412),
+				proto.Int(-1),
+				proto.String("000000ff"),
+				proto.String("FFFF"),
+			),
+		)
+	})
+
+	t.Run("struct", func(t *testing.T) {
+		mustDo(t, c,
+			"EVAL", "return struct.pack('>I2<h', 258, -2)", "0",
+			proto.String("\x01\x02\xfe\xff"),
+		)
+		mustDo(t, c,
+			"EVAL", "return {struct.unpack('<i4d', struct.pack('<i4d', -5, 2.0))}", "0",
+			proto.Ints(-5, 2, 13),
+		)
+		mustDo(t, c,
+			"EVAL", "return {struct.unpack('B c0 s', struct.pack('B c0 s', 3, 'foo', 'bar'))}", "0",
+			proto.Array(proto.String("foo"), proto.String("bar"), proto.Int(9)),
+		)
+		mustDo(t, c,
+			"EVAL", "return {struct.size('!4 b i4'), struct.size('b i4')}", "0",
+			proto.Ints(8, 5),
+		)
+		mustContain(t, c,
+			"EVAL", "return struct.pack('y', 1)", "0",
+			"invalid format option 'y'",
+		)
+		mustContain(t, c,
+			"EVAL", "return struct.unpack('i4', 'ab')", "0",
+			"data string too short",
+		)
+	})
+
+	t.Run("cmsgpack", func(t *testing.T) {
+		mustDo(t, c,
+			"EVAL", "return cmsgpack.pack(1, 'a', {1, 2}, true, nil, -1, 300, {a='b'})", "0",
+			proto.String("\x01\xa1a\x92\x01\x02\xc3\xc0\xff\xcd\x01\x2c\x81\xa1a\xa1b"),
+		)
+		mustDo(t, c,
+			"EVAL", "local t = cmsgpack.unpack(cmsgpack.pack({1, 'two', {a='b'}, -300})); return {t[1], t[2], t[3].a, t[4]}", "0",
+			proto.Array(proto.Int(1), proto.String("two"), proto.String("b"), proto.Int(-300)),
+		)
+		mustDo(t, c,
+			"EVAL", "return {cmsgpack.unpack_one(cmsgpack.pack(1, 2))}", "0",
+			proto.Ints(1, 1),
+		)
+		mustDo(t, c,
+			"EVAL", "return {cmsgpack.unpack_limit(cmsgpack.pack(1, 2), 2)}", "0",
+			proto.Ints(-1, 1, 2),
+		)
+		mustContain(t, c,
+			"EVAL", "return cmsgpack.unpack('\\193')", "0",
+			"Bad data format in input.",
+		)
+		mustContain(t, c,
+			"EVAL", "return cmsgpack.unpack('\\205')", "0",
+			"Missing bytes in input.",
+		)
+	})
+}
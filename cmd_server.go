@@ -14,11 +14,35 @@ import (
 func commandsServer(m *Miniredis) {
 	m.srv.Register("COMMAND", m.cmdCommand)
 	m.srv.Register("DBSIZE", m.cmdDbsize, server.ReadOnlyOption())
-	m.srv.Register("FLUSHALL", m.cmdFlushall)
-	m.srv.Register("FLUSHDB", m.cmdFlushdb)
+	m.srv.Register("FLUSHALL", m.cmdFlushall, server.WriteOption())
+	m.srv.Register("FLUSHDB", m.cmdFlushdb, server.WriteOption())
 	m.srv.Register("INFO", m.cmdInfo)
 	m.srv.Register("TIME", m.cmdTime)
 	m.srv.Register("MEMORY", m.cmdMemory)
+	m.srv.Register("MONITOR", m.cmdMonitor)
+	m.srv.Register("SLOWLOG", m.cmdSlowlog)
+	m.srv.Register("LATENCY", m.cmdLatency)
+	m.srv.Register("LOLWUT", m.cmdLolwut, server.ReadOnlyOption())
+}
+
+// MONITOR
+func (m *Miniredis) cmdMonitor(c *server.Peer, cmd string, args []string) {
+	if !m.isValidCMD(c, cmd, args, exactly(0)) {
+		return
+	}
+	if ctx := getCtx(c); ctx.nested {
+		c.WriteError(msgNotFromScripts(ctx.nestedSHA))
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		if inTx(ctx) {
+			c.WriteError("ERR MONITOR isn't allowed for DENY BLOCKING client")
+			return
+		}
+		c.WriteOK()
+		m.addMonitor(c)
+	})
 }
 
 // MEMORY
@@ -75,6 +99,144 @@ func (m *Miniredis) cmdMemory(c *server.Peer, cmd string, args []string) {
 	})
 }
 
+// SLOWLOG
+func (m *Miniredis) cmdSlowlog(c *server.Peer, cmd string, args []string) {
+	if !m.isValidCMD(c, cmd, args, atLeast(1)) {
+		return
+	}
+
+	cmd, sub, args := args[0], strings.ToLower(args[0]), args[1:]
+	count := 10
+	switch sub {
+	case "get":
+		if len(args) > 1 {
+			setDirty(c)
+			c.WriteError(errWrongNumber("slowlog|get"))
+			return
+		}
+		if len(args) == 1 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < -1 {
+				setDirty(c)
+				c.WriteError("ERR count should be greater than or equal to -1")
+				return
+			}
+			count = n
+		}
+	case "len", "reset":
+		if len(args) > 0 {
+			setDirty(c)
+			c.WriteError(errWrongNumber("slowlog|" + sub))
+			return
+		}
+	default:
+		setDirty(c)
+		c.WriteError(fmt.Sprintf("ERR unknown subcommand '%s'. Try SLOWLOG HELP.", cmd))
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		switch sub {
+		case "get":
+			entries := m.slowlog.entries
+			if count >= 0 && count < len(entries) {
+				entries = entries[:count]
+			}
+			c.WriteLen(len(entries))
+			for _, e := range entries {
+				c.WriteLen(6)
+				c.WriteInt(e.id)
+				c.WriteInt(int(e.time.Unix()))
+				c.WriteInt(int(e.duration.Microseconds()))
+				c.WriteStrings(e.cmd)
+				c.WriteBulk(e.addr)
+				c.WriteBulk(e.name)
+			}
+		case "len":
+			c.WriteInt(len(m.slowlog.entries))
+		case "reset":
+			m.slowlog.entries = nil
+			c.WriteOK()
+		}
+	})
+}
+
+// LATENCY
+func (m *Miniredis) cmdLatency(c *server.Peer, cmd string, args []string) {
+	if !m.isValidCMD(c, cmd, args, atLeast(1)) {
+		return
+	}
+
+	cmd, sub, args := args[0], strings.ToLower(args[0]), args[1:]
+	switch sub {
+	case "latest", "doctor":
+		if len(args) > 0 {
+			setDirty(c)
+			c.WriteError(errWrongNumber("latency|" + sub))
+			return
+		}
+	case "history":
+		if len(args) != 1 {
+			setDirty(c)
+			c.WriteError(errWrongNumber("latency|history"))
+			return
+		}
+	case "reset":
+	default:
+		setDirty(c)
+		c.WriteError(fmt.Sprintf("ERR unknown subcommand '%s'. Try LATENCY HELP.", cmd))
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		l := &m.latency
+		switch sub {
+		case "latest":
+			names := l.names()
+			c.WriteLen(len(names))
+			for _, name := range names {
+				ev := l.events[name]
+				last := ev.samples[len(ev.samples)-1]
+				c.WriteLen(4)
+				c.WriteBulk(name)
+				c.WriteInt(int(last.time.Unix()))
+				c.WriteInt(int(last.latency.Milliseconds()))
+				c.WriteInt(int(ev.max.Milliseconds()))
+			}
+		case "history":
+			ev, ok := l.events[strings.ToLower(args[0])]
+			if !ok {
+				c.WriteLen(0)
+				return
+			}
+			c.WriteLen(len(ev.samples))
+			for _, s := range ev.samples {
+				c.WriteLen(2)
+				c.WriteInt(int(s.time.Unix()))
+				c.WriteInt(int(s.latency.Milliseconds()))
+			}
+		case "reset":
+			if len(args) == 0 {
+				n := len(l.events)
+				l.events = map[string]*latencyEvents{}
+				c.WriteInt(n)
+				return
+			}
+			n := 0
+			for _, name := range args {
+				name = strings.ToLower(name)
+				if _, ok := l.events[name]; ok {
+					delete(l.events, name)
+					n++
+				}
+			}
+			c.WriteInt(n)
+		case "doctor":
+			c.WriteVerbatim("txt", l.doctor())
+		}
+	})
+}
+
 // DBSIZE
 func (m *Miniredis) cmdDbsize(c *server.Peer, cmd string, args []string) {
 	if !m.isValidCMD(c, cmd, args, exactly(0)) {
@@ -130,6 +292,7 @@ func (m *Miniredis) cmdFlushdb(c *server.Peer, cmd string, args []string) {
 
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
 		m.db(ctx.selectedDB).flush()
+		m.trackingInvalidateAll()
 		c.WriteOK()
 	})
 }
@@ -151,3 +314,21 @@ func (m *Miniredis) cmdTime(c *server.Peer, cmd string, args []string) {
 		c.WriteBulk(strconv.FormatInt(microseconds, 10))
 	})
 }
+
+// LOLWUT
+// There is no art, we always give the text Redis gives for unknown versions.
+func (m *Miniredis) cmdLolwut(c *server.Peer, cmd string, args []string) {
+	if !m.isValidCMD(c, cmd, args, atLeast(0)) {
+		return
+	}
+	if len(args) >= 2 && strings.ToLower(args[0]) == "version" {
+		var version int
+		if ok := optInt(c, args[1], &version); !ok {
+			return
+		}
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		c.WriteVerbatim("txt", fmt.Sprintf("Redis ver. %s\n", redisVersion))
+	})
+}
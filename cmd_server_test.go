@@ -1,6 +1,9 @@
 package miniredis
 
 import (
+	"bufio"
+	"net"
+	"strings"
 	"testing"
 	"time"
 
@@ -149,3 +152,343 @@ func TestCmdServerMemoryUsageLowerCase(t *testing.T) {
 		proto.Int(19),
 	)
 }
+
+func TestCmdServerMonitor(t *testing.T) {
+	s, c := runWithClient(t)
+	c2, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c2.Close()
+	mustDo(t, c2, "PING", proto.Inline("PONG"))
+	addr := s.Clients()[1].Addr
+
+	events := s.Monitor()
+	mustOK(t, c, "MONITOR")
+
+	// reads a line, without the timestamp
+	read := func(t *testing.T) string {
+		t.Helper()
+		res, err := c.Read()
+		ok(t, err)
+		assert(t, strings.HasPrefix(res, "+"), "not an inline string: %q", res)
+		line := strings.TrimSuffix(res[1:], "\r\n")
+		return strings.SplitN(line, " ", 2)[1]
+	}
+
+	mustOK(t, c2, "SET", "foo", "bar\n\"baz\"")
+	equals(t, `[0 `+addr+`] "SET" "foo" "bar\n\"baz\""`, read(t))
+
+	mustOK(t, c2, "SELECT", "2")
+	equals(t, `[2 `+addr+`] "SELECT" "2"`, read(t))
+
+	mustOK(t, c2, "MULTI")
+	mustDo(t, c2, "incr", "n", proto.Inline("QUEUED"))
+	mustDo(t, c2, "EXEC", proto.Array(proto.Int(1)))
+	equals(t, `[2 `+addr+`] "MULTI"`, read(t))
+	equals(t, `[2 `+addr+`] "incr" "n"`, read(t))
+	equals(t, `[2 `+addr+`] "EXEC"`, read(t))
+
+	mustDo(t, c2, "EVAL", "return redis.call('GET', 'foo')", "0", proto.Nil)
+	equals(t, `[2 lua] "GET" "foo"`, read(t))
+	equals(t, `[2 `+addr+`] "EVAL" "return redis.call('GET', 'foo')" "0"`, read(t))
+
+	mustContain(t, c2, "AUTH", "secret", "without any password")
+	equals(t, `[2 `+addr+`] "AUTH" "(redacted)"`, read(t))
+
+	var cmds []string
+	for i := 0; i < 7; i++ {
+		ev := <-events
+		cmds = append(cmds, strings.Join(ev.Cmd, " "))
+	}
+	equals(t,
+		[]string{
+			"SET foo bar\n\"baz\"",
+			"SELECT 2",
+			"MULTI",
+			"incr n",
+			"EXEC",
+			"GET foo",
+			"EVAL return redis.call('GET', 'foo') 0",
+		},
+		cmds,
+	)
+	ev := <-events
+	equals(t, 2, ev.DB)
+	equals(t, addr, ev.Addr)
+
+	t.Run("errors", func(t *testing.T) {
+		mustDo(t, c2, "MONITOR", "foo",
+			proto.Error(errWrongNumber("monitor")),
+		)
+		mustOK(t, c2, "MULTI")
+		mustDo(t, c2, "MONITOR", proto.Inline("QUEUED"))
+		mustDo(t, c2, "EXEC",
+			proto.Array(proto.Error("ERR MONITOR isn't allowed for DENY BLOCKING client")),
+		)
+		mustContain(t, c2, "EVAL", "return redis.call('MONITOR')", "0", "not allowed from script")
+	})
+
+	s.Close()
+	_, open := <-events
+	for open {
+		_, open = <-events
+	}
+}
+
+func TestCmdServerSlowlog(t *testing.T) {
+	s, c := runWithClient(t)
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.SetTime(now)
+	mustOK(t, c, "CLIENT", "SETNAME", "tester")
+	addr := s.Clients()[0].Addr
+
+	must0(t, c, "SLOWLOG", "LEN")
+
+	s.SetSlowlogDuration("get", 20*time.Millisecond)
+	mustOK(t, c, "SET", "foo", "bar")
+	mustDo(t, c, "GET", "foo", proto.String("bar"))
+	must1(t, c, "SLOWLOG", "LEN")
+	mustDo(t, c, "SLOWLOG", "GET",
+		proto.Array(
+			proto.Array(
+				proto.Int(0),
+				proto.Int(int(now.Unix())),
+				proto.Int(20000),
+				proto.Strings("GET", "foo"),
+				proto.String(addr),
+				proto.String("tester"),
+			),
+		),
+	)
+
+	t.Run("transaction", func(t *testing.T) {
+		mustOK(t, c, "SLOWLOG", "RESET")
+		mustOK(t, c, "MULTI")
+		mustDo(t, c, "GET", "foo", proto.Inline("QUEUED"))
+		mustDo(t, c, "EXEC", proto.Array(proto.String("bar")))
+		mustDo(t, c, "SLOWLOG", "GET",
+			proto.Array(
+				proto.Array(
+					proto.Int(1),
+					proto.Int(int(now.Unix())),
+					proto.Int(20000),
+					proto.Strings("GET", "foo"),
+					proto.String(addr),
+					proto.String("tester"),
+				),
+			),
+		)
+	})
+
+	t.Run("long commands", func(t *testing.T) {
+		mustOK(t, c, "SLOWLOG", "RESET")
+		s.SetSlowlogDuration("MGET", time.Second)
+		args := []string{"MGET"}
+		for i := 0; i < 40; i++ {
+			args = append(args, strings.Repeat("k", 130))
+		}
+		_, err := c.Do(args...)
+		ok(t, err)
+
+		logged := []string{"MGET"}
+		for i := 0; i < 30; i++ {
+			logged = append(logged, strings.Repeat("k", 128)+"... (2 more bytes)")
+		}
+		logged = append(logged, "... (10 more arguments)")
+		mustDo(t, c, "SLOWLOG", "GET",
+			proto.Array(
+				proto.Array(
+					proto.Int(2),
+					proto.Int(int(now.Unix())),
+					proto.Int(1000000),
+					proto.Strings(logged...),
+					proto.String(addr),
+					proto.String("tester"),
+				),
+			),
+		)
+	})
+
+	t.Run("config", func(t *testing.T) {
+		s.SetSlowlog(time.Millisecond, 2)
+		s.SetSlowlogDuration("SET", time.Millisecond)
+		mustOK(t, c, "SLOWLOG", "RESET")
+		mustOK(t, c, "SET", "a", "1")
+		mustOK(t, c, "SET", "b", "2")
+		mustOK(t, c, "SET", "c", "3")
+		mustDo(t, c, "SLOWLOG", "LEN", proto.Int(2))
+		mustDo(t, c, "SLOWLOG", "GET", "1",
+			proto.Array(
+				proto.Array(
+					proto.Int(5),
+					proto.Int(int(now.Unix())),
+					proto.Int(1000),
+					proto.Strings("SET", "c", "3"),
+					proto.String(addr),
+					proto.String("tester"),
+				),
+			),
+		)
+
+		s.SetSlowlog(-1, 128)
+		mustOK(t, c, "SLOWLOG", "RESET")
+		mustDo(t, c, "GET", "foo", proto.String("bar"))
+		must0(t, c, "SLOWLOG", "LEN")
+		s.SetSlowlog(10*time.Millisecond, 128)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		mustDo(t, c, "SLOWLOG",
+			proto.Error("ERR wrong number of arguments for 'slowlog' command"),
+		)
+		mustDo(t, c, "SLOWLOG", "GET", "-2",
+			proto.Error("ERR count should be greater than or equal to -1"),
+		)
+		mustDo(t, c, "SLOWLOG", "GET", "foo",
+			proto.Error("ERR count should be greater than or equal to -1"),
+		)
+		mustDo(t, c, "SLOWLOG", "GET", "1", "2",
+			proto.Error("ERR wrong number of arguments for 'slowlog|get' command"),
+		)
+		mustDo(t, c, "SLOWLOG", "LEN", "1",
+			proto.Error("ERR wrong number of arguments for 'slowlog|len' command"),
+		)
+		mustDo(t, c, "SLOWLOG", "foo",
+			proto.Error("ERR unknown subcommand 'foo'. Try SLOWLOG HELP."),
+		)
+	})
+}
+
+func TestCmdServerLatency(t *testing.T) {
+	s, c := runWithClient(t)
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.SetTime(now)
+
+	mustDo(t, c, "LATENCY", "LATEST", proto.Array())
+	mustContain(t, c, "LATENCY", "DOCTOR", "no latency spike was observed")
+
+	s.HSet("user:1", "name", "alice")
+	s.HSet("group:1", "name", "admins")
+	s.SetLatency("hgetall", "user:*", 100*time.Millisecond)
+
+	t.Run("delay", func(t *testing.T) {
+		start := time.Now()
+		mustDo(t, c, "HGETALL", "user:1", proto.Strings("name", "alice"))
+		took := time.Since(start)
+		assert(t, took >= 100*time.Millisecond, "too fast: %s", took)
+
+		start = time.Now()
+		mustDo(t, c, "HGETALL", "group:1", proto.Strings("name", "admins"))
+		took = time.Since(start)
+		assert(t, took < 100*time.Millisecond, "too slow: %s", took)
+	})
+
+	t.Run("other clients", func(t *testing.T) {
+		c2, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c2.Close()
+
+		done := make(chan time.Duration)
+		go func() {
+			start := time.Now()
+			c.Do("HGETALL", "user:1")
+			done <- time.Since(start)
+		}()
+		time.Sleep(10 * time.Millisecond)
+		start := time.Now()
+		mustDo(t, c2, "HGET", "user:1", "name", proto.String("alice"))
+		took := time.Since(start)
+		assert(t, took < 50*time.Millisecond, "blocked by the delay: %s", took)
+		<-done
+	})
+
+	t.Run("transaction", func(t *testing.T) {
+		mustOK(t, c, "MULTI")
+		mustDo(t, c, "HGETALL", "user:1", proto.Inline("QUEUED"))
+		start := time.Now()
+		mustDo(t, c, "EXEC", proto.Array(proto.Strings("name", "alice")))
+		took := time.Since(start)
+		assert(t, took >= 100*time.Millisecond, "too fast: %s", took)
+	})
+
+	t.Run("big reply", func(t *testing.T) {
+		big := strings.Repeat("x", 100000)
+		s.HSet("user:big", "name", big)
+		conn, err := net.Dial("tcp", s.Addr())
+		ok(t, err)
+		defer conn.Close()
+
+		start := time.Now()
+		ok(t, proto.Write(conn, []string{"HGETALL", "user:big"}))
+		r := bufio.NewReader(conn)
+		_, err = r.ReadByte()
+		ok(t, err)
+		took := time.Since(start)
+		assert(t, took >= 100*time.Millisecond, "too fast: %s", took)
+		r.UnreadByte()
+		res, err := proto.Read(r)
+		ok(t, err)
+		equals(t, proto.Strings("name", big), res)
+		s.Del("user:big")
+	})
+
+	t.Run("report", func(t *testing.T) {
+		mustDo(t, c, "LATENCY", "LATEST",
+			proto.Array(
+				proto.Array(
+					proto.String("command"),
+					proto.Int(int(now.Unix())),
+					proto.Int(100),
+					proto.Int(100),
+				),
+			),
+		)
+		mustDo(t, c, "LATENCY", "HISTORY", "command",
+			proto.Array(
+				proto.Array(
+					proto.Int(int(now.Unix())),
+					proto.Int(100),
+				),
+			),
+		)
+		mustDo(t, c, "LATENCY", "HISTORY", "nosuch", proto.Array())
+		mustContain(t, c, "LATENCY", "DOCTOR", "1. command: 1 latency spikes")
+		must0(t, c, "LATENCY", "RESET", "nosuch")
+		must1(t, c, "LATENCY", "RESET")
+		mustDo(t, c, "LATENCY", "LATEST", proto.Array())
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		s.SetLatency("hgetall", "user:*", 0)
+		start := time.Now()
+		mustDo(t, c, "HGETALL", "user:1", proto.Strings("name", "alice"))
+		took := time.Since(start)
+		assert(t, took < 100*time.Millisecond, "too slow: %s", took)
+		mustDo(t, c, "LATENCY", "LATEST", proto.Array())
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		mustDo(t, c, "LATENCY",
+			proto.Error("ERR wrong number of arguments for 'latency' command"),
+		)
+		mustDo(t, c, "LATENCY", "LATEST", "foo",
+			proto.Error("ERR wrong number of arguments for 'latency|latest' command"),
+		)
+		mustDo(t, c, "LATENCY", "HISTORY",
+			proto.Error("ERR wrong number of arguments for 'latency|history' command"),
+		)
+		mustDo(t, c, "LATENCY", "foo",
+			proto.Error("ERR unknown subcommand 'foo'. Try LATENCY HELP."),
+		)
+	})
+}
+
+func TestCmdServerLolwut(t *testing.T) {
+	_, c := runWithClient(t)
+
+	mustDo(t, c, "LOLWUT", proto.String("Redis ver. 8.4.0\n"))
+	mustDo(t, c, "LOLWUT", "VERSION", "1", proto.String("Redis ver. 8.4.0\n"))
+	mustDo(t, c, "LOLWUT", "VERSION", "foo", proto.Error(msgInvalidInt))
+
+	useRESP3(t, c)
+	mustDo(t, c, "LOLWUT", proto.Verbatim("Redis ver. 8.4.0\n"))
+}
@@ -12,22 +12,22 @@ import (
 
 // commandsSet handles all set value operations.
 func commandsSet(m *Miniredis) {
-	m.srv.Register("SADD", m.cmdSadd)
+	m.srv.Register("SADD", m.cmdSadd, server.WriteOption())
 	m.srv.Register("SCARD", m.cmdScard, server.ReadOnlyOption())
 	m.srv.Register("SDIFF", m.cmdSdiff, server.ReadOnlyOption())
-	m.srv.Register("SDIFFSTORE", m.cmdSdiffstore)
+	m.srv.Register("SDIFFSTORE", m.cmdSdiffstore, server.WriteOption())
 	m.srv.Register("SINTERCARD", m.cmdSintercard, server.ReadOnlyOption())
 	m.srv.Register("SINTER", m.cmdSinter, server.ReadOnlyOption())
-	m.srv.Register("SINTERSTORE", m.cmdSinterstore)
+	m.srv.Register("SINTERSTORE", m.cmdSinterstore, server.WriteOption())
 	m.srv.Register("SISMEMBER", m.cmdSismember, server.ReadOnlyOption())
 	m.srv.Register("SMEMBERS", m.cmdSmembers, server.ReadOnlyOption())
 	m.srv.Register("SMISMEMBER", m.cmdSmismember, server.ReadOnlyOption())
-	m.srv.Register("SMOVE", m.cmdSmove)
-	m.srv.Register("SPOP", m.cmdSpop)
+	m.srv.Register("SMOVE", m.cmdSmove, server.WriteOption())
+	m.srv.Register("SPOP", m.cmdSpop, server.WriteOption())
 	m.srv.Register("SRANDMEMBER", m.cmdSrandmember, server.ReadOnlyOption())
-	m.srv.Register("SREM", m.cmdSrem)
+	m.srv.Register("SREM", m.cmdSrem, server.WriteOption())
 	m.srv.Register("SUNION", m.cmdSunion, server.ReadOnlyOption())
-	m.srv.Register("SUNIONSTORE", m.cmdSunionstore)
+	m.srv.Register("SUNIONSTORE", m.cmdSunionstore, server.WriteOption())
 	m.srv.Register("SSCAN", m.cmdSscan, server.ReadOnlyOption())
 }
 
@@ -142,7 +142,7 @@ func (m *Miniredis) cmdSinter(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		c.WriteLen(len(set))
+		c.WriteSetLen(len(set))
 		for k := range set {
 			c.WriteBulk(k)
 		}
@@ -411,7 +411,7 @@ func (m *Miniredis) cmdSpop(c *server.Peer, cmd string, args []string) {
 				c.WriteNull()
 				return
 			}
-			c.WriteLen(0)
+			c.WriteSetLen(0)
 			return
 		}
 
@@ -441,8 +441,8 @@ func (m *Miniredis) cmdSpop(c *server.Peer, cmd string, args []string) {
 			c.WriteBulk(deleted[0])
 			return
 		}
-		// with `count` return a list
-		c.WriteLen(len(deleted))
+		// with `count` return a set
+		c.WriteSetLen(len(deleted))
 		for _, v := range deleted {
 			c.WriteBulk(v)
 		}
@@ -562,7 +562,7 @@ func (m *Miniredis) cmdSunion(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		c.WriteLen(len(set))
+		c.WriteSetLen(len(set))
 		for k := range set {
 			c.WriteBulk(k)
 		}
@@ -344,6 +344,19 @@ func TestSpop(t *testing.T) {
 			proto.Error(msgOutOfRange),
 		)
 	})
+
+	useRESP3(t, c)
+	t.Run("RESP3", func(t *testing.T) {
+		s.SetAdd("single", "aap")
+		mustDo(t, c,
+			"SPOP", "single", "2",
+			proto.StringSet("aap"),
+		)
+		mustDo(t, c,
+			"SPOP", "nosuch", "2",
+			proto.Set(),
+		)
+	})
 }
 
 // Test SRANDMEMBER
@@ -571,6 +584,19 @@ func TestSinter(t *testing.T) {
 			proto.Error(msgWrongType),
 		)
 	})
+
+	useRESP3(t, c)
+	t.Run("RESP3", func(t *testing.T) {
+		mustDo(t, c,
+			"SINTER", "s1", "s2", "s3",
+			proto.StringSet("mies"),
+		)
+		s.SetAdd("one", "wim")
+		mustDo(t, c,
+			"SUNION", "s9", "one",
+			proto.StringSet("wim"),
+		)
+	})
 }
 
 // Test SINTERSTORE
@@ -10,26 +10,27 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/alicebob/miniredis/v2/fpconv"
 	"github.com/alicebob/miniredis/v2/server"
 )
 
 // commandsSortedSet handles all sorted set operations.
 func commandsSortedSet(m *Miniredis) {
-	m.srv.Register("ZADD", m.cmdZadd)
+	m.srv.Register("ZADD", m.cmdZadd, server.WriteOption())
 	m.srv.Register("ZCARD", m.cmdZcard, server.ReadOnlyOption())
 	m.srv.Register("ZCOUNT", m.cmdZcount, server.ReadOnlyOption())
-	m.srv.Register("ZINCRBY", m.cmdZincrby)
+	m.srv.Register("ZINCRBY", m.cmdZincrby, server.WriteOption())
 	m.srv.Register("ZINTER", m.makeCmdZinter(false), server.ReadOnlyOption())
-	m.srv.Register("ZINTERSTORE", m.makeCmdZinter(true))
+	m.srv.Register("ZINTERSTORE", m.makeCmdZinter(true), server.WriteOption())
 	m.srv.Register("ZLEXCOUNT", m.cmdZlexcount, server.ReadOnlyOption())
 	m.srv.Register("ZRANGE", m.cmdZrange, server.ReadOnlyOption())
 	m.srv.Register("ZRANGEBYLEX", m.makeCmdZrangebylex(false), server.ReadOnlyOption())
 	m.srv.Register("ZRANGEBYSCORE", m.makeCmdZrangebyscore(false), server.ReadOnlyOption())
 	m.srv.Register("ZRANK", m.makeCmdZrank(false), server.ReadOnlyOption())
-	m.srv.Register("ZREM", m.cmdZrem)
-	m.srv.Register("ZREMRANGEBYLEX", m.cmdZremrangebylex)
-	m.srv.Register("ZREMRANGEBYRANK", m.cmdZremrangebyrank)
-	m.srv.Register("ZREMRANGEBYSCORE", m.cmdZremrangebyscore)
+	m.srv.Register("ZREM", m.cmdZrem, server.WriteOption())
+	m.srv.Register("ZREMRANGEBYLEX", m.cmdZremrangebylex, server.WriteOption())
+	m.srv.Register("ZREMRANGEBYRANK", m.cmdZremrangebyrank, server.WriteOption())
+	m.srv.Register("ZREMRANGEBYSCORE", m.cmdZremrangebyscore, server.WriteOption())
 	m.srv.Register("ZREVRANGE", m.cmdZrevrange, server.ReadOnlyOption())
 	m.srv.Register("ZREVRANGEBYLEX", m.makeCmdZrangebylex(true), server.ReadOnlyOption())
 	m.srv.Register("ZREVRANGEBYSCORE", m.makeCmdZrangebyscore(true), server.ReadOnlyOption())
@@ -37,10 +38,10 @@ func commandsSortedSet(m *Miniredis) {
 	m.srv.Register("ZSCORE", m.cmdZscore, server.ReadOnlyOption())
 	m.srv.Register("ZMSCORE", m.cmdZMscore, server.ReadOnlyOption())
 	m.srv.Register("ZUNION", m.cmdZunion, server.ReadOnlyOption())
-	m.srv.Register("ZUNIONSTORE", m.cmdZunionstore)
+	m.srv.Register("ZUNIONSTORE", m.cmdZunionstore, server.WriteOption())
 	m.srv.Register("ZSCAN", m.cmdZscan, server.ReadOnlyOption())
-	m.srv.Register("ZPOPMAX", m.cmdZpopmax(true))
-	m.srv.Register("ZPOPMIN", m.cmdZpopmax(false))
+	m.srv.Register("ZPOPMAX", m.cmdZpopmax(true), server.WriteOption())
+	m.srv.Register("ZPOPMIN", m.cmdZpopmax(false), server.WriteOption())
 	m.srv.Register("ZRANDMEMBER", m.cmdZrandmember, server.ReadOnlyOption())
 }
 
@@ -456,16 +457,9 @@ func (m *Miniredis) makeCmdZinter(store bool) func(c *server.Peer, cmd string, a
 				return
 			}
 			// ZINTER mode
-			size := len(sset)
-			if opts.WithScores {
-				size *= 2
-			}
-			c.WriteLen(size)
+			writeScoredLen(c, len(sset), opts.WithScores)
 			for _, l := range sortedKeys(sset) {
-				c.WriteBulk(l)
-				if opts.WithScores {
-					c.WriteFloat(sset[l])
-				}
+				writeScored(c, l, sset[l], opts.WithScores)
 			}
 		})
 	}
@@ -1188,16 +1182,9 @@ func (m *Miniredis) cmdZunion(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		if withScores {
-			c.WriteLen(len(sset) * 2)
-		} else {
-			c.WriteLen(len(sset))
-		}
+		writeScoredLen(c, len(sset), withScores)
 		for _, el := range sset.byScore(asc) {
-			c.WriteBulk(el.member)
-			if withScores {
-				c.WriteFloat(el.score)
-			}
+			writeScored(c, el.member, el.score, withScores)
 		}
 	})
 }
@@ -1449,7 +1436,8 @@ func (m *Miniredis) cmdZscan(c *server.Peer, cmd string, args []string) {
 		c.WriteLen(len(members) * 2)
 		for _, k := range members {
 			c.WriteBulk(k)
-			c.WriteFloat(db.ssetScore(opts.key, k))
+			// scores are strings here, also in RESP3
+			c.WriteBulk(fpconv.Dtoa(db.ssetScore(opts.key, k)))
 		}
 	})
 }
@@ -1478,7 +1466,7 @@ func (m *Miniredis) cmdZpopmax(reverse bool) server.Cmd {
 			}
 		}
 
-		withScores := true
+		withCount := len(args) > 1
 		if len(args) > 2 {
 			c.WriteError(msgSyntaxError)
 			return
@@ -1502,14 +1490,17 @@ func (m *Miniredis) cmdZpopmax(reverse bool) server.Cmd {
 				reverseSlice(members)
 			}
 			rs, re := redisRange(len(members), 0, count-1, false)
-			if withScores {
-				c.WriteLen((re - rs) * 2)
+			if withCount {
+				writeScoredLen(c, re-rs, true)
 			} else {
-				c.WriteLen(re - rs)
+				// without a count RESP3 also gives a flat [member, score]
+				c.WriteLen((re - rs) * 2)
 			}
 			for _, el := range members[rs:re] {
-				c.WriteBulk(el)
-				if withScores {
+				if withCount {
+					writeScored(c, el, db.ssetScore(key, el), true)
+				} else {
+					c.WriteBulk(el)
 					c.WriteFloat(db.ssetScore(key, el))
 				}
 				db.ssetRem(key, el)
@@ -1599,10 +1590,9 @@ func (m *Miniredis) cmdZrandmember(c *server.Peer, cmd string, args []string) {
 			}
 		}
 		if opts.withScores {
-			c.WriteLen(len(members) * 2)
+			writeScoredLen(c, len(members), true)
 			for _, m := range members {
-				c.WriteBulk(m)
-				c.WriteFloat(db.ssetScore(opts.key, m))
+				writeScored(c, m, db.ssetScore(opts.key, m), true)
 			}
 			return
 		}
@@ -1643,16 +1633,9 @@ func runRange(m *Miniredis, c *server.Peer, cctx *connCtx, opts optsRange) {
 		reverseSlice(members)
 	}
 	rs, re := redisRange(len(members), min, max, false)
-	if opts.WithScores {
-		c.WriteLen((re - rs) * 2)
-	} else {
-		c.WriteLen(re - rs)
-	}
+	writeScoredLen(c, re-rs, opts.WithScores)
 	for _, el := range members[rs:re] {
-		c.WriteBulk(el)
-		if opts.WithScores {
-			c.WriteFloat(db.ssetScore(opts.Key, el))
-		}
+		writeScored(c, el, db.ssetScore(opts.Key, el), opts.WithScores)
 	}
 }
 
@@ -1730,16 +1713,9 @@ func runRangeByScore(m *Miniredis, c *server.Peer, cctx *connCtx, opts optsRange
 		}
 	}
 
-	if opts.WithScores {
-		c.WriteLen(len(members) * 2)
-	} else {
-		c.WriteLen(len(members))
-	}
+	writeScoredLen(c, len(members), opts.WithScores)
 	for _, el := range members {
-		c.WriteBulk(el.member)
-		if opts.WithScores {
-			c.WriteFloat(el.score)
-		}
+		writeScored(c, el.member, el.score, opts.WithScores)
 	}
 }
 
@@ -1855,3 +1831,23 @@ func sortedKeys(m map[string]float64) []string {
 	sort.Strings(keys)
 	return keys
 }
+
+// writeScoredLen starts a list of members, optionally with their scores. That's
+// a flat list in RESP2, and a list of [member, score] pairs in RESP3.
+func writeScoredLen(c *server.Peer, n int, withScores bool) {
+	if withScores && !isResp3(c) {
+		n *= 2
+	}
+	c.WriteLen(n)
+}
+
+// writeScored writes a single member of a writeScoredLen() list.
+func writeScored(c *server.Peer, member string, score float64, withScores bool) {
+	if withScores && isResp3(c) {
+		c.WriteLen(2)
+	}
+	c.WriteBulk(member)
+	if withScores {
+		c.WriteFloat(score)
+	}
+}
@@ -2256,3 +2256,71 @@ func TestSortedSetRandmember(t *testing.T) {
 		)
 	})
 }
+
+func TestSortedSetRESP3(t *testing.T) {
+	s, c := runWithClient(t)
+	useRESP3(t, c)
+
+	s.ZAdd("z", 1, "one")
+	s.ZAdd("z", 2.5, "two")
+
+	pair := func(member string, score float64) string {
+		return proto.Array(proto.String(member), proto.Float(score))
+	}
+
+	mustDo(t, c,
+		"ZRANGE", "z", "0", "-1",
+		proto.Strings("one", "two"),
+	)
+	mustDo(t, c,
+		"ZRANGE", "z", "0", "-1", "WITHSCORES",
+		proto.Array(pair("one", 1), pair("two", 2.5)),
+	)
+	mustDo(t, c,
+		"ZREVRANGEBYSCORE", "z", "+inf", "-inf", "WITHSCORES",
+		proto.Array(pair("two", 2.5), pair("one", 1)),
+	)
+	mustDo(t, c,
+		"ZUNION", "1", "z", "WITHSCORES",
+		proto.Array(pair("one", 1), pair("two", 2.5)),
+	)
+	mustDo(t, c,
+		"ZINTER", "1", "z", "WITHSCORES",
+		proto.Array(pair("one", 1), pair("two", 2.5)),
+	)
+	s.ZAdd("single", 2.5, "two")
+	mustDo(t, c,
+		"ZRANDMEMBER", "single", "-2", "WITHSCORES",
+		proto.Array(pair("two", 2.5), pair("two", 2.5)),
+	)
+	mustDo(t, c,
+		"ZSCORE", "z", "two",
+		proto.Float(2.5),
+	)
+	mustDo(t, c,
+		"ZRANK", "z", "two", "WITHSCORE",
+		proto.Array(proto.Int(1), proto.Float(2.5)),
+	)
+	mustDo(t, c,
+		"ZRANK", "z", "nosuch", "WITHSCORE",
+		proto.NilResp3,
+	)
+	// scores are strings in ZSCAN
+	mustDo(t, c,
+		"ZSCAN", "z", "0",
+		proto.Array(
+			proto.String("0"),
+			proto.Strings("one", "1", "two", "2.5"),
+		),
+	)
+
+	// without a count ZPOP* stays flat
+	mustDo(t, c,
+		"ZPOPMIN", "z",
+		proto.Array(proto.String("one"), proto.Float(1)),
+	)
+	mustDo(t, c,
+		"ZPOPMAX", "z", "1",
+		proto.Array(pair("two", 2.5)),
+	)
+}
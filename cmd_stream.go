@@ -15,20 +15,20 @@ import (
 
 // commandsStream handles all stream operations.
 func commandsStream(m *Miniredis) {
-	m.srv.Register("XADD", m.cmdXadd)
+	m.srv.Register("XADD", m.cmdXadd, server.WriteOption())
 	m.srv.Register("XLEN", m.cmdXlen, server.ReadOnlyOption())
 	m.srv.Register("XREAD", m.cmdXread, server.ReadOnlyOption())
 	m.srv.Register("XRANGE", m.makeCmdXrange(false), server.ReadOnlyOption())
 	m.srv.Register("XREVRANGE", m.makeCmdXrange(true), server.ReadOnlyOption())
-	m.srv.Register("XGROUP", m.cmdXgroup)
+	m.srv.Register("XGROUP", m.cmdXgroup, server.WriteOption())
 	m.srv.Register("XINFO", m.cmdXinfo)
-	m.srv.Register("XREADGROUP", m.cmdXreadgroup)
-	m.srv.Register("XACK", m.cmdXack)
-	m.srv.Register("XDEL", m.cmdXdel)
+	m.srv.Register("XREADGROUP", m.cmdXreadgroup, server.WriteOption())
+	m.srv.Register("XACK", m.cmdXack, server.WriteOption())
+	m.srv.Register("XDEL", m.cmdXdel, server.WriteOption())
 	m.srv.Register("XPENDING", m.cmdXpending, server.ReadOnlyOption())
-	m.srv.Register("XTRIM", m.cmdXtrim)
-	m.srv.Register("XAUTOCLAIM", m.cmdXautoclaim)
-	m.srv.Register("XCLAIM", m.cmdXclaim)
+	m.srv.Register("XTRIM", m.cmdXtrim, server.WriteOption())
+	m.srv.Register("XAUTOCLAIM", m.cmdXautoclaim, server.WriteOption())
+	m.srv.Register("XCLAIM", m.cmdXclaim, server.WriteOption())
 }
 
 // XADD
@@ -1024,13 +1024,21 @@ func writeXread(c *server.Peer, streams []string, res map[string][]StreamEntry)
 		c.WriteLen(-1)
 		return
 	}
-	c.WriteLen(len(res))
+	// RESP3 has a map of stream -> entries, RESP2 a list of pairs
+	resp3 := isResp3(c)
+	if resp3 {
+		c.WriteMapLen(len(res))
+	} else {
+		c.WriteLen(len(res))
+	}
 	for _, stream := range streams {
 		entries, ok := res[stream]
 		if !ok {
 			continue
 		}
-		c.WriteLen(2)
+		if !resp3 {
+			c.WriteLen(2)
+		}
 		c.WriteBulk(stream)
 		c.WriteLen(len(entries))
 		for _, entry := range entries {
@@ -559,6 +559,23 @@ func TestStreamRead(t *testing.T) {
 			proto.Error(msgXreadUnbalanced),
 		)
 	})
+
+	useRESP3(t, c)
+	t.Run("RESP3", func(t *testing.T) {
+		mustDo(t, c,
+			"XREAD", "STREAMS", "planets2", "3-0",
+			proto.Map(
+				proto.String("planets2"),
+				proto.Array(
+					proto.Array(proto.String("4-1"), proto.Strings("name", "Jupiter", "greek-god", "Dias", "idx", "5")),
+				),
+			),
+		)
+		mustDo(t, c,
+			"XREAD", "STREAMS", "planets2", "4-1",
+			proto.NilResp3,
+		)
+	})
 }
 
 // Test XINFO
@@ -14,31 +14,31 @@ import (
 
 // commandsString handles all string value operations.
 func commandsString(m *Miniredis) {
-	m.srv.Register("APPEND", m.cmdAppend)
+	m.srv.Register("APPEND", m.cmdAppend, server.WriteOption())
 	m.srv.Register("BITCOUNT", m.cmdBitcount, server.ReadOnlyOption())
-	m.srv.Register("BITOP", m.cmdBitop)
+	m.srv.Register("BITOP", m.cmdBitop, server.WriteOption())
 	m.srv.Register("BITPOS", m.cmdBitpos, server.ReadOnlyOption())
-	m.srv.Register("DECRBY", m.cmdDecrby)
-	m.srv.Register("DECR", m.cmdDecr)
-	m.srv.Register("DELEX", m.cmdDelex)
+	m.srv.Register("DECRBY", m.cmdDecrby, server.WriteOption())
+	m.srv.Register("DECR", m.cmdDecr, server.WriteOption())
+	m.srv.Register("DELEX", m.cmdDelex, server.WriteOption())
 	m.srv.Register("GETBIT", m.cmdGetbit, server.ReadOnlyOption())
-	m.srv.Register("GETDEL", m.cmdGetdel)
-	m.srv.Register("GETEX", m.cmdGetex)
+	m.srv.Register("GETDEL", m.cmdGetdel, server.WriteOption())
+	m.srv.Register("GETEX", m.cmdGetex, server.WriteOption())
 	m.srv.Register("GET", m.cmdGet, server.ReadOnlyOption())
 	m.srv.Register("GETRANGE", m.cmdGetrange, server.ReadOnlyOption())
-	m.srv.Register("GETSET", m.cmdGetset)
-	m.srv.Register("INCRBYFLOAT", m.cmdIncrbyfloat)
-	m.srv.Register("INCRBY", m.cmdIncrby)
-	m.srv.Register("INCR", m.cmdIncr)
+	m.srv.Register("GETSET", m.cmdGetset, server.WriteOption())
+	m.srv.Register("INCRBYFLOAT", m.cmdIncrbyfloat, server.WriteOption())
+	m.srv.Register("INCRBY", m.cmdIncrby, server.WriteOption())
+	m.srv.Register("INCR", m.cmdIncr, server.WriteOption())
 	m.srv.Register("MGET", m.cmdMget, server.ReadOnlyOption())
-	m.srv.Register("MSET", m.cmdMset)
-	m.srv.Register("MSETNX", m.cmdMsetnx)
-	m.srv.Register("PSETEX", m.cmdPsetex)
-	m.srv.Register("SETBIT", m.cmdSetbit)
-	m.srv.Register("SETEX", m.cmdSetex)
-	m.srv.Register("SET", m.cmdSet)
-	m.srv.Register("SETNX", m.cmdSetnx)
-	m.srv.Register("SETRANGE", m.cmdSetrange)
+	m.srv.Register("MSET", m.cmdMset, server.WriteOption())
+	m.srv.Register("MSETNX", m.cmdMsetnx, server.WriteOption())
+	m.srv.Register("PSETEX", m.cmdPsetex, server.WriteOption())
+	m.srv.Register("SETBIT", m.cmdSetbit, server.WriteOption())
+	m.srv.Register("SETEX", m.cmdSetex, server.WriteOption())
+	m.srv.Register("SET", m.cmdSet, server.WriteOption())
+	m.srv.Register("SETNX", m.cmdSetnx, server.WriteOption())
+	m.srv.Register("SETRANGE", m.cmdSetrange, server.WriteOption())
 	m.srv.Register("STRLEN", m.cmdStrlen, server.ReadOnlyOption())
 }
 
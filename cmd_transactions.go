@@ -9,7 +9,7 @@ import (
 // commandsTransaction handles MULTI &c.
 func commandsTransaction(m *Miniredis) {
 	m.srv.Register("DISCARD", m.cmdDiscard)
-	m.srv.Register("EXEC", m.cmdExec)
+	m.srv.Register("EXEC", m.cmdExec, server.WriteOption())
 	m.srv.Register("MULTI", m.cmdMulti)
 	m.srv.Register("UNWATCH", m.cmdUnwatch)
 	m.srv.Register("WATCH", m.cmdWatch)
@@ -61,6 +61,7 @@ func (m *Miniredis) cmdExec(c *server.Peer, cmd string, args []string) {
 
 	m.Lock()
 	defer m.Unlock()
+	m.passTime()
 
 	// Check WATCHed keys.
 	for t, version := range ctx.watch {
@@ -73,9 +74,17 @@ func (m *Miniredis) cmdExec(c *server.Peer, cmd string, args []string) {
 	}
 
 	c.WriteLen(len(ctx.transaction))
+	m.noTouch = ctx.noTouch
+	m.curPeer = c
 	for _, cb := range ctx.transaction {
 		cb(c, ctx)
 	}
+	m.noTouch = false
+	m.curPeer = nil
+	if ctx.tracking != nil {
+		ctx.tracking.caching = false
+	}
+	m.sendPendingInvalidations()
 	// wake up anyone who waits on anything.
 	m.signal.Broadcast()
 
@@ -82,6 +82,25 @@ func TestSimpleTransaction(t *testing.T) {
 	)
 }
 
+func TestPipelinedTransaction(t *testing.T) {
+	s, c := runWithClient(t)
+
+	res, err := c.Pipeline(
+		[]string{"MULTI"},
+		[]string{"SET", "aap", "1"},
+		[]string{"INCR", "aap"},
+		[]string{"EXEC"},
+	)
+	ok(t, err)
+	equals(t, []string{
+		proto.Inline("OK"),
+		proto.Inline("QUEUED"),
+		proto.Inline("QUEUED"),
+		proto.Array(proto.Inline("OK"), proto.Int(2)),
+	}, res)
+	s.CheckGet(t, "aap", "2")
+}
+
 func TestDiscardTransaction(t *testing.T) {
 	s, c := runWithClient(t)
 
@@ -18,11 +18,20 @@ var (
 func (db *RedisDB) exists(k string) bool {
 	_, ok := db.keys[k]
 	if ok {
-		db.lru[k] = db.master.effectiveNow()
+		db.touch(k)
 	}
 	return ok
 }
 
+// touch updates the lru, unless the current client is in NO-TOUCH mode. New
+// keys always get a timestamp.
+func (db *RedisDB) touch(k string) {
+	if _, ok := db.lru[k]; ok && db.master.noTouch {
+		return
+	}
+	db.lru[k] = db.master.effectiveNow()
+}
+
 // t gives the type of a key, or ""
 func (db *RedisDB) t(k string) string {
 	return db.keys[k]
@@ -30,8 +39,9 @@ func (db *RedisDB) t(k string) string {
 
 // incr increases the version and the lru timestamp
 func (db *RedisDB) incr(k string) {
-	db.lru[k] = db.master.effectiveNow()
+	db.touch(k)
 	db.keyVersion[k]++
+	db.master.trackingInvalidate(k)
 }
 
 // allKeys returns all keys. Sorted.
@@ -139,6 +149,7 @@ func (db *RedisDB) del(k string, delTTL bool) {
 	delete(db.keys, k)
 	delete(db.lru, k)
 	db.keyVersion[k]++
+	db.master.trackingInvalidate(k)
 	if delTTL {
 		delete(db.ttl, k)
 	}
@@ -742,10 +753,13 @@ func (db *RedisDB) checkHashFieldTTL(key string, duration time.Duration) {
 			// Delete the expired field
 			delete(db.hashKeys[key], field)
 			delete(fieldTTLs, field)
+			db.master.notifyKeyspaceEvent(db.id, key, "hexpired")
 
 			// If hash is now empty, delete the entire key
 			if len(db.hashKeys[key]) == 0 {
 				db.del(key, true)
+			} else {
+				db.master.trackingInvalidate(key)
 			}
 		}
 	}
@@ -754,6 +768,7 @@ func (db *RedisDB) checkHashFieldTTL(key string, duration time.Duration) {
 func (db *RedisDB) checkTTL(key string) {
 	if v, ok := db.ttl[key]; ok && v <= 0 {
 		db.del(key, true)
+		db.master.keyExpired(db.id, key)
 	}
 }
 
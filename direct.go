@@ -61,6 +61,7 @@ func (m *Miniredis) flushAll() {
 	for _, db := range m.dbs {
 		db.flush()
 	}
+	m.trackingInvalidateAll()
 }
 
 // FlushDB removes all keys from the selected database.
@@ -75,6 +76,7 @@ func (db *RedisDB) FlushDB() {
 	defer db.master.signal.Broadcast()
 
 	db.flush()
+	db.master.trackingInvalidateAll()
 }
 
 // Get returns string keys added with SET.
@@ -0,0 +1,181 @@
+package miniredis
+
+import (
+	"math/rand"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// ErrorRule makes matching commands fail. Add rules with m.InjectError().
+// Rules are checked before the command runs, for commands from clients and
+// for commands called from Lua with redis.call().
+type ErrorRule struct {
+	Cmd         string  // glob for the command name, case insensitive. "" matches every command
+	Key         string  // glob, matches if any key of the command matches. "" matches every command
+	WritesOnly  bool    // only match commands which can change data
+	Count       int     // fail this many calls, then the rule is removed. 0 is no limit
+	Probability float64 // chance a matching call fails, between 0 and 1. 0 is always. See m.Seed()
+	Error       string  // the error, without the "-". For example "LOADING Redis is loading the dataset in memory"
+}
+
+// InjectedError is an ErrorRule added with m.InjectError().
+type InjectedError struct {
+	rule  ErrorRule
+	cmdRE *regexp.Regexp
+	keyRE *regexp.Regexp
+	fired int
+	rules *errorRules
+}
+
+// errorRules has the SetError() message, the SetState() state, and the
+// InjectError() rules. This has its own lock, since commands from Lua run with
+// the main lock held.
+type errorRules struct {
+	mu    sync.Mutex
+	msg   string // SetError()
+	state State  // SetState()
+	rules []*InjectedError
+	rand  *rand.Rand // set by m.Seed()
+}
+
+// InjectError adds a rule which makes matching commands fail with an error.
+// Rules are checked in the order they were added, and the first rule which
+// fires replies with its error. Some examples:
+//
+//	// the next 2 EXECs fail
+//	m.InjectError(miniredis.ErrorRule{Cmd: "EXEC", Count: 2, Error: "EXECABORT Transaction discarded because of previous errors."})
+//	// 3 GETs on cfg:* keys fail
+//	m.InjectError(miniredis.ErrorRule{Cmd: "GET", Key: "cfg:*", Count: 3, Error: "LOADING Redis is loading the dataset in memory"})
+//	// 10% of all writes fail
+//	m.InjectError(miniredis.ErrorRule{WritesOnly: true, Probability: 0.1, Error: "TRYAGAIN Multiple keys request during rehashing of slot"})
+//
+// An error on a queued command makes the next EXEC fail, an error on EXEC
+// ends the transaction.
+func (m *Miniredis) InjectError(r ErrorRule) *InjectedError {
+	e := &InjectedError{
+		rule:  r,
+		rules: &m.errors,
+	}
+	if r.Cmd != "" {
+		e.cmdRE = patternRE(strings.ToUpper(r.Cmd))
+	}
+	if r.Key != "" {
+		e.keyRE = patternRE(r.Key)
+	}
+
+	m.errors.mu.Lock()
+	defer m.errors.mu.Unlock()
+	m.errors.rules = append(m.errors.rules, e)
+	return e
+}
+
+// ClearErrors removes all rules added with InjectError().
+func (m *Miniredis) ClearErrors() {
+	m.errors.mu.Lock()
+	defer m.errors.mu.Unlock()
+	m.errors.rules = nil
+}
+
+// Fired returns how many calls failed because of this rule.
+func (e *InjectedError) Fired() int {
+	e.rules.mu.Lock()
+	defer e.rules.mu.Unlock()
+	return e.fired
+}
+
+// Remove removes the rule. It's fine to call this more than once.
+func (e *InjectedError) Remove() {
+	e.rules.mu.Lock()
+	defer e.rules.mu.Unlock()
+	e.rules.remove(e)
+}
+
+func (r *errorRules) remove(e *InjectedError) {
+	for i, o := range r.rules {
+		if o == e {
+			r.rules = append(r.rules[:i:i], r.rules[i+1:]...)
+			return
+		}
+	}
+}
+
+func (e *InjectedError) matches(srv *server.Server, cmd []string) bool {
+	if e.rule.Cmd != "" && (e.cmdRE == nil || !e.cmdRE.MatchString(strings.ToUpper(cmd[0]))) {
+		return false
+	}
+	if e.rule.Key != "" && !anyMatch(e.keyRE, cmdKeys(cmd)) {
+		return false
+	}
+	if e.rule.WritesOnly && !srv.IsWriteCall(cmd) {
+		return false
+	}
+	return true
+}
+
+// match gives the error for a command, if any.
+func (r *errorRules) match(srv *server.Server, cmd []string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.msg != "" {
+		return r.msg
+	}
+	if msg := r.stateError(srv, cmd); msg != "" {
+		return msg
+	}
+	for _, e := range r.rules {
+		if !e.matches(srv, cmd) {
+			continue
+		}
+		if p := e.rule.Probability; p > 0 && r.float() >= p {
+			continue
+		}
+		e.fired++
+		if e.rule.Count > 0 && e.fired >= e.rule.Count {
+			r.remove(e)
+		}
+		return e.rule.Error
+	}
+	return ""
+}
+
+func (r *errorRules) float() float64 {
+	if r.rand == nil {
+		return rand.Float64()
+	}
+	return r.rand.Float64()
+}
+
+// errorHook is the server pre hook. It handles SCRIPT KILL and FUNCTION STATS
+// while a script runs, and replies with the BUSY error of a slow script, the
+// SetError() error, the SetState() error, or with the error of an
+// InjectError() rule. Otherwise it adds the SetLatency() delay.
+func (m *Miniredis) errorHook(c *server.Peer, cmd string, args ...string) bool {
+	if m.scriptKill(c, cmd, args) || m.functionStats(c, cmd, args) {
+		return true
+	}
+	msg := ""
+	if !getCtx(c).nested {
+		msg = m.script.busy(cmd)
+	}
+	if msg == "" {
+		msg = m.errors.match(m.srv, append([]string{cmd}, args...))
+	}
+	if msg == "" {
+		m.addLatency(c, cmd, args)
+		return false
+	}
+	if ctx := getCtx(c); !ctx.nested && inTx(ctx) {
+		if cmd == "EXEC" {
+			// a failed EXEC finishes the tx
+			stopTx(ctx)
+		} else {
+			setDirty(c)
+		}
+	}
+	c.WriteError(msg)
+	return true
+}
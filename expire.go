@@ -0,0 +1,110 @@
+package miniredis
+
+import (
+	"fmt"
+	"time"
+)
+
+// activeExpireInterval is how often the active expire cycle runs. Redis
+// runs it 10 times per second by default ("hz 10").
+const activeExpireInterval = 100 * time.Millisecond
+
+// SetActiveExpire makes TTLs count down in real time, the way they do in
+// Redis. By default TTLs only change with FastForward().
+//
+// Expired keys are removed before every command, and by a background cycle
+// which runs every 100ms, so they are also removed when there are no commands.
+// Hash fields with a TTL expire the same way. Expired keys are published as
+// keyspace events, as if "notify-keyspace-events" is set to "KEx": a message
+// "expired" on "__keyspace@<db>__:<key>", and the key on
+// "__keyevent@<db>__:expired".
+//
+// FastForward() still works as usual.
+func (m *Miniredis) SetActiveExpire(on bool) {
+	m.Lock()
+	defer m.Unlock()
+	m.setActiveExpire(on)
+}
+
+// setActiveExpire is SetActiveExpire(), without locks.
+func (m *Miniredis) setActiveExpire(on bool) {
+	if on == m.activeExpire {
+		return
+	}
+	m.activeExpire = on
+	if on {
+		m.expireTick = m.clockNow()
+		m.startExpireCycle()
+	} else {
+		m.stopExpireCycle()
+	}
+}
+
+// startExpireCycle starts the background goroutine. No locks!
+func (m *Miniredis) startExpireCycle() {
+	if m.expireStop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	m.expireStop = stop
+	go func() {
+		t := time.NewTicker(activeExpireInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				m.Lock()
+				m.passTime()
+				m.signal.Broadcast()
+				m.Unlock()
+			}
+		}
+	}()
+}
+
+// stopExpireCycle stops the background goroutine. No locks!
+func (m *Miniredis) stopExpireCycle() {
+	if m.expireStop != nil {
+		close(m.expireStop)
+		m.expireStop = nil
+	}
+}
+
+// passTime decreases all TTLs with the time passed since the last call, and
+// removes everything which expired. Does nothing unless SetActiveExpire() is
+// on, or there is a SetClock() clock. No locks!
+func (m *Miniredis) passTime() {
+	if !m.activeExpire && m.clock == nil {
+		return
+	}
+	now := m.clockNow()
+	d := now.Sub(m.expireTick)
+	if d <= 0 {
+		return
+	}
+	m.expireTick = now
+	for _, db := range m.dbs {
+		db.fastForward(d)
+	}
+	if m.clock != nil {
+		m.passPause(d)
+	}
+}
+
+// keyExpired is called for every key removed because of its TTL. No locks!
+func (m *Miniredis) keyExpired(db int, key string) {
+	m.expiredKeys++
+	m.notifyKeyspaceEvent(db, key, "expired")
+}
+
+// notifyKeyspaceEvent publishes a keyspace event. Only with
+// SetActiveExpire(). No locks!
+func (m *Miniredis) notifyKeyspaceEvent(db int, key, event string) {
+	if !m.activeExpire {
+		return
+	}
+	m.publish(fmt.Sprintf("__keyspace@%d__:%s", db, key), event)
+	m.publish(fmt.Sprintf("__keyevent@%d__:%s", db, event), key)
+}
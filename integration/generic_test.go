@@ -478,6 +478,60 @@ func TestClient(t *testing.T) {
 		c.Error("wrong number", "CLIENT", "GETNAME", "foo")
 		c.Error("contain spaces", "CLIENT", "SETNAME", "miniredis tests")
 		c.Error("contain spaces", "CLIENT", "SETNAME", "miniredis\ntests")
+
+		c.Do("CLIENT", "LIST", "ID", "999999")
+		c.Do("CLIENT", "LIST", "TYPE", "pubsub")
+		c.Do("CLIENT", "KILL", "ID", "999999")
+		c.Do("CLIENT", "KILL", "TYPE", "pubsub")
+		c.Error("Unknown client type", "CLIENT", "LIST", "TYPE", "foo")
+		c.Error("Invalid client ID", "CLIENT", "LIST", "ID", "foo")
+		c.Error("Invalid client ID", "CLIENT", "LIST", "ID", "0")
+		c.Error("syntax error", "CLIENT", "LIST", "foo")
+		c.Error("wrong number", "CLIENT", "INFO", "foo")
+		c.Error("wrong number", "CLIENT", "ID", "foo")
+		c.Error("No such client", "CLIENT", "KILL", "1.2.3.4:5")
+		c.Error("client-id should be greater than 0", "CLIENT", "KILL", "ID", "foo")
+		c.Error("Unknown client type", "CLIENT", "KILL", "TYPE", "foo")
+		c.Error("No such user", "CLIENT", "KILL", "USER", "foo")
+		c.Error("syntax error", "CLIENT", "KILL", "SKIPME", "maybe")
+		c.Error("syntax error", "CLIENT", "KILL", "ID", "1", "SKIPME")
+
+		c.Do("CLIENT", "SETINFO", "lib-name", "miniredis")
+		c.Do("CLIENT", "SETINFO", "LIB-VER", "1.2.3")
+		c.Do("CLIENT", "NO-EVICT", "on")
+		c.Do("CLIENT", "NO-TOUCH", "off")
+		c.Error("Unrecognized option", "CLIENT", "SETINFO", "foo", "bar")
+		c.Error("cannot contain spaces", "CLIENT", "SETINFO", "lib-name", "foo bar")
+		c.Error("wrong number", "CLIENT", "SETINFO", "lib-name")
+		c.Error("syntax error", "CLIENT", "NO-EVICT", "maybe")
+		c.Error("syntax error", "CLIENT", "NO-TOUCH", "maybe")
+		c.Error("syntax error", "CLIENT", "REPLY", "maybe")
+
+		c.Do("CLIENT", "PAUSE", "0")
+		c.Do("CLIENT", "UNPAUSE")
+		c.Error("wrong number", "CLIENT", "PAUSE")
+		c.Error("not an integer", "CLIENT", "PAUSE", "foo")
+		c.Error("negative", "CLIENT", "PAUSE", "-1")
+		c.Error("WRITE or ALL", "CLIENT", "PAUSE", "10", "foo")
+		c.Error("wrong number", "CLIENT", "UNPAUSE", "foo")
+
+		c.Do("CLIENT", "GETREDIR")
+		c.Do("CLIENT", "TRACKINGINFO")
+		c.Error("wrong number", "CLIENT", "TRACKING")
+		c.Error("syntax error", "CLIENT", "TRACKING", "maybe")
+		c.Error("syntax error", "CLIENT", "TRACKING", "on", "foo")
+		c.Error("not an integer", "CLIENT", "TRACKING", "on", "REDIRECT", "foo")
+		c.Error("does not exist", "CLIENT", "TRACKING", "on", "REDIRECT", "999999")
+		c.Error("requires BCAST", "CLIENT", "TRACKING", "on", "PREFIX", "foo")
+		c.Error("not compatible with BCAST", "CLIENT", "TRACKING", "on", "BCAST", "OPTIN")
+		c.Error("both OPTIN and OPTOUT", "CLIENT", "TRACKING", "on", "OPTIN", "OPTOUT")
+		c.Error("overlaps", "CLIENT", "TRACKING", "on", "BCAST", "PREFIX", "a", "PREFIX", "ab")
+		c.Error("tracking mode", "CLIENT", "CACHING", "yes")
+		c.Do("CLIENT", "TRACKING", "on", "OPTIN")
+		c.Do("CLIENT", "CACHING", "yes")
+		c.Do("CLIENT", "TRACKINGINFO")
+		c.Error("OPTOUT mode", "CLIENT", "CACHING", "no")
+		c.Do("CLIENT", "TRACKING", "off")
 	})
 
 	testRaw2(t, func(c1, c2 *client) {
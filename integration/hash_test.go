@@ -137,6 +137,9 @@ func TestHashGetall(t *testing.T) {
 		c.DoSorted("HGETALL", "aap")
 
 		c.Do("HGETALL", "nosuch")
+
+		c.Do("HSET", "single", "zus", "jet")
+		c.Do("HRANDFIELD", "single", "-2", "WITHVALUES")
 	})
 }
 
@@ -25,6 +25,15 @@ func TestScript(t *testing.T) {
 			c.Do("EVAL_RO", "return 42+2", "0")
 			c.Error("Write commands are not allowed", "EVAL_RO", "return redis.call('LPOP', 'foo')", "0")
 
+			c.Do("EVAL", "#!lua\nreturn 42", "0")
+			c.Do("EVAL", "#!lua flags=no-writes,allow-stale\nreturn 42", "0")
+			c.Do("EVAL_RO", "#!lua flags=no-writes\nreturn 42", "0")
+			c.Error("write flag", "EVAL_RO", "#!lua\nreturn 42", "0")
+			c.Error("Write commands are not allowed", "EVAL", "#!lua flags=no-writes\nreturn redis.call('LPOP', 'foo')", "0")
+			c.Error("Unexpected engine", "EVAL", "#!js\nreturn 42", "0")
+			c.Error("Unknown lua shebang option", "EVAL", "#!lua name=foo\nreturn 42", "0")
+			c.Error("Unexpected flag", "EVAL", "#!lua flags=foo\nreturn 42", "0")
+
 			// failure cases
 			c.Error("wrong number", "EVAL")
 			c.Error("wrong number", "EVAL", "return 42")
@@ -51,6 +60,8 @@ func TestScript(t *testing.T) {
 			c.Do("SCRIPT", "EXISTS", "1fa00e76656cc152ad327c13fe365858fd7be306")
 			c.Do("SCRIPT", "FLUSH", "ASYNC")
 			c.Do("SCRIPT", "FLUSH", "SyNc")
+			c.Do("SCRIPT", "DEBUG", "NO")
+			c.Error("Use SCRIPT DEBUG", "SCRIPT", "DEBUG", "FOO")
 
 			c.Error("wrong number", "SCRIPT")
 			c.Error("wrong number", "SCRIPT", "LOAD", "return 42", "return 42")
@@ -201,6 +212,19 @@ func TestLua(t *testing.T) {
 		c.Error("Script attempted to access nonexistent global variable", "EVAL", `return utf8.len("hello world")`, "0")
 		// c.Error("Script attempted to access nonexistent global variable", "EVAL", `require("utf8")`, "0")
 		c.Do("EVAL", `return coroutine.running()`, "0")
+		c.Error("Attempt to modify a readonly table", "EVAL", "someGlobal = 1", "0")
+	})
+
+	// bit, struct, and cmsgpack
+	testRaw(t, func(c *client) {
+		c.Do("EVAL", "return {bit.band(5, 3), bit.bor(5, 3), bit.bxor(1, 3), bit.lshift(1, 31), bit.rshift(-1, 28), bit.arshift(-256, 4)}", "0")
+		c.Do("EVAL", "return {bit.tobit(0xffffffff), bit.tohex(255), bit.tohex(-1, -4), bit.bswap(0x12345678)}", "0")
+		c.Do("EVAL", "return struct.pack('>I2<h', 258, -2)", "0")
+		c.Do("EVAL", "return {struct.unpack('<i4d', struct.pack('<i4d', -5, 2.0))}", "0")
+		c.Do("EVAL", "return {struct.unpack('B c0 s', struct.pack('B c0 s', 3, 'foo', 'bar'))}", "0")
+		c.Do("EVAL", "return cmsgpack.pack(1, 'a', {1, 2}, true, -1, 300, {a='b'})", "0")
+		c.Do("EVAL", "return {cmsgpack.unpack_limit(cmsgpack.pack(1, 2), 2)}", "0")
+		c.Error("Bad data format", "EVAL", "return cmsgpack.unpack('\\193')", "0")
 	})
 
 	// sha1hex
@@ -408,6 +432,32 @@ func TestLuaCall(t *testing.T) {
 	})
 }
 
+func TestFunction(t *testing.T) {
+	skip(t)
+	testRaw(t, func(c *client) {
+		c.Do("FUNCTION", "FLUSH")
+		c.Do("FUNCTION", "LOAD", "#!lua name=mylib\nredis.register_function('myset', function(keys, args) return redis.call('SET', keys[1], args[1]) end)\nredis.register_function{function_name='myget', callback=function(keys) return redis.call('GET', keys[1]) end, flags={'no-writes'}}")
+		c.Do("FCALL", "myset", "1", "foo", "bar")
+		c.Do("FCALL", "myget", "1", "foo")
+		c.Do("FCALL_RO", "myget", "1", "foo")
+		c.Do("FUNCTION", "STATS")
+		c.Do("FUNCTION", "LIST", "LIBRARYNAME", "nosuch")
+		c.Do("FUNCTION", "DELETE", "mylib")
+
+		// failure cases
+		c.Error("Function not found", "FCALL", "nosuch", "0")
+		c.Error("wrong number", "FCALL", "nosuch")
+		c.Error("Library not found", "FUNCTION", "DELETE", "nosuch")
+		c.Error("Missing library metadata", "FUNCTION", "LOAD", "return 1")
+		c.Error("Library name was not given", "FUNCTION", "LOAD", "#!lua\nreturn 1")
+		c.Error("No functions registered", "FUNCTION", "LOAD", "#!lua name=foo\nreturn 1")
+		c.Error("payload version or checksum are wrong", "FUNCTION", "RESTORE", "garbage")
+		c.Error("unknown subcommand", "FUNCTION", "FOO")
+		c.Error("No scripts in execution", "FUNCTION", "KILL")
+		c.Error("No scripts in execution", "SCRIPT", "KILL")
+	})
+}
+
 func TestScriptNoAuth(t *testing.T) {
 	skip(t)
 	testAuth(t,
@@ -34,6 +34,16 @@ func TestServer(t *testing.T) {
 		c.Error("syntax error", "FLUSHDB", "ASYNC", "foo")
 		c.Error("syntax error", "FLUSHDB", "ASYNC", "ASYNC")
 		c.Error("syntax error", "FLUSHALL", "ASYNC", "foo")
+		c.Error("wrong number", "MONITOR", "foo")
+		c.Error("wrong number", "SLOWLOG")
+		c.Error("greater than or equal to -1", "SLOWLOG", "GET", "-2")
+		c.Error("greater than or equal to -1", "SLOWLOG", "GET", "foo")
+		c.Error("wrong number", "SLOWLOG", "LEN", "foo")
+		c.Error("unknown subcommand", "SLOWLOG", "foo")
+		c.Error("wrong number", "LATENCY")
+		c.Error("wrong number", "LATENCY", "LATEST", "foo")
+		c.Error("wrong number", "LATENCY", "HISTORY")
+		c.Error("unknown subcommand", "LATENCY", "foo")
 	})
 
 	testRaw(t, func(c *client) {
@@ -68,6 +78,24 @@ func TestServer(t *testing.T) {
 		// c.Error("out of range", "WAIT", "-1", "0") // something weird going on
 		c.Error("timeout is negative", "WAIT", "11", "-12")
 	})
+
+	testRaw(t, func(c *client) {
+		c.Do("LOLWUT", "VERSION", "1")
+		c.Error("not an integer", "LOLWUT", "VERSION", "foo")
+	})
+
+	testRaw(t, func(c *client) {
+		// disabled by default
+		c.Error("DEBUG command not allowed", "DEBUG", "PROTOCOL", "string")
+		c.Error("wrong number", "DEBUG")
+	})
+
+	testRESP3(t, func(c *client) {
+		c.Do("LOLWUT", "VERSION", "1")
+		c.DoLoosely("INFO", "clients")
+		c.DoLoosely("CLIENT", "INFO")
+		c.DoLoosely("LATENCY", "DOCTOR")
+	})
 }
 
 func TestServerTLS(t *testing.T) {
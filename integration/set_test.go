@@ -247,6 +247,10 @@ func TestSetSdiff(t *testing.T) {
 		c.DoSorted("SDIFF", "s1", "s2")
 		c.Do("SDIFFSTORE", "res", "s1", "s2")
 		c.Do("SMEMBERS", "res")
+		c.Do("SINTER", "s1", "res")
+		c.Do("SUNION", "res", "nosuch")
+		c.Do("SPOP", "res", "3")
+		c.Do("SPOP", "nosuch", "3")
 	})
 }
 
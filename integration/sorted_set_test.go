@@ -177,6 +177,18 @@ func TestSortedSetAdd(t *testing.T) {
 
 	testRESP3(t, func(c *client) {
 		c.Do("ZADD", "z", "INCR", "1", "aap")
+		c.Do("ZADD", "z", "2.5", "noot")
+		c.Do("ZSCORE", "z", "noot")
+		c.Do("ZRANGE", "z", "0", "-1", "WITHSCORES")
+		c.Do("ZRANGEBYSCORE", "z", "-inf", "+inf", "WITHSCORES")
+		c.Do("ZREVRANGE", "z", "0", "-1", "WITHSCORES")
+		c.Do("ZUNION", "1", "z", "WITHSCORES")
+		c.Do("ZINTER", "1", "z", "WITHSCORES")
+		c.Do("ZRANK", "z", "noot", "WITHSCORE")
+		c.Do("ZRANK", "z", "nosuch", "WITHSCORE")
+		c.Do("ZSCAN", "z", "0")
+		c.Do("ZPOPMIN", "z")
+		c.Do("ZPOPMAX", "z", "1")
 	})
 }
 
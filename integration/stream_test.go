@@ -740,6 +740,9 @@ func TestStreamGroup(t *testing.T) {
 
 	testRESP3(t, func(c *client) {
 		c.DoLoosely("XINFO", "STREAM", "foo")
+		c.Do("XADD", "planets", "0-1", "name", "Mercury")
+		c.Do("XREAD", "STREAMS", "planets", "0")
+		c.Do("XREAD", "STREAMS", "planets", "0-1")
 	})
 }
 
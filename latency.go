@@ -0,0 +1,222 @@
+package miniredis
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+const (
+	latencyHistoryLen = 160       // Redis' LATENCY_TS_LEN
+	latencyEvent      = "command" // event for delays from SetLatency()
+)
+
+// latencyRule is a single SetLatency() call.
+type latencyRule struct {
+	cmdPattern string
+	keyPattern string
+	cmdRE      *regexp.Regexp
+	keyRE      *regexp.Regexp // nil matches every command
+	d          time.Duration
+}
+
+type latencySample struct {
+	time    time.Time
+	latency time.Duration
+}
+
+// latencyEvents are the samples of a single LATENCY event, oldest first.
+type latencyEvents struct {
+	samples []latencySample
+	max     time.Duration
+}
+
+// latency has the SetLatency() rules, and what LATENCY reports.
+type latency struct {
+	rules  []latencyRule
+	events map[string]*latencyEvents
+}
+
+func newLatency() latency {
+	return latency{
+		events: map[string]*latencyEvents{},
+	}
+}
+
+// SetLatency delays the reply of every command matching cmdPattern and
+// keyPattern by d. Both patterns are globs, as used by KEYS. cmdPattern
+// matches the command name, case insensitive. keyPattern matches if any of the
+// keys of the command matches, and an empty keyPattern matches every command,
+// also commands without keys. For example:
+//
+//	m.SetLatency("HGETALL", "user:*", 200*time.Millisecond)
+//
+// No part of the reply is sent before the delay is over. The command itself
+// runs as usual, and other clients are not held up. Delays are reported by LATENCY as
+// the "command" event. Calling SetLatency again with the same patterns changes
+// the delay, a 0 duration removes the rule. If more rules match the longest
+// delay is used.
+func (m *Miniredis) SetLatency(cmdPattern, keyPattern string, d time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+
+	rules := m.latency.rules[:0]
+	for _, r := range m.latency.rules {
+		if r.cmdPattern != cmdPattern || r.keyPattern != keyPattern {
+			rules = append(rules, r)
+		}
+	}
+	m.latency.rules = rules
+	if d <= 0 {
+		return
+	}
+
+	r := latencyRule{
+		cmdPattern: cmdPattern,
+		keyPattern: keyPattern,
+		cmdRE:      patternRE(strings.ToUpper(cmdPattern)),
+		d:          d,
+	}
+	if keyPattern != "" {
+		r.keyRE = patternRE(keyPattern)
+	}
+	m.latency.rules = append(m.latency.rules, r)
+}
+
+// delay gives the delay for a command. 0 if no rule matches.
+func (l *latency) delay(cmd []string) time.Duration {
+	var (
+		d    time.Duration
+		name = strings.ToUpper(cmd[0])
+		keys = cmdKeys(cmd)
+	)
+	for _, r := range l.rules {
+		if r.d <= d || r.cmdRE == nil || !r.cmdRE.MatchString(name) {
+			continue
+		}
+		if r.keyPattern != "" && !anyMatch(r.keyRE, keys) {
+			continue
+		}
+		d = r.d
+	}
+	return d
+}
+
+func anyMatch(re *regexp.Regexp, keys []string) bool {
+	if re == nil {
+		return false
+	}
+	for _, k := range keys {
+		if re.MatchString(k) {
+			return true
+		}
+	}
+	return false
+}
+
+// add records a latency sample. Samples in the same second are combined, the
+// way Redis does.
+func (l *latency) add(now time.Time, event string, d time.Duration) {
+	ev, ok := l.events[event]
+	if !ok {
+		ev = &latencyEvents{}
+		l.events[event] = ev
+	}
+	if d > ev.max {
+		ev.max = d
+	}
+	if n := len(ev.samples); n > 0 && ev.samples[n-1].time.Unix() == now.Unix() {
+		if d > ev.samples[n-1].latency {
+			ev.samples[n-1].latency = d
+		}
+		return
+	}
+	ev.samples = append(ev.samples, latencySample{time: now, latency: d})
+	if len(ev.samples) > latencyHistoryLen {
+		ev.samples = ev.samples[1:]
+	}
+}
+
+// names gives all event names, sorted.
+func (l *latency) names() []string {
+	var res []string
+	for name := range l.events {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// addLatency delays the reply to c if there are matching SetLatency() rules.
+// It's called before the command runs, so nothing of the reply is sent before
+// the delay. EXEC also gets the delays of the queued commands. Queued and
+// nested commands are not delayed on their own.
+func (m *Miniredis) addLatency(c *server.Peer, cmd string, args []string) {
+	ctx := getCtx(c)
+	if ctx.nested {
+		// the main lock is already held
+		return
+	}
+	cmds := [][]string{append([]string{cmd}, args...)}
+	if inTx(ctx) {
+		if cmd != "EXEC" && cmd != "DISCARD" {
+			return
+		}
+		if cmd == "EXEC" {
+			cmds = append(cmds, ctx.txCmds...)
+		}
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	now := m.effectiveNow()
+	for _, cmd := range cmds {
+		if d := m.latency.delay(cmd); d > 0 {
+			c.Delay(d)
+			m.latency.add(now, latencyEvent, d)
+		}
+	}
+}
+
+// doctor is the LATENCY DOCTOR report.
+func (l *latency) doctor() string {
+	if len(l.events) == 0 {
+		return "Dave, no latency spike was observed during the lifetime of this Redis instance, not in the slightest bit. I honestly think you ought to sleep tonight.\n"
+	}
+
+	var b strings.Builder
+	b.WriteString("Dave, I have observed latency spikes in this Redis instance. You don't mind talking about it, do you Dave?\n\n")
+	for i, name := range l.names() {
+		ev := l.events[name]
+		var sum time.Duration
+		for _, s := range ev.samples {
+			sum += s.latency
+		}
+		avg := sum / time.Duration(len(ev.samples))
+		var dev time.Duration
+		for _, s := range ev.samples {
+			if s.latency > avg {
+				dev += s.latency - avg
+			} else {
+				dev += avg - s.latency
+			}
+		}
+		dev /= time.Duration(len(ev.samples))
+		period := ev.samples[len(ev.samples)-1].time.Sub(ev.samples[0].time) / time.Duration(len(ev.samples))
+		fmt.Fprintf(&b, "%d. %s: %d latency spikes (average %dms, mean deviation %dms, period %.2f sec). Worst all time event %dms.\n",
+			i+1,
+			name,
+			len(ev.samples),
+			avg.Milliseconds(),
+			dev.Milliseconds(),
+			period.Seconds(),
+			ev.max.Milliseconds(),
+		)
+	}
+	b.WriteString("\nI have no advice for you: all these spikes were added with SetLatency().\n")
+	return b.String()
+}
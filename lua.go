@@ -12,13 +12,21 @@ import (
 )
 
 var luaRedisConstants = map[string]lua.LValue{
-	"LOG_DEBUG":   lua.LNumber(0),
-	"LOG_VERBOSE": lua.LNumber(1),
-	"LOG_NOTICE":  lua.LNumber(2),
-	"LOG_WARNING": lua.LNumber(3),
+	"LOG_DEBUG":         lua.LNumber(0),
+	"LOG_VERBOSE":       lua.LNumber(1),
+	"LOG_NOTICE":        lua.LNumber(2),
+	"LOG_WARNING":       lua.LNumber(3),
+	"REPL_NONE":         lua.LNumber(0),
+	"REPL_AOF":          lua.LNumber(1),
+	"REPL_SLAVE":        lua.LNumber(2),
+	"REPL_REPLICA":      lua.LNumber(2),
+	"REPL_ALL":          lua.LNumber(3),
+	"REDIS_VERSION":     lua.LString(redisVersion),
+	"REDIS_VERSION_NUM": lua.LNumber(redisVersionNum),
 }
 
-func mkLua(srv *server.Server, c *server.Peer, sha string, readOnly bool) (map[string]lua.LGFunction, map[string]lua.LValue) {
+func mkLua(srv *server.Server, c *server.Peer, sha string, readOnly bool, slot *scriptSlot, run *scriptRun, trace *ScriptTrace) (map[string]lua.LGFunction, map[string]lua.LValue) {
+	debug := getCtx(c).ldb // SCRIPT DEBUG session, or nil
 	mkCall := func(failFast bool) func(l *lua.LState) int {
 		// one server.Ctx for a single Lua run
 		pCtx := &connCtx{}
@@ -52,8 +60,12 @@ func mkLua(srv *server.Server, c *server.Peer, sha string, readOnly bool) (map[s
 				return 0
 			}
 
+			write := srv.IsWriteCall(args)
 			if readOnly && len(args) > 0 {
-				if srv.IsRegisteredCommand(args[0]) && !srv.IsReadOnlyCommand(args[0]) {
+				if write {
+					if trace != nil {
+						trace.add(args, "-Write commands are not allowed in read-only scripts\r\n")
+					}
 					if failFast {
 						l.Error(lua.LString("Write commands are not allowed in read-only scripts"), 1)
 						return 0
@@ -66,12 +78,38 @@ func mkLua(srv *server.Server, c *server.Peer, sha string, readOnly bool) (map[s
 				}
 			}
 
+			if slot != nil && !slot.use(cmdKeys(args)) {
+				if trace != nil {
+					trace.add(args, "-"+msgCrossSlotScript+"\r\n")
+				}
+				if failFast {
+					l.Error(lua.LString(msgCrossSlotScript), 1)
+					return 0
+				}
+				// pcall() mode - return error table
+				res := &lua.LTable{}
+				res.RawSetString("err", lua.LString(msgCrossSlotScript))
+				l.Push(res)
+				return 1
+			}
+
+			if write {
+				// a script which wrote can't be killed anymore
+				run.write()
+			}
+
 			buf := &bytes.Buffer{}
 			wr := bufio.NewWriter(buf)
 			peer := server.NewPeer(wr)
 			peer.Ctx = pCtx
 			srv.Dispatch(peer, args)
 			wr.Flush()
+			if trace != nil {
+				trace.add(args, buf.String())
+			}
+			if debug != nil {
+				debug.redisCall(args, buf.String())
+			}
 
 			res, err := server.ParseReply(bufio.NewReader(buf))
 			if err != nil {
@@ -177,6 +215,37 @@ func mkLua(srv *server.Server, c *server.Peer, sha string, readOnly bool) (map[s
 			l.Push(lua.LString(sha1Hex(msg)))
 			return 1
 		},
+		"acl_check_cmd": func(l *lua.LState) int {
+			top := l.GetTop()
+			if top == 0 {
+				l.Error(lua.LString("Please specify at least one argument for this redis lib call"), 1)
+				return 0
+			}
+			if !srv.IsRegisteredCommand(lua.LVAsString(l.Get(1))) {
+				l.Error(lua.LString("Invalid command passed to redis.acl_check_cmd()"), 1)
+				return 0
+			}
+			// there are no ACLs, the user can run everything
+			l.Push(lua.LTrue)
+			return 1
+		},
+		"breakpoint": func(l *lua.LState) int {
+			// only does something in the debugger
+			if debug == nil {
+				l.Push(lua.LFalse)
+				return 1
+			}
+			debug.luabp = true
+			l.Push(lua.LTrue)
+			return 1
+		},
+		"debug": func(l *lua.LState) int {
+			// only does something in the debugger
+			if debug != nil {
+				debug.debug(l)
+			}
+			return 0
+		},
 		"replicate_commands": func(l *lua.LState) int {
 			// always succeeds since 7.0.0
 			l.Push(lua.LTrue)
@@ -0,0 +1,94 @@
+package miniredis
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// The "bit" Lua library, as in LuaBitOp (https://bitop.luajit.org/), which
+// Redis loads. All operations are on 32 bit signed integers.
+func mkLuaBit() map[string]lua.LGFunction {
+	return map[string]lua.LGFunction{
+		"tobit": func(l *lua.LState) int {
+			l.Push(lua.LNumber(luaToBit(l, 1)))
+			return 1
+		},
+		"tohex": func(l *lua.LState) int {
+			b := uint32(luaToBit(l, 1))
+			n := 8
+			if l.GetTop() >= 2 {
+				n = int(luaToBit(l, 2))
+			}
+			upper := false
+			if n < 0 {
+				n, upper = -n, true
+			}
+			if n > 8 {
+				n = 8
+			}
+			s := fmt.Sprintf("%08x", b)[8-n:]
+			if upper {
+				s = strings.ToUpper(s)
+			}
+			l.Push(lua.LString(s))
+			return 1
+		},
+		"bnot": func(l *lua.LState) int {
+			l.Push(lua.LNumber(^luaToBit(l, 1)))
+			return 1
+		},
+		"band": luaBitFold(func(a, b int32) int32 { return a & b }),
+		"bor":  luaBitFold(func(a, b int32) int32 { return a | b }),
+		"bxor": luaBitFold(func(a, b int32) int32 { return a ^ b }),
+		"lshift": luaBitShift(func(a int32, n uint) int32 {
+			return int32(uint32(a) << n)
+		}),
+		"rshift": luaBitShift(func(a int32, n uint) int32 {
+			return int32(uint32(a) >> n)
+		}),
+		"arshift": luaBitShift(func(a int32, n uint) int32 {
+			return a >> n
+		}),
+		"rol": luaBitShift(func(a int32, n uint) int32 {
+			return int32(bits.RotateLeft32(uint32(a), int(n)))
+		}),
+		"ror": luaBitShift(func(a int32, n uint) int32 {
+			return int32(bits.RotateLeft32(uint32(a), -int(n)))
+		}),
+		"bswap": func(l *lua.LState) int {
+			l.Push(lua.LNumber(int32(bits.ReverseBytes32(uint32(luaToBit(l, 1))))))
+			return 1
+		},
+	}
+}
+
+// luaToBit normalizes argument n to a 32 bit integer, the way LuaBitOp does.
+func luaToBit(l *lua.LState, n int) int32 {
+	f := float64(l.CheckNumber(n))
+	f = math.RoundToEven(math.Mod(f, 1<<32))
+	return int32(uint32(int64(f)))
+}
+
+func luaBitFold(op func(a, b int32) int32) lua.LGFunction {
+	return func(l *lua.LState) int {
+		r := luaToBit(l, 1)
+		for i := 2; i <= l.GetTop(); i++ {
+			r = op(r, luaToBit(l, i))
+		}
+		l.Push(lua.LNumber(r))
+		return 1
+	}
+}
+
+func luaBitShift(op func(a int32, n uint) int32) lua.LGFunction {
+	return func(l *lua.LState) int {
+		a := luaToBit(l, 1)
+		n := uint(luaToBit(l, 2)) & 31
+		l.Push(lua.LNumber(op(a, n)))
+		return 1
+	}
+}
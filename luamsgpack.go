@@ -0,0 +1,314 @@
+package miniredis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// The "cmsgpack" Lua library, as in lua-cmsgpack
+// (https://github.com/antirez/lua-cmsgpack), which Redis loads.
+func mkLuaMsgpack() map[string]lua.LGFunction {
+	return map[string]lua.LGFunction{
+		"pack": func(l *lua.LState) int {
+			if l.GetTop() == 0 {
+				l.ArgError(1, "MessagePack pack needs input.")
+			}
+			buf := &bytes.Buffer{}
+			for i := 1; i <= l.GetTop(); i++ {
+				msgpackEncode(buf, l.Get(i), 0)
+			}
+			l.Push(lua.LString(buf.String()))
+			return 1
+		},
+		"unpack": func(l *lua.LState) int {
+			return msgpackUnpack(l, l.CheckString(1))
+		},
+		"unpack_one": func(l *lua.LState) int {
+			offset := l.OptInt(2, 0)
+			return msgpackUnpackLimit(l, l.CheckString(1), 1, offset)
+		},
+		"unpack_limit": func(l *lua.LState) int {
+			limit := l.CheckInt(2)
+			offset := l.OptInt(3, 0)
+			return msgpackUnpackLimit(l, l.CheckString(1), limit, offset)
+		},
+	}
+}
+
+// lua-cmsgpack encodes nested tables deeper than this as nil.
+const msgpackMaxNesting = 16
+
+func msgpackEncode(buf *bytes.Buffer, v lua.LValue, level int) {
+	switch t := v.(type) {
+	case lua.LBool:
+		if t {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case lua.LNumber:
+		f := float64(t)
+		if f == math.Trunc(f) && !math.IsInf(f, 0) && f >= math.MinInt64 && f < math.MaxInt64 {
+			msgpackEncodeInt(buf, int64(f))
+		} else if float64(float32(f)) == f || math.IsNaN(f) {
+			buf.WriteByte(0xca)
+			binary.Write(buf, binary.BigEndian, math.Float32bits(float32(f)))
+		} else {
+			buf.WriteByte(0xcb)
+			binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+		}
+	case lua.LString:
+		msgpackEncodeString(buf, string(t))
+	case *lua.LTable:
+		if level >= msgpackMaxNesting {
+			buf.WriteByte(0xc0)
+			return
+		}
+		if n, ok := luaArrayLen(t); ok {
+			msgpackEncodeLen(buf, n, 0x90, 0xdc, 0xdd)
+			for i := 1; i <= n; i++ {
+				msgpackEncode(buf, t.RawGetInt(i), level+1)
+			}
+			return
+		}
+		var keys, vals []lua.LValue
+		t.ForEach(func(k, v lua.LValue) {
+			keys = append(keys, k)
+			vals = append(vals, v)
+		})
+		msgpackEncodeLen(buf, len(keys), 0x80, 0xde, 0xdf)
+		for i := range keys {
+			msgpackEncode(buf, keys[i], level+1)
+			msgpackEncode(buf, vals[i], level+1)
+		}
+	default:
+		buf.WriteByte(0xc0)
+	}
+}
+
+func msgpackEncodeInt(buf *bytes.Buffer, n int64) {
+	switch {
+	case n >= 0 && n < 128:
+		buf.WriteByte(byte(n))
+	case n >= 0 && n <= math.MaxUint8:
+		buf.WriteByte(0xcc)
+		buf.WriteByte(byte(n))
+	case n >= 0 && n <= math.MaxUint16:
+		buf.WriteByte(0xcd)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n >= 0 && n <= math.MaxUint32:
+		buf.WriteByte(0xce)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	case n >= 0:
+		buf.WriteByte(0xcf)
+		binary.Write(buf, binary.BigEndian, uint64(n))
+	case n >= -32:
+		buf.WriteByte(byte(int8(n)))
+	case n >= math.MinInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(int8(n)))
+	case n >= math.MinInt16:
+		buf.WriteByte(0xd1)
+		binary.Write(buf, binary.BigEndian, int16(n))
+	case n >= math.MinInt32:
+		buf.WriteByte(0xd2)
+		binary.Write(buf, binary.BigEndian, int32(n))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+func msgpackEncodeString(buf *bytes.Buffer, s string) {
+	switch n := len(s); {
+	case n < 32:
+		buf.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(0xd9)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(0xda)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(0xdb)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+	buf.WriteString(s)
+}
+
+// msgpackEncodeLen writes an array or map header.
+func msgpackEncodeLen(buf *bytes.Buffer, n int, fix, b16, b32 byte) {
+	switch {
+	case n < 16:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(b16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(b32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+// luaArrayLen returns the length of a table if it's an array: only the keys
+// 1..n.
+func luaArrayLen(t *lua.LTable) (int, bool) {
+	var (
+		count   = 0
+		highest = 0
+		array   = true
+	)
+	t.ForEach(func(k, _ lua.LValue) {
+		n, ok := k.(lua.LNumber)
+		if !ok || n < 1 || float64(n) != math.Trunc(float64(n)) {
+			array = false
+			return
+		}
+		count++
+		if int(n) > highest {
+			highest = int(n)
+		}
+	})
+	return highest, array && highest == count
+}
+
+// msgpackUnpack decodes and pushes all values from data. Returns the number
+// of values.
+func msgpackUnpack(l *lua.LState, data string) int {
+	d := &msgpackDecoder{l: l, data: data}
+	n := 0
+	for d.pos < len(d.data) {
+		l.Push(d.decode())
+		n++
+	}
+	return n
+}
+
+// msgpackUnpackLimit is unpack_one() and unpack_limit(): it returns the next
+// offset (-1 when all data is used) and the values.
+func msgpackUnpackLimit(l *lua.LState, data string, limit, offset int) int {
+	if offset < 0 || offset > len(data) {
+		l.ArgError(2, "Start offset greater than input length.")
+	}
+	d := &msgpackDecoder{l: l, data: data, pos: offset}
+	var vals []lua.LValue
+	for d.pos < len(d.data) && (limit <= 0 || len(vals) < limit) {
+		vals = append(vals, d.decode())
+	}
+	next := d.pos
+	if next >= len(data) {
+		next = -1
+	}
+	l.Push(lua.LNumber(next))
+	for _, v := range vals {
+		l.Push(v)
+	}
+	return len(vals) + 1
+}
+
+type msgpackDecoder struct {
+	l    *lua.LState
+	data string
+	pos  int
+}
+
+func (d *msgpackDecoder) bytes(n int) []byte {
+	if n < 0 || d.pos+n > len(d.data) {
+		d.l.RaiseError("Missing bytes in input.")
+	}
+	b := []byte(d.data[d.pos : d.pos+n])
+	d.pos += n
+	return b
+}
+
+func (d *msgpackDecoder) uint(n int) uint64 {
+	b := d.bytes(n)
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func (d *msgpackDecoder) decode() lua.LValue {
+	c := d.bytes(1)[0]
+	switch {
+	case c <= 0x7f:
+		return lua.LNumber(c)
+	case c >= 0xe0:
+		return lua.LNumber(int8(c))
+	case c&0xe0 == 0xa0:
+		return lua.LString(d.bytes(int(c & 0x1f)))
+	case c&0xf0 == 0x90:
+		return d.array(int(c & 0x0f))
+	case c&0xf0 == 0x80:
+		return d.table(int(c & 0x0f))
+	}
+	switch c {
+	case 0xc0:
+		return lua.LNil
+	case 0xc2:
+		return lua.LFalse
+	case 0xc3:
+		return lua.LTrue
+	case 0xcc:
+		return lua.LNumber(d.uint(1))
+	case 0xcd:
+		return lua.LNumber(d.uint(2))
+	case 0xce:
+		return lua.LNumber(d.uint(4))
+	case 0xcf:
+		return lua.LNumber(d.uint(8))
+	case 0xd0:
+		return lua.LNumber(int8(d.uint(1)))
+	case 0xd1:
+		return lua.LNumber(int16(d.uint(2)))
+	case 0xd2:
+		return lua.LNumber(int32(d.uint(4)))
+	case 0xd3:
+		return lua.LNumber(int64(d.uint(8)))
+	case 0xca:
+		return lua.LNumber(math.Float32frombits(uint32(d.uint(4))))
+	case 0xcb:
+		return lua.LNumber(math.Float64frombits(d.uint(8)))
+	case 0xd9, 0xc4:
+		return lua.LString(d.bytes(int(d.uint(1))))
+	case 0xda, 0xc5:
+		return lua.LString(d.bytes(int(d.uint(2))))
+	case 0xdb, 0xc6:
+		return lua.LString(d.bytes(int(d.uint(4))))
+	case 0xdc:
+		return d.array(int(d.uint(2)))
+	case 0xdd:
+		return d.array(int(d.uint(4)))
+	case 0xde:
+		return d.table(int(d.uint(2)))
+	case 0xdf:
+		return d.table(int(d.uint(4)))
+	}
+	d.l.RaiseError("Bad data format in input.")
+	return lua.LNil
+}
+
+func (d *msgpackDecoder) array(n int) lua.LValue {
+	t := d.l.NewTable()
+	for i := 1; i <= n; i++ {
+		t.RawSetInt(i, d.decode())
+	}
+	return t
+}
+
+func (d *msgpackDecoder) table(n int) lua.LValue {
+	t := d.l.NewTable()
+	for i := 0; i < n; i++ {
+		k := d.decode()
+		v := d.decode()
+		if k != lua.LNil {
+			t.RawSet(k, v)
+		}
+	}
+	return t
+}
@@ -0,0 +1,315 @@
+package miniredis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// The "struct" Lua library, as in
+// http://www.inf.puc-rio.br/~roberto/struct/, which Redis loads.
+//
+// Format options:
+//
+//	> big endian, < little endian, = native (little) endian
+//	![n] max alignment n (default 8)
+//	x padding byte
+//	b/B signed/unsigned char, h/H short, l/L long, T size_t
+//	i/I[n] signed/unsigned integer with n bytes (default 4)
+//	f float, d double
+//	s zero-terminated string
+//	c[n] fixed length string. c0 is the length of the string, or, when
+//	unpacking, the previous value
+func mkLuaStruct() map[string]lua.LGFunction {
+	return map[string]lua.LGFunction{
+		"pack":   luaStructPack,
+		"unpack": luaStructUnpack,
+		"size":   luaStructSize,
+	}
+}
+
+const luaStructMaxIntSize = 8
+
+// structFormat walks over a struct format string.
+type structFormat struct {
+	l        *lua.LState
+	fmt      string
+	pos      int
+	little   bool
+	maxAlign int
+}
+
+func newStructFormat(l *lua.LState, f string) *structFormat {
+	return &structFormat{
+		l:        l,
+		fmt:      f,
+		little:   true,
+		maxAlign: 1,
+	}
+}
+
+// number reads an optional number from the format.
+func (f *structFormat) number(def int) int {
+	if f.pos >= len(f.fmt) || f.fmt[f.pos] < '0' || f.fmt[f.pos] > '9' {
+		return def
+	}
+	n := 0
+	for f.pos < len(f.fmt) && f.fmt[f.pos] >= '0' && f.fmt[f.pos] <= '9' {
+		n = n*10 + int(f.fmt[f.pos]-'0')
+		f.pos++
+	}
+	return n
+}
+
+// next returns the next option, and its size. Returns 0 when done.
+func (f *structFormat) next() (byte, int) {
+	for f.pos < len(f.fmt) {
+		opt := f.fmt[f.pos]
+		f.pos++
+		switch opt {
+		case ' ':
+		case '>':
+			f.little = false
+		case '<', '=':
+			f.little = true
+		case '!':
+			f.maxAlign = f.number(8)
+		case 'x', 'b', 'B':
+			return opt, 1
+		case 'h', 'H':
+			return opt, 2
+		case 'l', 'L', 'T':
+			return opt, 8
+		case 'f':
+			return opt, 4
+		case 'd':
+			return opt, 8
+		case 's':
+			return opt, 0
+		case 'c':
+			return opt, f.number(1)
+		case 'i', 'I':
+			n := f.number(4)
+			if n > luaStructMaxIntSize {
+				f.l.RaiseError("integral size %d is larger than limit of %d", n, luaStructMaxIntSize)
+			}
+			return opt, n
+		default:
+			f.l.RaiseError("invalid format option '%c'", opt)
+		}
+	}
+	return 0, 0
+}
+
+// align gives the padding needed before an option of size n at position
+// pos.
+func (f *structFormat) align(opt byte, size, pos int) int {
+	if opt == 'c' || opt == 's' || opt == 'x' {
+		return 0
+	}
+	a := size
+	if a > f.maxAlign {
+		a = f.maxAlign
+	}
+	if a <= 1 || a&(a-1) != 0 {
+		return 0
+	}
+	return (a - pos%a) % a
+}
+
+func (f *structFormat) putInt(buf *bytes.Buffer, v uint64, size int) {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, v)
+	b = b[:size]
+	if !f.little {
+		for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+			b[i], b[j] = b[j], b[i]
+		}
+	}
+	buf.Write(b)
+}
+
+func (f *structFormat) getInt(b []byte, signed bool) lua.LNumber {
+	var v uint64
+	for i := range b {
+		idx := len(b) - 1 - i
+		if !f.little {
+			idx = i
+		}
+		v = v<<8 | uint64(b[idx])
+	}
+	if signed && len(b) < 8 && v&(1<<(uint(len(b))*8-1)) != 0 {
+		v |= ^uint64(0) << (uint(len(b)) * 8)
+	}
+	if signed {
+		return lua.LNumber(int64(v))
+	}
+	return lua.LNumber(v)
+}
+
+func luaStructPack(l *lua.LState) int {
+	var (
+		f   = newStructFormat(l, l.CheckString(1))
+		buf = &bytes.Buffer{}
+		arg = 2
+	)
+	for {
+		opt, size := f.next()
+		if opt == 0 {
+			break
+		}
+		buf.Write(make([]byte, f.align(opt, size, buf.Len())))
+		switch opt {
+		case 'x':
+			buf.WriteByte(0)
+			continue
+		case 'b', 'B', 'h', 'H', 'l', 'L', 'T', 'i', 'I':
+			n := float64(l.CheckNumber(arg))
+			var v uint64
+			if n < 0 {
+				v = uint64(int64(n))
+			} else {
+				v = uint64(n)
+			}
+			f.putInt(buf, v, size)
+		case 'f':
+			b := make([]byte, 4)
+			if f.little {
+				binary.LittleEndian.PutUint32(b, math.Float32bits(float32(l.CheckNumber(arg))))
+			} else {
+				binary.BigEndian.PutUint32(b, math.Float32bits(float32(l.CheckNumber(arg))))
+			}
+			buf.Write(b)
+		case 'd':
+			b := make([]byte, 8)
+			if f.little {
+				binary.LittleEndian.PutUint64(b, math.Float64bits(float64(l.CheckNumber(arg))))
+			} else {
+				binary.BigEndian.PutUint64(b, math.Float64bits(float64(l.CheckNumber(arg))))
+			}
+			buf.Write(b)
+		case 'c':
+			s := l.CheckString(arg)
+			if size == 0 {
+				size = len(s)
+			}
+			if len(s) < size {
+				l.ArgError(arg, "string too short")
+			}
+			buf.WriteString(s[:size])
+		case 's':
+			s := l.CheckString(arg)
+			if strings.IndexByte(s, 0) >= 0 {
+				l.ArgError(arg, "string contains zeros")
+			}
+			buf.WriteString(s)
+			buf.WriteByte(0)
+		}
+		arg++
+	}
+	l.Push(lua.LString(buf.String()))
+	return 1
+}
+
+func luaStructUnpack(l *lua.LState) int {
+	var (
+		f    = newStructFormat(l, l.CheckString(1))
+		data = l.CheckString(2)
+		pos  = l.OptInt(3, 1) - 1
+		n    = 0
+	)
+	if pos < 0 {
+		l.ArgError(3, "offset must be 1 or greater")
+	}
+	for {
+		opt, size := f.next()
+		if opt == 0 {
+			break
+		}
+		pos += f.align(opt, size, pos)
+		if pos > len(data) || (opt != 's' && pos+size > len(data)) {
+			l.ArgError(2, "data string too short")
+		}
+		switch opt {
+		case 'x':
+		case 'b', 'h', 'l', 'i':
+			l.Push(f.getInt([]byte(data[pos:pos+size]), true))
+			n++
+		case 'B', 'H', 'L', 'T', 'I':
+			l.Push(f.getInt([]byte(data[pos:pos+size]), false))
+			n++
+		case 'f':
+			b := []byte(data[pos : pos+4])
+			var v uint32
+			if f.little {
+				v = binary.LittleEndian.Uint32(b)
+			} else {
+				v = binary.BigEndian.Uint32(b)
+			}
+			l.Push(lua.LNumber(math.Float32frombits(v)))
+			n++
+		case 'd':
+			b := []byte(data[pos : pos+8])
+			var v uint64
+			if f.little {
+				v = binary.LittleEndian.Uint64(b)
+			} else {
+				v = binary.BigEndian.Uint64(b)
+			}
+			l.Push(lua.LNumber(math.Float64frombits(v)))
+			n++
+		case 'c':
+			if size == 0 {
+				// the length is the previous value
+				if n == 0 {
+					l.RaiseError("format 'c0' needs a previous size")
+				}
+				prev, ok := l.Get(-1).(lua.LNumber)
+				if !ok {
+					l.RaiseError("format 'c0' needs a previous size")
+				}
+				l.Pop(1)
+				n--
+				size = int(prev)
+				if pos+size > len(data) {
+					l.ArgError(2, "data string too short")
+				}
+			}
+			l.Push(lua.LString(data[pos : pos+size]))
+			n++
+		case 's':
+			e := strings.IndexByte(data[pos:], 0)
+			if e < 0 {
+				l.RaiseError("unfinished string in data")
+			}
+			l.Push(lua.LString(data[pos : pos+e]))
+			n++
+			size = e + 1
+		}
+		pos += size
+	}
+	l.Push(lua.LNumber(pos + 1))
+	return n + 1
+}
+
+func luaStructSize(l *lua.LState) int {
+	var (
+		f   = newStructFormat(l, l.CheckString(1))
+		pos = 0
+	)
+	for {
+		opt, size := f.next()
+		if opt == 0 {
+			break
+		}
+		if opt == 's' || (opt == 'c' && size == 0) {
+			l.ArgError(1, "options 'c0' - 's' have undefined sizes")
+		}
+		pos += f.align(opt, size, pos) + size
+	}
+	l.Push(lua.LNumber(pos))
+	return 1
+}
@@ -56,18 +56,39 @@ type RedisDB struct {
 // Miniredis is a Redis server implementation.
 type Miniredis struct {
 	sync.Mutex
-	srv         *server.Server
-	port        int
-	passwords   map[string]string // username password
-	dbs         map[int]*RedisDB
-	selectedDB  int               // DB id used in the direct Get(), Set() &c.
-	scripts     map[string]string // sha1 -> lua src
-	signal      *sync.Cond
-	now         time.Time // time.Now() if not set.
-	subscribers map[*Subscriber]struct{}
-	rand        *rand.Rand
-	Ctx         context.Context
-	CtxCancel   context.CancelFunc
+	srv          *server.Server
+	port         int
+	passwords    map[string]string // username password
+	dbs          map[int]*RedisDB
+	selectedDB   int                    // DB id used in the direct Get(), Set() &c.
+	scripts      map[string]string      // sha1 -> lua src
+	libraries    map[string]*luaLibrary // FUNCTION LOAD
+	signal       *sync.Cond
+	now          time.Time     // time.Now() if not set.
+	clock        Clock         // see SetClock(). nil is the real time
+	noTouch      bool          // current command is from a CLIENT NO-TOUCH client
+	pauseLeft    time.Duration // CLIENT PAUSE timeout, decreased by FastForward() and the clock
+	pauseStop    chan struct{} // stops the CLIENT PAUSE clock timer
+	virtualTO    bool          // blocking timeouts use FastForward(), see SetVirtualTimeouts()
+	forwarded    time.Duration // total of all FastForward() calls
+	activeExpire bool          // TTLs count down in real time, see SetActiveExpire()
+	expireTick   time.Time     // when TTLs were last decreased by passTime()
+	expireStop   chan struct{} // stops the active expire cycle
+	expiredKeys  int           // for INFO stats
+	curPeer      *server.Peer  // client running the current command, if any
+	subscribers  map[*Subscriber]struct{}
+	tracking     trackingTable // CLIENT TRACKING
+	monitors     monitors      // MONITOR
+	slowlog      slowlog       // SLOWLOG
+	latency      latency       // SetLatency() and LATENCY
+	errors       errorRules    // SetError(), SetState(), and InjectError()
+	script       scriptRun     // the running script, for SCRIPT KILL
+	cover        *scriptCover  // see EnableScriptCoverage(). nil if disabled
+	clusterMode  bool          // see EnableClusterMode()
+	debug        debugState    // see EnableDebugCommand()
+	rand         *rand.Rand
+	Ctx          context.Context
+	CtxCancel    context.CancelFunc
 }
 
 type txCmd func(*server.Peer, *connCtx)
@@ -83,12 +104,20 @@ type dbKey struct {
 type connCtx struct {
 	selectedDB       int            // selected DB
 	authenticated    bool           // auth enabled and a valid AUTH seen
+	user             string         // user from the last valid AUTH. "" is "default"
 	transaction      []txCmd        // transaction callbacks. Or nil.
+	txCmds           [][]string     // the queued commands, for SetLatency()
 	dirtyTransaction bool           // any error during QUEUEing
 	watch            map[dbKey]uint // WATCHed keys
 	subscriber       *Subscriber    // client is in PUBSUB mode if not nil
 	nested           bool           // this is called via Lua
 	nestedSHA        string         // set to the SHA of the nesting function
+	noEvict          bool           // CLIENT NO-EVICT
+	noTouch          bool           // CLIENT NO-TOUCH
+	tracking         *tracking      // CLIENT TRACKING, nil when off
+	blocked          time.Duration  // time the current command spent waiting
+	scriptDebug      scriptDebug    // SCRIPT DEBUG
+	ldb              *ldb           // the running debug session, or nil
 }
 
 // NewMiniRedis makes a new, non-started, Miniredis object.
@@ -96,7 +125,12 @@ func NewMiniRedis() *Miniredis {
 	m := Miniredis{
 		dbs:         map[int]*RedisDB{},
 		scripts:     map[string]string{},
+		libraries:   map[string]*luaLibrary{},
 		subscribers: map[*Subscriber]struct{}{},
+		tracking:    newTrackingTable(),
+		slowlog:     newSlowlog(),
+		latency:     newLatency(),
+		script:      scriptRun{busyTime: defaultBusyScriptTime},
 	}
 	m.Ctx, m.CtxCancel = context.WithCancel(context.Background())
 	m.signal = sync.NewCond(&m)
@@ -224,11 +258,18 @@ func (m *Miniredis) start(s *server.Server) error {
 	commandsStream(m)
 	commandsTransaction(m)
 	commandsScripting(m)
+	commandsFunctions(m)
 	commandsGeo(m)
 	commandsCluster(m)
 	commandsHll(m)
 	commandsClient(m)
 	commandsObject(m)
+	commandsDebug(m)
+	s.SetPreHook(m.errorHook)
+	s.SetPostHook(m.postHook)
+	if m.activeExpire {
+		m.startExpireCycle()
+	}
 
 	return nil
 }
@@ -250,10 +291,13 @@ func (m *Miniredis) Close() {
 	srv := m.srv
 	m.srv = nil
 	m.CtxCancel()
+	m.stopExpireCycle()
+	m.unpause()
 	m.Unlock()
 
 	// the OnDisconnect callbacks can lock m, so run Close() outside the lock.
 	srv.Close()
+	m.closeMonitors()
 
 }
 
@@ -283,6 +327,7 @@ func (m *Miniredis) RequireUserAuth(username, pw string) {
 func (m *Miniredis) DB(i int) *RedisDB {
 	m.Lock()
 	defer m.Unlock()
+	m.passTime()
 	return m.db(i)
 }
 
@@ -368,6 +413,21 @@ func (m *Miniredis) FastForward(duration time.Duration) {
 	for _, db := range m.dbs {
 		db.fastForward(duration)
 	}
+	m.passPause(duration)
+	m.forwarded += duration
+	// blocked commands might time out
+	m.signal.Broadcast()
+}
+
+// SetVirtualTimeouts makes the timeouts of blocking commands (BLPOP, BRPOP,
+// BLMOVE, BRPOPLPUSH, XREAD, XREADGROUP, and WAIT) pass only with
+// FastForward(), instead of in real time. A blocked BLPOP with a 30 second
+// timeout will time out after m.FastForward(30*time.Second). WAIT with
+// numreplicas > 0 blocks until its timeout, since there are no replicas.
+func (m *Miniredis) SetVirtualTimeouts(on bool) {
+	m.Lock()
+	defer m.Unlock()
+	m.virtualTO = on
 }
 
 // Server returns the underlying server to allow custom commands to be implemented
@@ -465,15 +525,12 @@ func (m *Miniredis) SetTime(t time.Time) {
 //	MASTERDOWN Link with MASTER is down and replica-serve-stale-data is set to 'no'.
 //
 // Clear it with an empty string. Don't add newlines.
+//
+// See InjectError() for errors for specific commands.
 func (m *Miniredis) SetError(msg string) {
-	cb := server.Hook(nil)
-	if msg != "" {
-		cb = func(c *server.Peer, cmd string, args ...string) bool {
-			c.WriteError(msg)
-			return true
-		}
-	}
-	m.srv.SetPreHook(cb)
+	m.errors.mu.Lock()
+	defer m.errors.mu.Unlock()
+	m.errors.msg = msg
 }
 
 type argRequirements struct {
@@ -511,6 +568,28 @@ func (m *Miniredis) isValidCMD(c *server.Peer, cmd string, args []string, argReq
 	return true
 }
 
+// postHook is called by the server after every command.
+func (m *Miniredis) postHook(c *server.Peer, cmd []string, d time.Duration) {
+	ctx := getCtx(c)
+	if inTx(ctx) && !strings.EqualFold(cmd[0], "MULTI") {
+		// queued, we'll see it again in EXEC
+		return
+	}
+	m.feedMonitors(c, ctx, cmd)
+
+	d -= ctx.blocked
+	ctx.blocked = 0
+	if ctx.nested {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	if !strings.EqualFold(cmd[0], "EXEC") {
+		// commands from EXEC are logged one by one
+		m.slowlog.add(m.effectiveNow(), c, cmd, d)
+	}
+}
+
 // handleAuth returns false if connection has no access. It sends the reply.
 func (m *Miniredis) handleAuth(c *server.Peer) bool {
 	if getCtx(c).nested {
@@ -558,18 +637,23 @@ func (m *Miniredis) checkPubsub(c *server.Peer, cmd string) bool {
 
 func getCtx(c *server.Peer) *connCtx {
 	if c.Ctx == nil {
-		c.Ctx = &connCtx{}
+		// other connections read Ctx with Inspect()
+		c.Inspect(func() {
+			c.Ctx = &connCtx{}
+		})
 	}
 	return c.Ctx.(*connCtx)
 }
 
 func startTx(ctx *connCtx) {
 	ctx.transaction = []txCmd{}
+	ctx.txCmds = nil
 	ctx.dirtyTransaction = false
 }
 
 func stopTx(ctx *connCtx) {
 	ctx.transaction = nil
+	ctx.txCmds = nil
 	unwatch(ctx)
 }
 
@@ -577,8 +661,9 @@ func inTx(ctx *connCtx) bool {
 	return ctx.transaction != nil
 }
 
-func addTxCmd(ctx *connCtx, cb txCmd) {
+func addTxCmd(ctx *connCtx, cmd []string, cb txCmd) {
 	ctx.transaction = append(ctx.transaction, cb)
+	ctx.txCmds = append(ctx.txCmds, cmd)
 }
 
 func watch(db *RedisDB, ctx *connCtx, key string) {
@@ -685,6 +770,10 @@ func (m *Miniredis) Seed(seed int) {
 
 	// m.rand is not safe for concurrent use.
 	m.rand = rand.New(rand.NewSource(int64(seed)))
+
+	m.errors.mu.Lock()
+	defer m.errors.mu.Unlock()
+	m.errors.rand = rand.New(rand.NewSource(int64(seed)))
 }
 
 func (m *Miniredis) randIntn(n int) int {
@@ -707,7 +796,7 @@ func (m *Miniredis) effectiveNow() time.Time {
 	if !m.now.IsZero() {
 		return m.now
 	}
-	return time.Now().UTC()
+	return m.clockNow().UTC()
 }
 
 // convert a unixtimestamp to a duration, to use an absolute time as TTL.
@@ -3,6 +3,7 @@ package miniredis
 import (
 	"bufio"
 	"bytes"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -63,6 +64,245 @@ func TestRestart(t *testing.T) {
 	)
 }
 
+func TestNetworkFaults(t *testing.T) {
+	s, c := runWithClient(t)
+	mustOK(t, c, "XGROUP", "CREATE", "planets", "processing", "$", "MKSTREAM")
+
+	f := s.Server().AddFault(server.Fault{
+		Cmd:    "XREADGROUP",
+		Skip:   3,
+		Count:  1,
+		Action: server.FaultClose,
+	})
+	for i := 0; i < 3; i++ {
+		mustNilList(t, c, "XREADGROUP", "GROUP", "processing", "alice", "STREAMS", "planets", ">")
+	}
+	_, err := c.Do("XREADGROUP", "GROUP", "processing", "alice", "STREAMS", "planets", ">")
+	assert(t, err != nil, "connection closed")
+	equals(t, 1, f.Fired())
+
+	c2, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer c2.Close()
+	mustNilList(t, c2, "XREADGROUP", "GROUP", "processing", "alice", "STREAMS", "planets", ">")
+}
+
+func TestVirtualTimeouts(t *testing.T) {
+	s, c := runWithClient(t)
+	s.SetVirtualTimeouts(true)
+
+	// waitBlocked waits until c is blocked, and checks it stays blocked.
+	waitBlocked := func(t *testing.T, done chan string) {
+		t.Helper()
+		select {
+		case res := <-done:
+			t.Fatalf("not blocked: %q", res)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	do := func(args ...string) chan string {
+		done := make(chan string, 1)
+		go func() {
+			res, err := c.Do(args...)
+			ok(t, err)
+			done <- res
+		}()
+		return done
+	}
+
+	t.Run("BLPOP", func(t *testing.T) {
+		done := do("BLPOP", "q", "30")
+		waitBlocked(t, done)
+		s.FastForward(29 * time.Second)
+		waitBlocked(t, done)
+		s.FastForward(time.Second)
+		equals(t, proto.NilList, <-done)
+	})
+
+	t.Run("BLMOVE", func(t *testing.T) {
+		done := do("BLMOVE", "q", "q2", "LEFT", "RIGHT", "1.5")
+		waitBlocked(t, done)
+		s.FastForward(2 * time.Second)
+		equals(t, proto.NilList, <-done)
+	})
+
+	t.Run("XREADGROUP", func(t *testing.T) {
+		mustOK(t, c, "XGROUP", "CREATE", "planets", "processing", "$", "MKSTREAM")
+		done := do("XREADGROUP", "GROUP", "processing", "alice", "BLOCK", "30000", "STREAMS", "planets", ">")
+		waitBlocked(t, done)
+		s.FastForward(30 * time.Second)
+		equals(t, proto.NilList, <-done)
+	})
+
+	t.Run("WAIT", func(t *testing.T) {
+		must0(t, c, "WAIT", "0", "1000")
+		done := do("WAIT", "1", "1000")
+		waitBlocked(t, done)
+		s.FastForward(time.Second)
+		equals(t, proto.Int(0), <-done)
+	})
+
+	t.Run("no timeout", func(t *testing.T) {
+		done := do("BLPOP", "q", "0")
+		waitBlocked(t, done)
+		s.FastForward(time.Hour)
+		waitBlocked(t, done)
+		s.Lpush("q", "hello")
+		equals(t, proto.Strings("q", "hello"), <-done)
+	})
+}
+
+func TestActiveExpire(t *testing.T) {
+	s, c := runWithClient(t)
+	s.SetActiveExpire(true)
+
+	sub, err := proto.Dial(s.Addr())
+	ok(t, err)
+	defer sub.Close()
+	mustDo(t, sub, "SUBSCRIBE", "__keyevent@0__:expired",
+		proto.Array(
+			proto.String("subscribe"),
+			proto.String("__keyevent@0__:expired"),
+			proto.Int(1),
+		),
+	)
+
+	t.Run("background cycle", func(t *testing.T) {
+		mustOK(t, c, "SET", "foo", "bar", "PX", "50")
+		res, err := sub.Read()
+		ok(t, err)
+		equals(t, proto.Strings("message", "__keyevent@0__:expired", "foo"), res)
+		assert(t, !s.Exists("foo"), "foo expired")
+	})
+
+	t.Run("lazy", func(t *testing.T) {
+		mustOK(t, c, "SET", "foo", "bar", "PX", "10")
+		time.Sleep(20 * time.Millisecond)
+		mustNil(t, c, "GET", "foo")
+		res, err := sub.Read()
+		ok(t, err)
+		equals(t, proto.Strings("message", "__keyevent@0__:expired", "foo"), res)
+	})
+
+	t.Run("hash fields", func(t *testing.T) {
+		must1(t, c, "HSET", "h", "f1", "v1")
+		must1(t, c, "HSET", "h", "f2", "v2")
+		mustDo(t, c, "HEXPIRE", "h", "1", "FIELDS", "1", "f1", proto.Ints(1))
+		time.Sleep(1100 * time.Millisecond)
+		mustDo(t, c, "HKEYS", "h", proto.Strings("f2"))
+	})
+
+	t.Run("INFO", func(t *testing.T) {
+		mustContain(t, c, "INFO", "expired_keys:2\r\n")
+	})
+
+	t.Run("off", func(t *testing.T) {
+		s.SetActiveExpire(false)
+		mustOK(t, c, "SET", "foo", "bar", "PX", "10")
+		time.Sleep(20 * time.Millisecond)
+		must1(t, c, "EXISTS", "foo")
+		s.FastForward(10 * time.Millisecond)
+		must0(t, c, "EXISTS", "foo")
+	})
+}
+
+func TestClock(t *testing.T) {
+	s, c := runWithClient(t)
+	start := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	s.SetClock(clock)
+
+	t.Run("TTL", func(t *testing.T) {
+		mustOK(t, c, "SET", "foo", "bar", "EX", "10")
+		clock.Advance(9 * time.Second)
+		must1(t, c, "TTL", "foo")
+		clock.Advance(time.Second)
+		must0(t, c, "EXISTS", "foo")
+
+		s.Set("foo", "bar")
+		s.SetTTL("foo", time.Minute)
+		clock.Advance(time.Minute)
+		assert(t, !s.Exists("foo"), "foo expired")
+	})
+
+	t.Run("TIME", func(t *testing.T) {
+		mustDo(t, c, "TIME", proto.Strings(
+			strconv.FormatInt(clock.Now().Unix(), 10),
+			"0",
+		))
+	})
+
+	t.Run("streams", func(t *testing.T) {
+		id := strconv.FormatInt(clock.Now().UnixNano()/int64(time.Millisecond), 10) + "-0"
+		mustDo(t, c, "XADD", "planets", "*", "name", "Mercury", proto.String(id))
+
+		mustOK(t, c, "XGROUP", "CREATE", "planets", "processing", "0")
+		_, err := c.Do("XREADGROUP", "GROUP", "processing", "alice", "STREAMS", "planets", ">")
+		ok(t, err)
+		clock.Advance(3 * time.Second)
+		mustDo(t, c, "XPENDING", "planets", "processing", "-", "+", "1",
+			proto.Array(
+				proto.Array(
+					proto.String(id),
+					proto.String("alice"),
+					proto.Int(3000),
+					proto.Int(1),
+				),
+			),
+		)
+	})
+
+	t.Run("OBJECT IDLETIME", func(t *testing.T) {
+		mustOK(t, c, "SET", "idle", "bar")
+		clock.Advance(5 * time.Second)
+		mustDo(t, c, "OBJECT", "IDLETIME", "idle", proto.Int(5))
+	})
+
+	t.Run("blocking timeout", func(t *testing.T) {
+		done := make(chan string, 1)
+		go func() {
+			res, err := c.Do("BLPOP", "q", "30")
+			ok(t, err)
+			done <- res
+		}()
+		select {
+		case res := <-done:
+			t.Fatalf("not blocked: %q", res)
+		case <-time.After(20 * time.Millisecond):
+		}
+		clock.Advance(30 * time.Second)
+		equals(t, proto.NilList, <-done)
+	})
+
+	t.Run("CLIENT PAUSE", func(t *testing.T) {
+		c2, err := proto.Dial(s.Addr())
+		ok(t, err)
+		defer c2.Close()
+
+		mustOK(t, c, "CLIENT", "PAUSE", "10000", "WRITE")
+		done := make(chan string, 1)
+		go func() {
+			res, _ := c2.Do("SET", "paused", "bar")
+			done <- res
+		}()
+		clock.Advance(9 * time.Second)
+		select {
+		case res := <-done:
+			t.Fatalf("not paused: %q", res)
+		case <-time.After(20 * time.Millisecond):
+		}
+		clock.Advance(time.Second)
+		equals(t, proto.Inline("OK"), <-done)
+	})
+
+	t.Run("real time", func(t *testing.T) {
+		s.SetClock(nil)
+		mustOK(t, c, "SET", "foo", "bar", "EX", "10")
+		clock.Advance(time.Minute)
+		must1(t, c, "EXISTS", "foo")
+	})
+}
+
 // Test a custom addr
 func TestAddr(t *testing.T) {
 	m := NewMiniRedis()
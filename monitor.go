@@ -0,0 +1,181 @@
+package miniredis
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// MonitorEvent is a single command, as seen by MONITOR.
+type MonitorEvent struct {
+	Time time.Time
+	DB   int
+	Addr string   // "ip:port" of the client, or "lua" for commands from scripts
+	Cmd  []string // command with arguments, as sent by the client
+}
+
+// String formats the event the way MONITOR does, without the "+".
+func (e MonitorEvent) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d.%06d [%d %s]", e.Time.Unix(), e.Time.Nanosecond()/1000, e.DB, e.Addr)
+	for _, a := range e.Cmd {
+		b.WriteString(" ")
+		b.WriteString(monitorQuote(a))
+	}
+	return b.String()
+}
+
+// monitorQuote quotes and escapes a string the way MONITOR does.
+func monitorQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\a':
+			b.WriteString(`\a`)
+		case '\b':
+			b.WriteString(`\b`)
+		default:
+			if c >= ' ' && c <= '~' {
+				b.WriteByte(c)
+			} else {
+				fmt.Fprintf(&b, `\x%02x`, c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// monitors are the MONITOR connections and the Monitor() channels. This has
+// its own lock, since commands from Lua run with the main lock held.
+type monitors struct {
+	mu    sync.Mutex
+	peers map[*server.Peer]struct{}
+	chans []chan<- MonitorEvent
+}
+
+// Monitor returns a channel which gets every command run by any client,
+// the same as the MONITOR command. The channel is closed on Close().
+func (m *Miniredis) Monitor() <-chan MonitorEvent {
+	in := make(chan MonitorEvent)
+	out := make(chan MonitorEvent)
+	go func() {
+		// buffer everything, so commands never wait on a slow reader.
+		defer close(out)
+		var queue []MonitorEvent
+		for in != nil || len(queue) > 0 {
+			var (
+				send chan MonitorEvent
+				next MonitorEvent
+			)
+			if len(queue) > 0 {
+				send, next = out, queue[0]
+			}
+			select {
+			case ev, ok := <-in:
+				if !ok {
+					in = nil
+					continue
+				}
+				queue = append(queue, ev)
+			case send <- next:
+				queue = queue[1:]
+			}
+		}
+	}()
+
+	m.monitors.mu.Lock()
+	defer m.monitors.mu.Unlock()
+	m.monitors.chans = append(m.monitors.chans, in)
+	return out
+}
+
+func (m *Miniredis) addMonitor(c *server.Peer) {
+	m.monitors.mu.Lock()
+	defer m.monitors.mu.Unlock()
+	if m.monitors.peers == nil {
+		m.monitors.peers = map[*server.Peer]struct{}{}
+	}
+	m.monitors.peers[c] = struct{}{}
+	c.OnDisconnect(func() {
+		m.monitors.mu.Lock()
+		defer m.monitors.mu.Unlock()
+		delete(m.monitors.peers, c)
+	})
+}
+
+// closeMonitors closes all Monitor() channels.
+func (m *Miniredis) closeMonitors() {
+	m.monitors.mu.Lock()
+	defer m.monitors.mu.Unlock()
+	for _, ch := range m.monitors.chans {
+		close(ch)
+	}
+	m.monitors.chans = nil
+}
+
+// feedMonitors sends a command to all monitors.
+func (m *Miniredis) feedMonitors(c *server.Peer, ctx *connCtx, cmd []string) {
+	m.monitors.mu.Lock()
+	defer m.monitors.mu.Unlock()
+
+	if len(m.monitors.peers) == 0 && len(m.monitors.chans) == 0 {
+		return
+	}
+	if strings.EqualFold(cmd[0], "MONITOR") {
+		return
+	}
+
+	ev := MonitorEvent{
+		Time: time.Now(),
+		DB:   ctx.selectedDB,
+		Addr: c.Addr(),
+		Cmd:  redactCmd(cmd),
+	}
+	if ctx.nested {
+		ev.Addr = "lua"
+	}
+	line := ev.String()
+	for p := range m.monitors.peers {
+		p.Push(func(w *server.Writer) {
+			w.WriteInline(line)
+			w.Flush()
+		})
+	}
+	for _, ch := range m.monitors.chans {
+		ch <- ev
+	}
+}
+
+// redactCmd hides passwords.
+func redactCmd(cmd []string) []string {
+	res := append([]string{}, cmd...)
+	switch strings.ToUpper(cmd[0]) {
+	case "AUTH":
+		for i := 1; i < len(res); i++ {
+			res[i] = "(redacted)"
+		}
+	case "HELLO":
+		for i := 1; i < len(res)-2; i++ {
+			if strings.EqualFold(res[i], "AUTH") {
+				res[i+1] = "(redacted)"
+				res[i+2] = "(redacted)"
+				i += 2
+			}
+		}
+	}
+	return res
+}
@@ -2,13 +2,17 @@ package proto
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"net"
+	"time"
 )
 
 type Client struct {
-	c net.Conn
-	r *bufio.Reader
+	c      net.Conn
+	r      *bufio.Reader
+	w      *bufio.Writer
+	onPush func(Value)
 }
 
 func Dial(addr string) (*Client, error) {
@@ -17,10 +21,7 @@ func Dial(addr string) (*Client, error) {
 		return nil, err
 	}
 
-	return &Client{
-		c: c,
-		r: bufio.NewReader(c),
-	}, nil
+	return NewClient(c), nil
 }
 
 func DialTLS(addr string, cfg *tls.Config) (*Client, error) {
@@ -29,25 +30,54 @@ func DialTLS(addr string, cfg *tls.Config) (*Client, error) {
 		return nil, err
 	}
 
+	return NewClient(c), nil
+}
+
+// NewClient uses an existing connection.
+func NewClient(c net.Conn) *Client {
 	return &Client{
 		c: c,
 		r: bufio.NewReader(c),
-	}, nil
+		w: bufio.NewWriter(c),
+	}
 }
 
 func (c *Client) Close() error {
 	return c.c.Close()
 }
 
+// OnPush makes all RESP3 push data (`>...`) go to f, instead of being returned
+// by Read() and friends as if it's a reply. f is called from whichever method
+// is reading at that moment. Use nil to go back to the default.
+func (c *Client) OnPush(f func(Value)) {
+	c.onPush = f
+}
+
 func (c *Client) Do(cmd ...string) (string, error) {
-	if err := Write(c.c, cmd); err != nil {
+	if err := c.Send(cmd...); err != nil {
 		return "", err
 	}
-	return Read(c.r)
+	if err := c.Flush(); err != nil {
+		return "", err
+	}
+	return c.Read()
 }
 
 func (c *Client) Read() (string, error) {
-	return Read(c.r)
+	for {
+		res, err := Read(c.r)
+		if err != nil {
+			return "", err
+		}
+		if c.onPush == nil || res[0] != '>' {
+			return res, nil
+		}
+		v, err := ParseValue(res)
+		if err != nil {
+			return "", err
+		}
+		c.onPush(v)
+	}
 }
 
 // Do() + ReadStrings()
@@ -58,3 +88,114 @@ func (c *Client) DoStrings(cmd ...string) ([]string, error) {
 	}
 	return ReadStrings(res)
 }
+
+// Do() + ParseValue()
+func (c *Client) DoValue(cmd ...string) (Value, error) {
+	res, err := c.Do(cmd...)
+	if err != nil {
+		return Value{}, err
+	}
+	return ParseValue(res)
+}
+
+// Read() + ParseValue()
+func (c *Client) ReadValue() (Value, error) {
+	res, err := c.Read()
+	if err != nil {
+		return Value{}, err
+	}
+	return ParseValue(res)
+}
+
+// Send queues a command. Nothing is sent until Flush().
+func (c *Client) Send(cmd ...string) error {
+	return Write(c.w, cmd)
+}
+
+// Flush sends all queued commands.
+func (c *Client) Flush() error {
+	return c.w.Flush()
+}
+
+// Pipeline sends all commands in one go, and then reads a reply for every
+// command.
+func (c *Client) Pipeline(cmds ...[]string) ([]string, error) {
+	for _, cmd := range cmds {
+		if err := c.Send(cmd...); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, len(cmds))
+	for range cmds {
+		r, err := c.Read()
+		if err != nil {
+			return res, err
+		}
+		res = append(res, r)
+	}
+	return res, nil
+}
+
+// DoContext is Do(), which gives up when the context is done. The connection
+// is in an unknown state after that, and should be closed.
+func (c *Client) DoContext(ctx context.Context, cmd ...string) (string, error) {
+	var res string
+	err := c.withContext(ctx, func() error {
+		var err error
+		res, err = c.Do(cmd...)
+		return err
+	})
+	return res, err
+}
+
+// PipelineContext is Pipeline(), which gives up when the context is done. The
+// connection is in an unknown state after that, and should be closed.
+func (c *Client) PipelineContext(ctx context.Context, cmds ...[]string) ([]string, error) {
+	var res []string
+	err := c.withContext(ctx, func() error {
+		var err error
+		res, err = c.Pipeline(cmds...)
+		return err
+	})
+	return res, err
+}
+
+// withContext uses the connection deadline to stop f when ctx is done.
+func (c *Client) withContext(ctx context.Context, f func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		c.c.SetDeadline(dl)
+	}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			c.c.SetDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+
+	err := f()
+	close(stop)
+	<-stopped
+	c.c.SetDeadline(time.Time{})
+
+	if err == nil {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// the connection deadline can fire just before the context notices
+	if dl, ok := ctx.Deadline(); ok && !time.Now().Before(dl) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
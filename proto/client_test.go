@@ -0,0 +1,190 @@
+package proto
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServer replies to every command with whatever reply() returns. It
+// doesn't reply at all to "HANG".
+func fakeServer(t *testing.T, reply func([]string) string) *Client {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			raw, err := Read(r)
+			if err != nil {
+				return
+			}
+			cmd, err := ReadStrings(raw)
+			if err != nil {
+				return
+			}
+			if cmd[0] == "HANG" {
+				continue
+			}
+			if _, err := conn.Write([]byte(reply(cmd))); err != nil {
+				return
+			}
+		}
+	}()
+
+	c, err := Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func echo(cmd []string) string {
+	return String(strings.Join(cmd, " "))
+}
+
+func TestClient(t *testing.T) {
+	c := fakeServer(t, echo)
+
+	res, err := c.Do("ECHO", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := res, String("ECHO hi"); have != want {
+		t.Errorf("have %q, want %q", have, want)
+	}
+
+	v, err := c.DoValue("ECHO", "ho")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := v, (Value{Kind: KindString, Str: "ECHO ho"}); !reflect.DeepEqual(have, want) {
+		t.Errorf("have %#v, want %#v", have, want)
+	}
+}
+
+func TestClientPipeline(t *testing.T) {
+	c := fakeServer(t, echo)
+
+	res, err := c.Pipeline(
+		[]string{"SET", "foo", "bar"},
+		[]string{"GET", "foo"},
+		[]string{"PING"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		String("SET foo bar"),
+		String("GET foo"),
+		String("PING"),
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("have %q, want %q", res, want)
+	}
+
+	// the same, by hand
+	for _, cmd := range []string{"one", "two"} {
+		if err := c.Send("ECHO", cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"ECHO one", "ECHO two"} {
+		v, err := c.ReadValue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Str != want {
+			t.Errorf("have %q, want %q", v.Str, want)
+		}
+	}
+}
+
+func TestClientPush(t *testing.T) {
+	c := fakeServer(t, func(cmd []string) string {
+		return Push(String("message"), String(cmd[0])) + Inline("OK")
+	})
+
+	// by default push data is a reply
+	res, err := c.Do("one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := res, Push(String("message"), String("one")); have != want {
+		t.Errorf("have %q, want %q", have, want)
+	}
+	if _, err := c.Read(); err != nil {
+		t.Fatal(err)
+	}
+
+	var pushed []Value
+	c.OnPush(func(v Value) {
+		pushed = append(pushed, v)
+	})
+	res, err = c.Do("two")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := res, Inline("OK"); have != want {
+		t.Errorf("have %q, want %q", have, want)
+	}
+	want := []Value{
+		{Kind: KindPush, Array: []Value{
+			{Kind: KindString, Str: "message"},
+			{Kind: KindString, Str: "two"},
+		}},
+	}
+	if !reflect.DeepEqual(pushed, want) {
+		t.Errorf("have %#v, want %#v", pushed, want)
+	}
+}
+
+func TestClientContext(t *testing.T) {
+	c := fakeServer(t, echo)
+
+	res, err := c.DoContext(context.Background(), "PING")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := res, String("PING"); have != want {
+		t.Errorf("have %q, want %q", have, want)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.DoContext(ctx, "HANG"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("have %v, want a deadline error", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := c.PipelineContext(ctx, []string{"HANG"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("have %v, want a canceled error", err)
+	}
+
+	if _, err := c.DoContext(ctx, "PING"); !errors.Is(err, context.Canceled) {
+		t.Errorf("have %v, want a canceled error", err)
+	}
+}
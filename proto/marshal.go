@@ -0,0 +1,596 @@
+package proto
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	valueType  = reflect.TypeOf(Value{})
+	bigIntType = reflect.TypeOf(big.Int{})
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Unmarshal parses a single reply into v, which must be a non-nil pointer.
+//
+//   - strings, verbatim strings, and big numbers go in strings and []byte.
+//   - integers, doubles, and booleans go in any numeric type and in bools.
+//     Strings are parsed if they hold a number, since RESP2 has no doubles.
+//   - big numbers, integers, and strings go in a big.Int.
+//   - arrays, sets, and push data go in slices and arrays.
+//   - maps go in Go maps, and in structs. Struct fields are matched by their
+//     `redis:"name"` tag, or by the field name, ignoring case. Flat arrays of
+//     key/value pairs, which is how RESP2 sends maps, work as well.
+//   - null sets pointers, slices, and maps to nil, and anything else to its
+//     zero value.
+//   - anything goes in a Value, and in an interface{}, where it's what
+//     Parse() would return.
+//
+// An error reply is returned as the error.
+func Unmarshal(reply string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("proto: Unmarshal needs a non-nil pointer")
+	}
+	val, err := ParseValue(reply)
+	if err != nil {
+		return err
+	}
+	if err := val.Err(); err != nil {
+		return err
+	}
+	return unmarshal(val, rv.Elem())
+}
+
+func unmarshalError(val Value, rv reflect.Value) error {
+	return fmt.Errorf("proto: can't unmarshal %s into %s", val.Kind, rv.Type())
+}
+
+func unmarshal(val Value, rv reflect.Value) error {
+	if rv.Type() == valueType {
+		rv.Set(reflect.ValueOf(val))
+		return nil
+	}
+	if val.Kind == KindNull {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+	if val.Kind == KindError && rv.Kind() != reflect.Interface {
+		// nested errors, such as in an EXEC reply
+		return val.Err()
+	}
+
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return unmarshal(val, rv.Elem())
+	case reflect.Interface:
+		if rv.NumMethod() != 0 {
+			return unmarshalError(val, rv)
+		}
+		v, err := toInterface(val)
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			rv.Set(reflect.Zero(rv.Type()))
+			return nil
+		}
+		rv.Set(reflect.ValueOf(v))
+		return nil
+	case reflect.String:
+		s, ok := scalarString(val)
+		if !ok {
+			return unmarshalError(val, rv)
+		}
+		rv.SetString(s)
+		return nil
+	case reflect.Bool:
+		switch val.Kind {
+		case KindBool:
+			rv.SetBool(val.Bool)
+		case KindInt:
+			rv.SetBool(val.Int != 0)
+		default:
+			return unmarshalError(val, rv)
+		}
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s, ok := scalarString(val)
+		if !ok {
+			return unmarshalError(val, rv)
+		}
+		n, err := strconv.ParseInt(s, 10, rv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("proto: can't unmarshal %q into %s", s, rv.Type())
+		}
+		rv.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s, ok := scalarString(val)
+		if !ok {
+			return unmarshalError(val, rv)
+		}
+		n, err := strconv.ParseUint(s, 10, rv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("proto: can't unmarshal %q into %s", s, rv.Type())
+		}
+		rv.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		if val.Kind == KindFloat {
+			rv.SetFloat(val.Float)
+			return nil
+		}
+		s, ok := scalarString(val)
+		if !ok {
+			return unmarshalError(val, rv)
+		}
+		f, err := strconv.ParseFloat(s, rv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("proto: can't unmarshal %q into %s", s, rv.Type())
+		}
+		rv.SetFloat(f)
+		return nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 && val.Kind == KindString {
+			rv.SetBytes([]byte(val.Str))
+			return nil
+		}
+		elems, ok := listElems(val)
+		if !ok {
+			return unmarshalError(val, rv)
+		}
+		sl := reflect.MakeSlice(rv.Type(), len(elems), len(elems))
+		for i, e := range elems {
+			if err := unmarshal(e, sl.Index(i)); err != nil {
+				return err
+			}
+		}
+		rv.Set(sl)
+		return nil
+	case reflect.Array:
+		elems, ok := listElems(val)
+		if !ok {
+			return unmarshalError(val, rv)
+		}
+		if len(elems) != rv.Len() {
+			return fmt.Errorf("proto: can't unmarshal %d elements into %s", len(elems), rv.Type())
+		}
+		for i, e := range elems {
+			if err := unmarshal(e, rv.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		entries, ok := mapEntries(val)
+		if !ok {
+			return unmarshalError(val, rv)
+		}
+		m := reflect.MakeMapWithSize(rv.Type(), len(entries))
+		for _, e := range entries {
+			k := reflect.New(rv.Type().Key()).Elem()
+			if err := unmarshal(e.Key, k); err != nil {
+				return err
+			}
+			v := reflect.New(rv.Type().Elem()).Elem()
+			if err := unmarshal(e.Value, v); err != nil {
+				return err
+			}
+			m.SetMapIndex(k, v)
+		}
+		rv.Set(m)
+		return nil
+	case reflect.Struct:
+		if rv.Type() == bigIntType {
+			s, ok := scalarString(val)
+			if !ok {
+				return unmarshalError(val, rv)
+			}
+			n, ok := new(big.Int).SetString(s, 10)
+			if !ok {
+				return fmt.Errorf("proto: can't unmarshal %q into %s", s, rv.Type())
+			}
+			rv.Set(reflect.ValueOf(*n))
+			return nil
+		}
+		entries, ok := mapEntries(val)
+		if !ok {
+			return unmarshalError(val, rv)
+		}
+		for _, e := range entries {
+			if e.Key.Kind != KindString {
+				return fmt.Errorf("proto: can't unmarshal a %s key into %s", e.Key.Kind, rv.Type())
+			}
+			i, ok := findField(rv.Type(), e.Key.Str)
+			if !ok {
+				continue
+			}
+			if err := unmarshal(e.Value, rv.Field(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return unmarshalError(val, rv)
+	}
+}
+
+// scalarString is a simple value as a string.
+func scalarString(val Value) (string, bool) {
+	switch val.Kind {
+	case KindString, KindBigNumber:
+		return val.Str, true
+	case KindInt:
+		return strconv.Itoa(val.Int), true
+	case KindFloat:
+		return formatFloat(val.Float), true
+	case KindBool:
+		if val.Bool {
+			return "1", true
+		}
+		return "0", true
+	default:
+		return "", false
+	}
+}
+
+// listElems are the elements of anything which looks like a list. Maps are
+// flattened.
+func listElems(val Value) ([]Value, bool) {
+	switch val.Kind {
+	case KindArray, KindSet, KindPush:
+		return val.Array, true
+	case KindMap:
+		var elems []Value
+		for _, e := range val.Map {
+			elems = append(elems, e.Key, e.Value)
+		}
+		return elems, true
+	default:
+		return nil, false
+	}
+}
+
+// mapEntries are the entries of a map, or of a flat array with key/value
+// pairs.
+func mapEntries(val Value) ([]MapEntry, bool) {
+	switch val.Kind {
+	case KindMap:
+		return val.Map, true
+	case KindArray:
+		if len(val.Array)%2 != 0 {
+			return nil, false
+		}
+		var entries []MapEntry
+		for i := 0; i < len(val.Array); i += 2 {
+			entries = append(entries, MapEntry{Key: val.Array[i], Value: val.Array[i+1]})
+		}
+		return entries, true
+	default:
+		return nil, false
+	}
+}
+
+// fieldName is the name of a struct field in a map, and whether it has the
+// omitempty option. "" if the field is skipped.
+func fieldName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" {
+		// unexported
+		return "", false
+	}
+	tag, ok := f.Tag.Lookup("redis")
+	if !ok {
+		return f.Name, false
+	}
+	parts := strings.Split(tag, ",")
+	name := parts[0]
+	if name == "-" && len(parts) == 1 {
+		return "", false
+	}
+	if name == "" {
+		name = f.Name
+	}
+	omitEmpty := false
+	for _, o := range parts[1:] {
+		if o == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	return name, omitEmpty
+}
+
+// findField finds the field for a key: an exact match, else ignoring case.
+func findField(t reflect.Type, key string) (int, bool) {
+	fold := -1
+	for i := 0; i < t.NumField(); i++ {
+		name, _ := fieldName(t.Field(i))
+		if name == "" {
+			continue
+		}
+		if name == key {
+			return i, true
+		}
+		if fold < 0 && strings.EqualFold(name, key) {
+			fold = i
+		}
+	}
+	return fold, fold >= 0
+}
+
+// toInterface is what Parse() returns for the value. Aggregate map keys are an
+// error, since they can't be a key in a Go map.
+func toInterface(val Value) (interface{}, error) {
+	switch val.Kind {
+	case KindString:
+		return val.Str, nil
+	case KindError:
+		return errors.New(val.Str), nil
+	case KindInt:
+		return val.Int, nil
+	case KindFloat:
+		return val.Float, nil
+	case KindBool:
+		return val.Bool, nil
+	case KindBigNumber:
+		n, _ := new(big.Int).SetString(val.Str, 10)
+		return n, nil
+	case KindArray, KindSet, KindPush:
+		var res []interface{}
+		for _, e := range val.Array {
+			v, err := toInterface(e)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, v)
+		}
+		return res, nil
+	case KindMap:
+		res := map[interface{}]interface{}{}
+		for _, e := range val.Map {
+			switch e.Key.Kind {
+			case KindArray, KindSet, KindPush, KindMap:
+				return nil, fmt.Errorf("proto: can't unmarshal a map with %s keys into interface {}", e.Key.Kind)
+			}
+			k, err := toInterface(e.Key)
+			if err != nil {
+				return nil, err
+			}
+			v, err := toInterface(e.Value)
+			if err != nil {
+				return nil, err
+			}
+			res[k] = v
+		}
+		return res, nil
+	default:
+		return nil, nil
+	}
+}
+
+// Marshal makes a reply out of v, the inverse of Unmarshal(). With resp3 false
+// only RESP2 types are used: doubles and big numbers become strings, booleans
+// integers, and maps flat arrays.
+//
+// Strings and []byte become bulk strings, errors become errors, nil, nil
+// pointers, nil slices, and nil maps become null. Map keys are sorted. Structs
+// become maps, using the same names as Unmarshal(), and fields with the
+// omitempty option are left out when they are the zero value. A Value is
+// written as is.
+//
+// Marshal panics on types it can't handle, such as channels and functions.
+func Marshal(v interface{}, resp3 bool) string {
+	if v == nil {
+		return marshalNull(resp3)
+	}
+	return marshal(reflect.ValueOf(v), resp3)
+}
+
+func marshalNull(resp3 bool) string {
+	if resp3 {
+		return NilResp3
+	}
+	return Nil
+}
+
+func marshal(rv reflect.Value, resp3 bool) string {
+	if rv.Type() == valueType {
+		return marshalValue(rv.Interface().(Value), resp3)
+	}
+	if rv.Type().Implements(errorType) {
+		if (rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface) && rv.IsNil() {
+			return marshalNull(resp3)
+		}
+		return Error(rv.Interface().(error).Error())
+	}
+
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return marshalNull(resp3)
+		}
+		return marshal(rv.Elem(), resp3)
+	case reflect.String:
+		return String(rv.String())
+	case reflect.Bool:
+		if resp3 {
+			return Bool(rv.Bool())
+		}
+		if rv.Bool() {
+			return Int(1)
+		}
+		return Int(0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return inline(':', strconv.FormatInt(rv.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return inline(':', strconv.FormatUint(rv.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		if resp3 {
+			return inline(',', formatFloat(rv.Float()))
+		}
+		return String(formatFloat(rv.Float()))
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice {
+			if rv.IsNil() {
+				if resp3 {
+					return NilResp3
+				}
+				return NilList
+			}
+			if rv.Type().Elem().Kind() == reflect.Uint8 {
+				return String(string(rv.Bytes()))
+			}
+		}
+		elems := make([]string, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			elems = append(elems, marshal(rv.Index(i), resp3))
+		}
+		return Array(elems...)
+	case reflect.Map:
+		if rv.IsNil() {
+			return marshalNull(resp3)
+		}
+		type entry struct {
+			key, value string
+		}
+		var entries []entry
+		iter := rv.MapRange()
+		for iter.Next() {
+			entries = append(entries, entry{
+				key:   marshal(iter.Key(), resp3),
+				value: marshal(iter.Value(), resp3),
+			})
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+		var elems []string
+		for _, e := range entries {
+			elems = append(elems, e.key, e.value)
+		}
+		return marshalMap(elems, resp3)
+	case reflect.Struct:
+		if rv.Type() == bigIntType {
+			n := new(big.Int)
+			reflect.ValueOf(n).Elem().Set(rv)
+			if resp3 {
+				return BigNumber(n.String())
+			}
+			return String(n.String())
+		}
+		var elems []string
+		for i := 0; i < rv.NumField(); i++ {
+			name, omitEmpty := fieldName(rv.Type().Field(i))
+			if name == "" {
+				continue
+			}
+			if omitEmpty && rv.Field(i).IsZero() {
+				continue
+			}
+			elems = append(elems, String(name), marshal(rv.Field(i), resp3))
+		}
+		return marshalMap(elems, resp3)
+	default:
+		panic(fmt.Sprintf("proto: can't marshal %s", rv.Type()))
+	}
+}
+
+// marshalMap makes a map out of raw key/value pairs.
+func marshalMap(elems []string, resp3 bool) string {
+	if resp3 {
+		return Map(elems...)
+	}
+	return Array(elems...)
+}
+
+// marshalValue writes a Value, downgrading RESP3 types if needed.
+func marshalValue(val Value, resp3 bool) string {
+	var res string
+	if resp3 && len(val.Attributes) > 0 {
+		var elems []string
+		for _, e := range val.Attributes {
+			elems = append(elems, marshalValue(e.Key, resp3), marshalValue(e.Value, resp3))
+		}
+		res = fmt.Sprintf("|%d\r\n", len(val.Attributes)) + strings.Join(elems, "")
+	}
+
+	switch val.Kind {
+	case KindString:
+		if val.Format != "" && resp3 {
+			return res + fmt.Sprintf("=%d\r\n%s:%s\r\n", len(val.Str)+4, val.Format, val.Str)
+		}
+		return res + String(val.Str)
+	case KindError:
+		if strings.ContainsAny(val.Str, "\r\n") {
+			if resp3 {
+				return res + BlobError(val.Str)
+			}
+			return res + Error(strings.NewReplacer("\r", " ", "\n", " ").Replace(val.Str))
+		}
+		return res + Error(val.Str)
+	case KindInt:
+		return res + Int(val.Int)
+	case KindFloat:
+		if resp3 {
+			return res + inline(',', formatFloat(val.Float))
+		}
+		return res + String(formatFloat(val.Float))
+	case KindBool:
+		if resp3 {
+			return res + Bool(val.Bool)
+		}
+		if val.Bool {
+			return res + Int(1)
+		}
+		return res + Int(0)
+	case KindBigNumber:
+		if resp3 {
+			return res + BigNumber(val.Str)
+		}
+		return res + String(val.Str)
+	case KindNull:
+		return res + marshalNull(resp3)
+	case KindArray, KindSet, KindPush:
+		elems := make([]string, 0, len(val.Array))
+		for _, e := range val.Array {
+			elems = append(elems, marshalValue(e, resp3))
+		}
+		switch {
+		case resp3 && val.Kind == KindSet:
+			return res + Set(elems...)
+		case resp3 && val.Kind == KindPush:
+			return res + Push(elems...)
+		default:
+			return res + Array(elems...)
+		}
+	case KindMap:
+		var elems []string
+		for _, e := range val.Map {
+			elems = append(elems, marshalValue(e.Key, resp3), marshalValue(e.Value, resp3))
+		}
+		return res + marshalMap(elems, resp3)
+	default:
+		panic(fmt.Sprintf("proto: can't marshal a Value of kind %s", val.Kind))
+	}
+}
+
+// formatFloat formats a double the way Redis does.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
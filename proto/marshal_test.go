@@ -0,0 +1,294 @@
+package proto
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshal(t *testing.T) {
+	test := func(t *testing.T, reply string, v, want interface{}) {
+		t.Helper()
+		if err := Unmarshal(reply, v); err != nil {
+			t.Errorf("unmarshal %q: %s", reply, err)
+			return
+		}
+		if have := reflect.ValueOf(v).Elem().Interface(); !reflect.DeepEqual(have, want) {
+			t.Errorf("have %#v, want %#v", have, want)
+		}
+	}
+
+	t.Run("scalars", func(t *testing.T) {
+		test(t, String("hello"), new(string), "hello")
+		test(t, Inline("OK"), new(string), "OK")
+		test(t, Verbatim("hi"), new(string), "hi")
+		test(t, Int(12), new(string), "12")
+		test(t, String("hello"), new([]byte), []byte("hello"))
+		test(t, Int(12), new(int), 12)
+		test(t, Int(-12), new(int8), int8(-12))
+		test(t, String("12"), new(uint64), uint64(12))
+		test(t, Float(1.5), new(float64), 1.5)
+		test(t, String("1.5"), new(float32), float32(1.5))
+		test(t, String("inf"), new(float64), math.Inf(1))
+		test(t, Int(3), new(float64), 3.0)
+		test(t, Bool(true), new(bool), true)
+		test(t, Int(0), new(bool), false)
+		test(t, Bool(true), new(int), 1)
+
+		n, _ := new(big.Int).SetString("1234567999999999999999", 10)
+		test(t, BigNumber("1234567999999999999999"), new(big.Int), *n)
+		test(t, BigNumber("1234567999999999999999"), new(*big.Int), n)
+		test(t, String("1234567999999999999999"), new(*big.Int), n)
+	})
+
+	t.Run("null", func(t *testing.T) {
+		s := "foo"
+		sp := &s
+		test(t, String("bar"), &sp, &s) // the same pointer
+		if s != "bar" {
+			t.Errorf("have %q", s)
+		}
+		test(t, Nil, &sp, (*string)(nil))
+		test(t, NilResp3, &s, "")
+
+		sl := []string{"a"}
+		test(t, NilList, &sl, []string(nil))
+		test(t, Strings("a", "b"), new([]*string), []*string{strp("a"), strp("b")})
+		test(t, Array(String("a"), Nil), new([]*string), []*string{strp("a"), nil})
+	})
+
+	t.Run("lists", func(t *testing.T) {
+		test(t, Strings("a", "b"), new([]string), []string{"a", "b"})
+		test(t, Array(), new([]string), []string{})
+		test(t, Ints(1, 2), new([]int), []int{1, 2})
+		test(t, StringSet("a"), new([]string), []string{"a"})
+		test(t, Push(String("a"), Int(1)), new([]string), []string{"a", "1"})
+		test(t, StringMap("k", "v"), new([]string), []string{"k", "v"})
+		test(t, Ints(1, 2), new([2]int), [2]int{1, 2})
+		test(t,
+			Array(Strings("a"), Strings("b", "c")),
+			new([][]string),
+			[][]string{{"a"}, {"b", "c"}},
+		)
+	})
+
+	t.Run("maps", func(t *testing.T) {
+		test(t, StringMap("a", "1", "b", "2"), new(map[string]int), map[string]int{"a": 1, "b": 2})
+		// RESP2 sends maps as flat arrays
+		test(t, Strings("a", "1", "b", "2"), new(map[string]string), map[string]string{"a": "1", "b": "2"})
+		test(t, Map(Int(1), Bool(true)), new(map[int]bool), map[int]bool{1: true})
+	})
+
+	t.Run("structs", func(t *testing.T) {
+		type info struct {
+			Name    string
+			Age     int     `redis:"age"`
+			Score   float64 `redis:"score,omitempty"`
+			Skip    string  `redis:"-"`
+			private string
+			Tags    []string
+		}
+		test(t,
+			Map(
+				String("NAME"), String("aap"),
+				String("age"), Int(12),
+				String("score"), Float(1.5),
+				String("Skip"), String("no"),
+				String("private"), String("no"),
+				String("tags"), Strings("a", "b"),
+				String("unknown"), Int(1),
+			),
+			new(info),
+			info{Name: "aap", Age: 12, Score: 1.5, Tags: []string{"a", "b"}},
+		)
+		test(t,
+			Strings("Name", "noot", "age", "3"),
+			new(info),
+			info{Name: "noot", Age: 3},
+		)
+	})
+
+	t.Run("any", func(t *testing.T) {
+		test(t, Array(String("a"), Int(1), Nil), new(interface{}), []interface{}{"a", 1, nil})
+		test(t, StringMap("a", "b"), new(interface{}), map[interface{}]interface{}{"a": "b"})
+		test(t, Attribute(Int(1), String("a"), Int(2)), new(Value), Value{
+			Kind: KindInt,
+			Int:  1,
+			Attributes: []MapEntry{
+				{Key: Value{Kind: KindString, Str: "a"}, Value: Value{Kind: KindInt, Int: 2}},
+			},
+		})
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		fail := func(t *testing.T, reply string, v interface{}, want string) {
+			t.Helper()
+			err := Unmarshal(reply, v)
+			if err == nil {
+				t.Errorf("no error for %q", reply)
+				return
+			}
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("have %q, want %q", err, want)
+			}
+		}
+		var s string
+		fail(t, String("a"), s, "non-nil pointer")
+		fail(t, String("a"), (*string)(nil), "non-nil pointer")
+		fail(t, "foo\r\n", &s, "unsupported protocol")
+		fail(t, Error("ERR wrong"), &s, "ERR wrong")
+		fail(t, Array(Inline("OK"), Error("ERR wrong")), new([]string), "ERR wrong")
+		fail(t, Strings("a"), &s, "can't unmarshal array into string")
+		fail(t, String("a"), new(int), `can't unmarshal "a" into int`)
+		fail(t, Int(300), new(int8), `can't unmarshal "300" into int8`)
+		fail(t, Int(-1), new(uint), `can't unmarshal "-1" into uint`)
+		fail(t, String("a"), new(bool), "can't unmarshal string into bool")
+		fail(t, Ints(1, 2, 3), new([2]int), "can't unmarshal 3 elements into [2]int")
+		fail(t, Strings("a"), new(map[string]string), "can't unmarshal array into map[string]string")
+		fail(t, Map(Int(1), Int(2)), new(struct{ A int }), "can't unmarshal a int key into struct")
+		fail(t, String("a"), new(error), "can't unmarshal string into error")
+		fail(t, "%1\r\n*1\r\n:1\r\n:2\r\n", new(interface{}), "can't unmarshal a map with array keys")
+		fail(t, Array(Map(Map(Int(1), Int(2)), Int(3))), new(interface{}), "can't unmarshal a map with map keys")
+	})
+}
+
+func strp(s string) *string {
+	return &s
+}
+
+func TestMarshal(t *testing.T) {
+	test := func(t *testing.T, v interface{}, resp2, resp3 string) {
+		t.Helper()
+		if have := Marshal(v, false); have != resp2 {
+			t.Errorf("RESP2: have %q, want %q", have, resp2)
+		}
+		if have := Marshal(v, true); have != resp3 {
+			t.Errorf("RESP3: have %q, want %q", have, resp3)
+		}
+	}
+
+	t.Run("scalars", func(t *testing.T) {
+		test(t, "hello", String("hello"), String("hello"))
+		test(t, []byte("hello"), String("hello"), String("hello"))
+		test(t, 12, Int(12), Int(12))
+		test(t, uint64(math.MaxUint64), ":18446744073709551615\r\n", ":18446744073709551615\r\n")
+		test(t, 1.5, String("1.5"), Float(1.5))
+		test(t, math.Inf(-1), String("-inf"), ",-inf\r\n")
+		test(t, true, Int(1), Bool(true))
+		test(t, errors.New("ERR wrong"), Error("ERR wrong"), Error("ERR wrong"))
+
+		n, _ := new(big.Int).SetString("1234567999999999999999", 10)
+		test(t, n, String("1234567999999999999999"), BigNumber("1234567999999999999999"))
+		test(t, *n, String("1234567999999999999999"), BigNumber("1234567999999999999999"))
+	})
+
+	t.Run("null", func(t *testing.T) {
+		test(t, nil, Nil, NilResp3)
+		test(t, (*string)(nil), Nil, NilResp3)
+		test(t, []string(nil), NilList, NilResp3)
+		test(t, map[string]int(nil), Nil, NilResp3)
+		test(t, error(nil), Nil, NilResp3)
+	})
+
+	t.Run("lists", func(t *testing.T) {
+		test(t, []string{"a", "b"}, Strings("a", "b"), Strings("a", "b"))
+		test(t, []string{}, Array(), Array())
+		test(t, [2]int{1, 2}, Ints(1, 2), Ints(1, 2))
+		test(t,
+			[]interface{}{"a", 1, nil},
+			Array(String("a"), Int(1), Nil),
+			Array(String("a"), Int(1), NilResp3),
+		)
+	})
+
+	t.Run("maps", func(t *testing.T) {
+		test(t,
+			map[string]int{"b": 2, "a": 1},
+			Array(String("a"), Int(1), String("b"), Int(2)),
+			Map(String("a"), Int(1), String("b"), Int(2)),
+		)
+
+		type info struct {
+			Name    string
+			Age     int     `redis:"age"`
+			Score   float64 `redis:"score,omitempty"`
+			Skip    string  `redis:"-"`
+			private string
+		}
+		test(t,
+			info{Name: "aap", Age: 12, Skip: "no", private: "no"},
+			Array(String("Name"), String("aap"), String("age"), Int(12)),
+			Map(String("Name"), String("aap"), String("age"), Int(12)),
+		)
+		test(t,
+			&info{Score: 1.5},
+			Array(String("Name"), String(""), String("age"), Int(0), String("score"), String("1.5")),
+			Map(String("Name"), String(""), String("age"), Int(0), String("score"), Float(1.5)),
+		)
+	})
+
+	t.Run("values", func(t *testing.T) {
+		for _, reply := range []string{
+			String("hello"),
+			Error("ERR wrong"),
+			Int(12),
+			NilResp3,
+			Float(1.5),
+			Bool(false),
+			BigNumber("123"),
+			Verbatim("hi"),
+			BlobError("ERR\nwrong"),
+			Strings("a"),
+			StringSet("a"),
+			Push(String("a")),
+			StringMap("a", "b"),
+			Attribute(Int(1), String("a"), Int(2)),
+		} {
+			v, err := ParseValue(reply)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have := Marshal(v, true); have != reply {
+				t.Errorf("have %q, want %q", have, reply)
+			}
+		}
+
+		v, err := ParseValue(Attribute(Map(String("a"), Bool(true)), String("a"), Int(2)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := Marshal(v, false), Array(String("a"), Int(1)); have != want {
+			t.Errorf("have %q, want %q", have, want)
+		}
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		type info struct {
+			Name  string
+			Tags  []string          `redis:"tags"`
+			Attrs map[string]string `redis:"attrs"`
+		}
+		in := info{Name: "aap", Tags: []string{"a"}, Attrs: map[string]string{"k": "v"}}
+		for _, resp3 := range []bool{false, true} {
+			var out info
+			if err := Unmarshal(Marshal(in, resp3), &out); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(in, out) {
+				t.Errorf("have %#v, want %#v", out, in)
+			}
+		}
+	})
+
+	t.Run("panics", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("no panic")
+			}
+		}()
+		Marshal(make(chan int), true)
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"strconv"
 	"strings"
 )
@@ -25,10 +26,101 @@ func readLine(r *bufio.Reader) (string, error) {
 	return line, nil
 }
 
+// readBlob reads the `length` bytes of a blob string, and the trailing \r\n.
+func readBlob(r *bufio.Reader, length int) (string, error) {
+	var (
+		buf = make([]byte, length+2)
+		pos = 0
+	)
+	for pos < length+2 {
+		n, err := r.Read(buf[pos:])
+		if err != nil {
+			return "", err
+		}
+		pos += n
+	}
+	return string(buf), nil
+}
+
+// readStreamedString reads the chunks of a `$?` string, up to and including
+// the `;0` chunk. It returns the raw chunks, and the string they make.
+func readStreamedString(r *bufio.Reader) (string, string, error) {
+	var (
+		raw strings.Builder
+		s   strings.Builder
+	)
+	for {
+		chunk, err := readLine(r)
+		if err != nil {
+			return "", "", err
+		}
+		if chunk[0] != ';' {
+			return "", "", ErrProtocol
+		}
+		raw.WriteString(chunk)
+		length, err := strconv.Atoi(chunk[1 : len(chunk)-2])
+		if err != nil {
+			return "", "", err
+		}
+		if length == 0 {
+			return raw.String(), s.String(), nil
+		}
+		buf, err := readBlob(r, length)
+		if err != nil {
+			return "", "", err
+		}
+		raw.WriteString(buf)
+		s.WriteString(buf[:length])
+	}
+}
+
+// streamEnd is true if the next line is the end of a streamed aggregate. It
+// eats the line.
+func streamEnd(r *bufio.Reader) (bool, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return false, err
+	}
+	if b[0] != '.' {
+		return false, nil
+	}
+	_, err = readLine(r)
+	return true, err
+}
+
+// skipAttributes skips any RESP3 attributes (`|1\r\n...`) before a reply.
+func skipAttributes(r *bufio.Reader) error {
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return err
+		}
+		if b[0] != '|' {
+			return nil
+		}
+		line, err := readLine(r)
+		if err != nil {
+			return err
+		}
+		length, err := strconv.Atoi(line[1 : len(line)-2])
+		if err != nil {
+			return err
+		}
+		for i := 0; i < length*2; i++ {
+			if _, err := Read(r); err != nil {
+				return err
+			}
+		}
+	}
+}
+
 // Read an array, with all elements are the raw redis commands
-// Also reads sets and maps.
+// Also reads sets, maps, and streamed aggregates.
 func ReadArray(b string) ([]string, error) {
 	r := bufio.NewReader(strings.NewReader(b))
+	if err := skipAttributes(r); err != nil {
+		return nil, err
+	}
 	line, err := readLine(r)
 	if err != nil {
 		return nil, err
@@ -38,22 +130,38 @@ func ReadArray(b string) ([]string, error) {
 	switch line[0] {
 	default:
 		return nil, ErrUnexpected
-	case '*', '>', '~':
+	case '*', '>', '~', '%':
 		// *: array
 		// >: push data
 		// ~: set
+		// %: map
+		if line[1:] == "?\r\n" {
+			// streamed
+			var res []string
+			for {
+				end, err := streamEnd(r)
+				if err != nil {
+					return nil, err
+				}
+				if end {
+					return res, nil
+				}
+				next, err := Read(r)
+				if err != nil {
+					return nil, err
+				}
+				res = append(res, next)
+			}
+		}
 		length, err := strconv.Atoi(line[1 : len(line)-2])
 		if err != nil {
 			return nil, err
 		}
 		elems = length
-	case '%':
-		// we also read maps.
-		length, err := strconv.Atoi(line[1 : len(line)-2])
-		if err != nil {
-			return nil, err
+		if line[0] == '%' {
+			// we also read maps.
+			elems = length * 2
 		}
-		elems = length * 2
 	}
 
 	var res []string
@@ -67,8 +175,13 @@ func ReadArray(b string) ([]string, error) {
 	return res, nil
 }
 
+// ReadString reads a bulk string. Also reads verbatim strings (without the
+// format), and streamed strings.
 func ReadString(b string) (string, error) {
 	r := bufio.NewReader(strings.NewReader(b))
+	if err := skipAttributes(r); err != nil {
+		return "", err
+	}
 	line, err := readLine(r)
 	if err != nil {
 		return "", err
@@ -77,8 +190,14 @@ func ReadString(b string) (string, error) {
 	switch line[0] {
 	default:
 		return "", ErrUnexpected
-	case '$':
+	case '$', '=':
+		if line == "$?\r\n" {
+			// streamed strings are: `$?\r\n;5\r\nhello\r\n;0\r\n`
+			_, s, err := readStreamedString(r)
+			return s, err
+		}
 		// bulk strings are: `$5\r\nhello\r\n`
+		// verbatim strings are: `=9\r\ntxt:hello\r\n`
 		length, err := strconv.Atoi(line[1 : len(line)-2])
 		if err != nil {
 			return "", err
@@ -87,18 +206,18 @@ func ReadString(b string) (string, error) {
 			// -1 is a nil response
 			return line, nil
 		}
-		var (
-			buf = make([]byte, length+2)
-			pos = 0
-		)
-		for pos < length+2 {
-			n, err := r.Read(buf[pos:])
-			if err != nil {
-				return "", err
+		buf, err := readBlob(r, length)
+		if err != nil {
+			return "", err
+		}
+		s := buf[:len(buf)-2]
+		if line[0] == '=' {
+			if len(s) < 4 {
+				return "", ErrProtocol
 			}
-			pos += n
+			s = s[4:]
 		}
-		return string(buf[:len(buf)-2]), nil
+		return s, nil
 	}
 }
 
@@ -119,6 +238,8 @@ func ReadError(b string) (string, error) {
 		return "", ErrUnexpected
 	case '-':
 		return readInline(b)
+	case '!':
+		return ReadString("$" + b[1:])
 	}
 }
 
@@ -139,7 +260,8 @@ func ReadStrings(b string) ([]string, error) {
 }
 
 // Read a single command, returning it raw. Used to read replies from redis.
-// Understands RESP3 proto.
+// Understands RESP3 proto. Attributes are returned together with the reply
+// which follows them.
 func Read(r *bufio.Reader) (string, error) {
 	line, err := readLine(r)
 	if err != nil {
@@ -149,16 +271,28 @@ func Read(r *bufio.Reader) (string, error) {
 	switch line[0] {
 	default:
 		return "", ErrProtocol
-	case '+', '-', ':', ',', '_':
+	case '+', '-', ':', ',', '_', '#', '(':
 		// +: inline string
 		// -: errors
 		// :: integer
 		// ,: float
 		// _: null
+		// #: boolean
+		// (: big number
 		// Simple line based replies.
 		return line, nil
-	case '$':
+	case '$', '=', '!':
 		// bulk strings are: `$5\r\nhello\r\n`
+		// verbatim strings are: `=9\r\ntxt:hello\r\n`
+		// blob errors are: `!5\r\nwrong\r\n`
+		if line == "$?\r\n" {
+			// streamed strings are: `$?\r\n;5\r\nhello\r\n;0\r\n`
+			raw, _, err := readStreamedString(r)
+			if err != nil {
+				return "", err
+			}
+			return line + raw, nil
+		}
 		length, err := strconv.Atoi(line[1 : len(line)-2])
 		if err != nil {
 			return "", err
@@ -167,41 +301,45 @@ func Read(r *bufio.Reader) (string, error) {
 			// -1 is a nil response
 			return line, nil
 		}
-		var (
-			buf = make([]byte, length+2)
-			pos = 0
-		)
-		for pos < length+2 {
-			n, err := r.Read(buf[pos:])
-			if err != nil {
-				return "", err
-			}
-			pos += n
+		buf, err := readBlob(r, length)
+		if err != nil {
+			return "", err
 		}
-		return line + string(buf), nil
-	case '*', '>', '~':
+		return line + buf, nil
+	case '*', '>', '~', '%', '|':
 		// arrays are: `*6\r\n...`
 		// pushdata is: `>6\r\n...`
 		// sets are: `~6\r\n...`
-		length, err := strconv.Atoi(line[1 : len(line)-2])
-		if err != nil {
-			return "", err
-		}
-		for i := 0; i < length; i++ {
-			next, err := Read(r)
-			if err != nil {
-				return "", err
+		// maps are: `%3\r\n...`
+		// attributes are: `|1\r\n...`, followed by the actual reply
+		if line[0] != '|' && line[1:] == "?\r\n" {
+			// streamed aggregates are: `*?\r\n...` until `.\r\n`
+			for {
+				end, err := streamEnd(r)
+				if err != nil {
+					return "", err
+				}
+				if end {
+					return line + ".\r\n", nil
+				}
+				next, err := Read(r)
+				if err != nil {
+					return "", err
+				}
+				line += next
 			}
-			line += next
 		}
-		return line, nil
-	case '%':
-		// maps are: `%3\r\n...`
 		length, err := strconv.Atoi(line[1 : len(line)-2])
 		if err != nil {
 			return "", err
 		}
-		for i := 0; i < length*2; i++ {
+		if line[0] == '%' || line[0] == '|' {
+			length *= 2
+		}
+		if line[0] == '|' {
+			length++
+		}
+		for i := 0; i < length; i++ {
 			next, err := Read(r)
 			if err != nil {
 				return "", err
@@ -227,6 +365,10 @@ func Write(w io.Writer, cmd []string) error {
 }
 
 // Parse into interfaces. `b` must contain exactly a single command (which can be nested).
+//
+// RESP3 types become: floats a float64, booleans a bool, big numbers a
+// *big.Int, and null a nil. Sets and push data are slices, like arrays.
+// Attributes are skipped.
 func Parse(b string) (interface{}, error) {
 	if len(b) < 1 {
 		return nil, ErrUnexpected
@@ -243,15 +385,62 @@ func Parse(b string) (interface{}, error) {
 			return nil, err
 		}
 		return errors.New(e), nil
+	case '!':
+		e, err := ReadError(b)
+		if err != nil {
+			return nil, err
+		}
+		return errors.New(e), nil
 	case ':':
 		e, err := readInline(b)
 		if err != nil {
 			return nil, err
 		}
 		return strconv.Atoi(e)
-	case '$':
+	case ',':
+		e, err := readInline(b)
+		if err != nil {
+			return nil, err
+		}
+		return strconv.ParseFloat(e, 64)
+	case '_':
+		return nil, nil
+	case '#':
+		e, err := readInline(b)
+		if err != nil {
+			return nil, err
+		}
+		switch e {
+		case "t":
+			return true, nil
+		case "f":
+			return false, nil
+		default:
+			return nil, ErrProtocol
+		}
+	case '(':
+		e, err := readInline(b)
+		if err != nil {
+			return nil, err
+		}
+		n, ok := new(big.Int).SetString(e, 10)
+		if !ok {
+			return nil, ErrProtocol
+		}
+		return n, nil
+	case '$', '=':
 		return ReadString(b)
-	case '*':
+	case '|':
+		r := bufio.NewReader(strings.NewReader(b))
+		if err := skipAttributes(r); err != nil {
+			return nil, err
+		}
+		rest, err := Read(r)
+		if err != nil {
+			return nil, err
+		}
+		return Parse(rest)
+	case '*', '~', '>':
 		elems, err := ReadArray(b)
 		if err != nil {
 			return nil, err
@@ -2,6 +2,8 @@ package proto
 
 import (
 	"bufio"
+	"errors"
+	"math/big"
 	"reflect"
 	"strings"
 	"testing"
@@ -115,6 +117,37 @@ func TestRead(t *testing.T) {
 		test(t, "~2\r\n-foo\r\n$3\r\nfoo\r\n")
 		test(t, "~-1\r\n")
 	})
+
+	t.Run("boolean", func(t *testing.T) {
+		test(t, "#t\r\n")
+		test(t, "#f\r\n")
+	})
+
+	t.Run("big number", func(t *testing.T) {
+		test(t, "(3492890328409238509324850943850943825024385\r\n")
+		test(t, "(-3492890328409238509324850943850943825024385\r\n")
+	})
+
+	t.Run("verbatim string", func(t *testing.T) {
+		test(t, "=15\r\ntxt:Some string\r\n")
+	})
+
+	t.Run("blob error", func(t *testing.T) {
+		test(t, "!21\r\nSYNTAX invalid syntax\r\n")
+		test(t, "!8\r\nERR\r\nfoo\r\n")
+	})
+
+	t.Run("attribute", func(t *testing.T) {
+		test(t, "|1\r\n+key-popularity\r\n%2\r\n$1\r\na\r\n,0.1923\r\n$1\r\nb\r\n,0.0012\r\n*2\r\n:2039123\r\n:9543892\r\n")
+		test(t, "*2\r\n|1\r\n+ttl\r\n:3600\r\n:1\r\n:2\r\n")
+	})
+
+	t.Run("streamed", func(t *testing.T) {
+		test(t, "$?\r\n;4\r\nHell\r\n;5\r\no wor\r\n;1\r\nd\r\n;0\r\n")
+		test(t, "*?\r\n:1\r\n:2\r\n:3\r\n.\r\n")
+		test(t, "%?\r\n+a\r\n:1\r\n+b\r\n:2\r\n.\r\n")
+		test(t, "~?\r\n+a\r\n*?\r\n.\r\n.\r\n")
+	})
 }
 
 func TestReadArray(t *testing.T) {
@@ -188,6 +221,36 @@ func TestParse(t *testing.T) {
 		}
 	})
 
+	t.Run("resp3 types", func(t *testing.T) {
+		bn, _ := new(big.Int).SetString("3492890328409238509324850943850943825024385", 10)
+		for _, c := range []struct {
+			payload string
+			want    interface{}
+		}{
+			{Float(1.5), 1.5},
+			{NilResp3, nil},
+			{Bool(true), true},
+			{Bool(false), false},
+			{BigNumber("3492890328409238509324850943850943825024385"), bn},
+			{Verbatim("Some string"), "Some string"},
+			{BlobError("SYNTAX\ninvalid"), errors.New("SYNTAX\ninvalid")},
+			{StringSet("foo"), []interface{}{"foo"}},
+			{Push(String("foo")), []interface{}{"foo"}},
+			{Attribute(Int(12), String("ttl"), Int(3600)), 12},
+			{StreamedString("foo", "bar"), "foobar"},
+			{StreamedArray(Int(1), String("foo")), []interface{}{1, "foo"}},
+			{StreamedMap(String("foo"), Int(1)), map[interface{}]interface{}{"foo": 1}},
+		} {
+			have, err := Parse(c.payload)
+			if err != nil {
+				t.Errorf("parse %q: %s", c.payload, err)
+			}
+			if !reflect.DeepEqual(have, c.want) {
+				t.Errorf("have %#v, want %#v", have, c.want)
+			}
+		}
+	})
+
 	t.Run("string map", func(t *testing.T) {
 		have, err := Parse(StringMap("foo", "bar", "aap", "noot"))
 		if err != nil {
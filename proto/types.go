@@ -100,3 +100,60 @@ func StringSet(args ...string) string {
 	}
 	return Set(strings...)
 }
+
+// Bool is a RESP3 boolean
+func Bool(b bool) string {
+	if b {
+		return "#t\r\n"
+	}
+	return "#f\r\n"
+}
+
+// BigNumber is a RESP3 big number, given as a string of digits
+func BigNumber(n string) string {
+	return inline('(', n)
+}
+
+// Verbatim is a RESP3 verbatim string, in the "txt" format
+func Verbatim(s string) string {
+	return fmt.Sprintf("=%d\r\ntxt:%s\r\n", len(s)+4, s)
+}
+
+// BlobError is a RESP3 error, which can contain newlines
+func BlobError(s string) string {
+	return fmt.Sprintf("!%d\r\n%s\r\n", len(s), s)
+}
+
+// Attribute prefixes a reply with RESP3 attributes. Args should be raw redis
+// commands, and must be an even number of arguments.
+// Example: Attribute(String("foo"), String("key"), Int(12))
+func Attribute(reply string, args ...string) string {
+	return fmt.Sprintf("|%d\r\n", len(args)/2) + strings.Join(args, "") + reply
+}
+
+// StreamedString is a RESP3 string in chunks
+func StreamedString(chunks ...string) string {
+	res := "$?\r\n"
+	for _, c := range chunks {
+		res += fmt.Sprintf(";%d\r\n%s\r\n", len(c), c)
+	}
+	return res + ";0\r\n"
+}
+
+// StreamedArray assembles the args in an array of unknown length. Args should
+// be raw redis commands.
+func StreamedArray(args ...string) string {
+	return "*?\r\n" + strings.Join(args, "") + ".\r\n"
+}
+
+// StreamedMap assembles the args in a map of unknown length. Args should be raw
+// redis commands, and must be an even number of arguments.
+func StreamedMap(args ...string) string {
+	return "%?\r\n" + strings.Join(args, "") + ".\r\n"
+}
+
+// StreamedSet assembles the args in a set of unknown length. Args should be raw
+// redis commands.
+func StreamedSet(args ...string) string {
+	return "~?\r\n" + strings.Join(args, "") + ".\r\n"
+}
@@ -0,0 +1,287 @@
+package proto
+
+import (
+	"bufio"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Kind is the type of a Value.
+type Kind int
+
+const (
+	KindString    Kind = iota // bulk, inline, and verbatim strings
+	KindError                 // errors and blob errors
+	KindInt                   // integers
+	KindFloat                 // RESP3 doubles
+	KindBool                  // RESP3 booleans
+	KindBigNumber             // RESP3 big numbers, as a string in Str
+	KindNull                  // nil strings, nil arrays, and RESP3 null
+	KindArray                 // arrays, also streamed ones
+	KindSet                   // RESP3 sets
+	KindMap                   // RESP3 maps
+	KindPush                  // RESP3 push data
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindString:
+		return "string"
+	case KindError:
+		return "error"
+	case KindInt:
+		return "int"
+	case KindFloat:
+		return "float"
+	case KindBool:
+		return "bool"
+	case KindBigNumber:
+		return "bignumber"
+	case KindNull:
+		return "null"
+	case KindArray:
+		return "array"
+	case KindSet:
+		return "set"
+	case KindMap:
+		return "map"
+	case KindPush:
+		return "push"
+	default:
+		return "kind" + strconv.Itoa(int(k))
+	}
+}
+
+// Value is a parsed reply. Which fields are used depends on the Kind.
+type Value struct {
+	Kind       Kind
+	Str        string     // KindString, KindError, and KindBigNumber
+	Format     string     // verbatim strings only: "txt" or "mkd"
+	Int        int        // KindInt
+	Float      float64    // KindFloat
+	Bool       bool       // KindBool
+	Array      []Value    // KindArray, KindSet, and KindPush
+	Map        []MapEntry // KindMap, in the order they were sent
+	Attributes []MapEntry // RESP3 attributes sent before the reply, if any
+}
+
+// MapEntry is a key/value pair from a map or from attributes.
+type MapEntry struct {
+	Key   Value
+	Value Value
+}
+
+// Err returns the error for KindError values, and nil otherwise.
+func (v Value) Err() error {
+	if v.Kind != KindError {
+		return nil
+	}
+	return errors.New(v.Str)
+}
+
+// Get finds a map entry by its string key.
+func (v Value) Get(key string) (Value, bool) {
+	for _, e := range v.Map {
+		if e.Key.Kind == KindString && e.Key.Str == key {
+			return e.Value, true
+		}
+	}
+	return Value{}, false
+}
+
+// ParseValue parses a single raw reply into a Value. `b` must contain exactly
+// a single reply (which can be nested).
+func ParseValue(b string) (Value, error) {
+	if len(b) < 1 {
+		return Value{}, ErrUnexpected
+	}
+	r := bufio.NewReader(strings.NewReader(b))
+	v, err := ReadValue(r)
+	if err != nil {
+		return Value{}, err
+	}
+	if r.Buffered() > 0 {
+		return Value{}, ErrProtocol
+	}
+	return v, nil
+}
+
+// ReadValue reads a single reply and parses it into a Value.
+func ReadValue(r *bufio.Reader) (Value, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return Value{}, err
+	}
+	body := line[1 : len(line)-2]
+
+	switch line[0] {
+	default:
+		return Value{}, ErrProtocol
+	case '+':
+		return Value{Kind: KindString, Str: body}, nil
+	case '-':
+		return Value{Kind: KindError, Str: body}, nil
+	case ':':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return Value{}, err
+		}
+		return Value{Kind: KindInt, Int: n}, nil
+	case ',':
+		f, err := strconv.ParseFloat(body, 64)
+		if err != nil {
+			return Value{}, err
+		}
+		return Value{Kind: KindFloat, Float: f}, nil
+	case '_':
+		return Value{Kind: KindNull}, nil
+	case '#':
+		switch body {
+		case "t":
+			return Value{Kind: KindBool, Bool: true}, nil
+		case "f":
+			return Value{Kind: KindBool, Bool: false}, nil
+		default:
+			return Value{}, ErrProtocol
+		}
+	case '(':
+		return Value{Kind: KindBigNumber, Str: body}, nil
+	case '$', '=', '!':
+		var s string
+		if body == "?" {
+			_, s, err = readStreamedString(r)
+			if err != nil {
+				return Value{}, err
+			}
+		} else {
+			length, err := strconv.Atoi(body)
+			if err != nil {
+				return Value{}, err
+			}
+			if length < 0 {
+				return Value{Kind: KindNull}, nil
+			}
+			buf, err := readBlob(r, length)
+			if err != nil {
+				return Value{}, err
+			}
+			s = buf[:length]
+		}
+		switch line[0] {
+		case '!':
+			return Value{Kind: KindError, Str: s}, nil
+		case '=':
+			if len(s) < 4 || s[3] != ':' {
+				return Value{}, ErrProtocol
+			}
+			return Value{Kind: KindString, Format: s[:3], Str: s[4:]}, nil
+		default:
+			return Value{Kind: KindString, Str: s}, nil
+		}
+	case '|':
+		attrs, err := readEntries(r, body)
+		if err != nil {
+			return Value{}, err
+		}
+		v, err := ReadValue(r)
+		if err != nil {
+			return Value{}, err
+		}
+		v.Attributes = append(attrs, v.Attributes...)
+		return v, nil
+	case '%':
+		entries, err := readEntries(r, body)
+		if err != nil {
+			return Value{}, err
+		}
+		return Value{Kind: KindMap, Map: entries}, nil
+	case '*', '~', '>':
+		kind := KindArray
+		switch line[0] {
+		case '~':
+			kind = KindSet
+		case '>':
+			kind = KindPush
+		}
+		if body == "?" {
+			var elems []Value
+			for {
+				end, err := streamEnd(r)
+				if err != nil {
+					return Value{}, err
+				}
+				if end {
+					return Value{Kind: kind, Array: elems}, nil
+				}
+				e, err := ReadValue(r)
+				if err != nil {
+					return Value{}, err
+				}
+				elems = append(elems, e)
+			}
+		}
+		length, err := strconv.Atoi(body)
+		if err != nil {
+			return Value{}, err
+		}
+		if length < 0 {
+			return Value{Kind: KindNull}, nil
+		}
+		elems := make([]Value, 0, length)
+		for i := 0; i < length; i++ {
+			e, err := ReadValue(r)
+			if err != nil {
+				return Value{}, err
+			}
+			elems = append(elems, e)
+		}
+		return Value{Kind: kind, Array: elems}, nil
+	}
+}
+
+// readEntries reads the key/value pairs of a map or attributes. `length` is
+// the count from the header line, or "?" for a streamed map.
+func readEntries(r *bufio.Reader, length string) ([]MapEntry, error) {
+	readEntry := func() (MapEntry, error) {
+		k, err := ReadValue(r)
+		if err != nil {
+			return MapEntry{}, err
+		}
+		v, err := ReadValue(r)
+		if err != nil {
+			return MapEntry{}, err
+		}
+		return MapEntry{Key: k, Value: v}, nil
+	}
+
+	var entries []MapEntry
+	if length == "?" {
+		for {
+			end, err := streamEnd(r)
+			if err != nil {
+				return nil, err
+			}
+			if end {
+				return entries, nil
+			}
+			e, err := readEntry()
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, e)
+		}
+	}
+	n, err := strconv.Atoi(length)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < n; i++ {
+		e, err := readEntry()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
@@ -0,0 +1,117 @@
+package proto
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseValue(t *testing.T) {
+	test := func(t *testing.T, payload string, want Value) {
+		t.Helper()
+		have, err := ParseValue(payload)
+		if err != nil {
+			t.Errorf("parse %q: %s", payload, err)
+			return
+		}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("have %#v, want %#v", have, want)
+		}
+	}
+	str := func(s string) Value { return Value{Kind: KindString, Str: s} }
+	num := func(n int) Value { return Value{Kind: KindInt, Int: n} }
+
+	t.Run("RESP2", func(t *testing.T) {
+		test(t, String("hello"), str("hello"))
+		test(t, String(""), str(""))
+		test(t, Inline("OK"), str("OK"))
+		test(t, Error("ERR wrong"), Value{Kind: KindError, Str: "ERR wrong"})
+		test(t, Int(-12), num(-12))
+		test(t, Nil, Value{Kind: KindNull})
+		test(t, NilList, Value{Kind: KindNull})
+		test(t, Strings("a", "b"), Value{Kind: KindArray, Array: []Value{str("a"), str("b")}})
+		test(t, Array(), Value{Kind: KindArray, Array: []Value{}})
+		test(t,
+			Array(Ints(1), Nil),
+			Value{Kind: KindArray, Array: []Value{
+				{Kind: KindArray, Array: []Value{num(1)}},
+				{Kind: KindNull},
+			}},
+		)
+	})
+
+	t.Run("RESP3", func(t *testing.T) {
+		test(t, Float(3.5), Value{Kind: KindFloat, Float: 3.5})
+		test(t, NilResp3, Value{Kind: KindNull})
+		test(t, Bool(true), Value{Kind: KindBool, Bool: true})
+		test(t, BigNumber("1234567999999999999999"), Value{Kind: KindBigNumber, Str: "1234567999999999999999"})
+		test(t, Verbatim("hi\nthere"), Value{Kind: KindString, Format: "txt", Str: "hi\nthere"})
+		test(t, BlobError("ERR\nwrong"), Value{Kind: KindError, Str: "ERR\nwrong"})
+		test(t, StringSet("a"), Value{Kind: KindSet, Array: []Value{str("a")}})
+		test(t, Push(String("a")), Value{Kind: KindPush, Array: []Value{str("a")}})
+		test(t,
+			Map(String("a"), Int(1), Int(2), Bool(false)),
+			Value{Kind: KindMap, Map: []MapEntry{
+				{Key: str("a"), Value: num(1)},
+				{Key: num(2), Value: Value{Kind: KindBool}},
+			}},
+		)
+		test(t,
+			Attribute(Int(1), String("ttl"), Int(10)),
+			Value{Kind: KindInt, Int: 1, Attributes: []MapEntry{
+				{Key: str("ttl"), Value: num(10)},
+			}},
+		)
+		test(t, StreamedString("hel", "lo"), str("hello"))
+		test(t, StreamedArray(Int(1)), Value{Kind: KindArray, Array: []Value{num(1)}})
+		test(t, StreamedSet(), Value{Kind: KindSet})
+		test(t,
+			StreamedMap(String("a"), Int(1)),
+			Value{Kind: KindMap, Map: []MapEntry{{Key: str("a"), Value: num(1)}}},
+		)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, payload := range []string{
+			"",
+			"foo",
+			"+OK\r\n+OK\r\n", // two replies
+			":foo\r\n",
+			"#x\r\n",
+			"$5\r\nhi\r\n",
+			"=5\r\nhello\r\n", // no format
+			"*2\r\n:1\r\n",
+		} {
+			if _, err := ParseValue(payload); err == nil {
+				t.Errorf("no error for %q", payload)
+			}
+		}
+	})
+
+	t.Run("helpers", func(t *testing.T) {
+		v, err := ParseValue(Map(String("a"), Int(1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, ok := v.Get("a"); !ok || have.Int != 1 {
+			t.Errorf("have %#v", have)
+		}
+		if _, ok := v.Get("b"); ok {
+			t.Errorf("found b")
+		}
+		if v.Err() != nil {
+			t.Errorf("error for a map")
+		}
+
+		e, err := ParseValue(Error("ERR wrong"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := e.Err().Error(), "ERR wrong"; have != want {
+			t.Errorf("have %q, want %q", have, want)
+		}
+
+		if have, want := KindPush.String(), "push"; have != want {
+			t.Errorf("have %q, want %q", have, want)
+		}
+	})
+}
@@ -110,6 +110,15 @@ func (s *Subscriber) Channels() []string {
 	return cs
 }
 
+// isSubscribed checks for a single channel.
+func (s *Subscriber) isSubscribed(c string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.channels[c]
+	return ok
+}
+
 // List all subscribed patterns, in alphabetical order
 func (s *Subscriber) Patterns() []string {
 	s.mu.Lock()
@@ -216,7 +225,7 @@ func countPsubs(subs []*Subscriber) int {
 
 func monitorPublish(conn *server.Peer, msgs <-chan PubsubMessage) {
 	for msg := range msgs {
-		conn.Block(func(c *server.Writer) {
+		conn.Push(func(c *server.Writer) {
 			c.WritePushLen(3)
 			c.WriteBulk("message")
 			c.WriteBulk(msg.Channel)
@@ -228,7 +237,7 @@ func monitorPublish(conn *server.Peer, msgs <-chan PubsubMessage) {
 
 func monitorPpublish(conn *server.Peer, msgs <-chan PubsubPmessage) {
 	for msg := range msgs {
-		conn.Block(func(c *server.Writer) {
+		conn.Push(func(c *server.Writer) {
 			c.WritePushLen(4)
 			c.WriteBulk("pmessage")
 			c.WriteBulk(msg.Pattern)
@@ -12,6 +12,12 @@ import (
 	"github.com/alicebob/miniredis/v2/server"
 )
 
+const (
+	// redisVersion is the Redis version we mimic
+	redisVersion    = "8.4.0"
+	redisVersionNum = 0x080400
+)
+
 const (
 	keyTypeString    = "string"
 	keyTypeHash      = "hash"
@@ -39,6 +45,7 @@ const (
 	msgXXandNX              = "ERR XX and NX options at the same time are not compatible"
 	msgTimeoutNegative      = "ERR timeout is negative"
 	msgTimeoutIsOutOfRange  = "ERR timeout is out of range"
+	msgTimeoutNotInt        = "ERR timeout is not an integer or out of range"
 	msgInvalidSETime        = "ERR invalid expire time in set"
 	msgInvalidSETEXTime     = "ERR invalid expire time in setex"
 	msgInvalidPSETEXTime    = "ERR invalid expire time in psetex"
@@ -104,26 +111,46 @@ func withTx(
 	cb txCmd,
 ) {
 	ctx := getCtx(c)
+	cmd := c.Cmd()
 
 	if ctx.nested {
 		// this is a call via Lua's .call(). It's already locked.
 		cb(c, ctx)
+		m.trackKeys(ctx, cmd)
 		m.signal.Broadcast()
 		return
 	}
 
 	if inTx(ctx) {
-		addTxCmd(ctx, cb)
+		addTxCmd(ctx, cmd, func(c *server.Peer, ctx *connCtx) {
+			start := time.Now()
+			cb(c, ctx)
+			m.txCmdDone(c, ctx, cmd, start)
+		})
 		c.WriteInline("QUEUED")
 		return
 	}
 	m.Lock()
+	m.passTime()
+	m.noTouch = ctx.noTouch
+	m.curPeer = c
 	cb(c, ctx)
+	m.trackKeys(ctx, cmd)
+	m.noTouch = false
+	m.curPeer = nil
+	m.sendPendingInvalidations()
 	// done, wake up anyone who waits on anything.
 	m.signal.Broadcast()
 	m.Unlock()
 }
 
+// txCmdDone is called after every command run by EXEC. EXEC has the lock.
+func (m *Miniredis) txCmdDone(c *server.Peer, ctx *connCtx, cmd []string, start time.Time) {
+	m.trackKeys(ctx, cmd)
+	m.feedMonitors(c, ctx, cmd)
+	m.slowlog.add(m.effectiveNow(), c, cmd, time.Since(start))
+}
+
 // blockCmd is executed returns whether it is done
 type blockCmd func(*server.Peer, *connCtx) bool
 
@@ -138,12 +165,15 @@ func blocking(
 ) {
 	var (
 		ctx = getCtx(c)
+		cmd = c.Cmd()
 	)
 	if inTx(ctx) {
-		addTxCmd(ctx, func(c *server.Peer, ctx *connCtx) {
+		addTxCmd(ctx, cmd, func(c *server.Peer, ctx *connCtx) {
+			start := time.Now()
 			if !cb(c, ctx) {
 				onTimeout(c)
 			}
+			m.txCmdDone(c, ctx, cmd, start)
 		})
 		c.WriteInline("QUEUED")
 		return
@@ -151,10 +181,6 @@ func blocking(
 
 	localCtx, cancel := context.WithCancel(m.Ctx)
 	defer cancel()
-	timedOut := false
-	if timeout != 0 {
-		go setCondTimer(localCtx, m.signal, &timedOut, timeout)
-	}
 	go func() {
 		<-localCtx.Done()
 		m.signal.Broadcast() // main loop might miss this signal
@@ -164,6 +190,19 @@ func blocking(
 		// this is a call via Lua's .call(). It's already locked.
 		m.Lock()
 		defer m.Unlock()
+		defer func() {
+			m.curPeer = nil
+			m.sendPendingInvalidations()
+		}()
+	}
+
+	var (
+		timedOut = false
+		virtual  = timeout != 0 && m.virtualTO
+		deadline = m.forwarded + timeout // only with virtual
+	)
+	if timeout != 0 && !virtual {
+		go setCondTimer(localCtx, m.signal, &timedOut, m.clockAfter(timeout))
 	}
 	for {
 		if c.Closed() {
@@ -174,25 +213,37 @@ func blocking(
 			return
 		}
 
+		m.passTime()
+		m.noTouch = ctx.noTouch
+		if !ctx.nested {
+			m.curPeer = c
+		}
 		done := cb(c, ctx)
+		m.noTouch = false
 		if done {
+			m.trackKeys(ctx, cmd)
 			return
 		}
 
-		if timedOut {
+		if timedOut || (virtual && m.forwarded >= deadline) {
 			onTimeout(c)
+			m.trackKeys(ctx, cmd)
 			return
 		}
 
+		if !ctx.nested {
+			m.curPeer = nil
+			m.sendPendingInvalidations()
+		}
+		waitStart := time.Now()
 		m.signal.Wait()
+		ctx.blocked += time.Since(waitStart)
 	}
 }
 
-func setCondTimer(ctx context.Context, sig *sync.Cond, timedOut *bool, timeout time.Duration) {
-	dl := time.NewTimer(timeout)
-	defer dl.Stop()
+func setCondTimer(ctx context.Context, sig *sync.Cond, timedOut *bool, dl <-chan time.Time) {
 	select {
-	case <-dl.C:
+	case <-dl:
 		sig.L.Lock() // for timedOut
 		*timedOut = true
 		sig.Broadcast() // main loop might miss this signal
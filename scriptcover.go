@@ -0,0 +1,328 @@
+package miniredis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/ast"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// lineHookName is the global which instrumented scripts call before every
+// statement, with the line number. Used for coverage and the debugger.
+const lineHookName = "__miniredis_line"
+
+var hookedScripts = sync.Map{} // Lua source -> *hookedScript
+
+// ScriptCoverage is the line coverage of a single script or library. See
+// EnableScriptCoverage().
+type ScriptCoverage struct {
+	// Name is the SHA1 of an EVAL script, or the library name of a function.
+	Name string
+	// Source is the Lua code, as given to EVAL, SCRIPT LOAD, or FUNCTION LOAD.
+	Source string
+	// Lines has every line with a statement, and how often it ran.
+	Lines map[int]int
+}
+
+// ScriptTrace is a single EVAL, EVALSHA, or FCALL. See EnableScriptCoverage().
+type ScriptTrace struct {
+	Cmd   string // "EVAL", "EVALSHA", "FCALL", &c.
+	Name  string // the SHA1 of the script, or the function name
+	Calls []ScriptCall
+}
+
+// ScriptCall is a single redis.call() or redis.pcall() from a script.
+type ScriptCall struct {
+	Args  []string // command and arguments
+	Reply string   // the reply in RESP, errors included. See the proto package.
+}
+
+// scriptCover has the coverage and traces of all scripts. Needs the
+// m.Lock().
+type scriptCover struct {
+	coverage map[string]*ScriptCoverage
+	traces   []*ScriptTrace
+}
+
+// hookedScript is a script compiled with line hooks.
+type hookedScript struct {
+	proto *lua.FunctionProto
+	lines []int
+}
+
+// EnableScriptCoverage starts recording which lines of Lua scripts and
+// functions run, and which redis.call()s and redis.pcall()s they make. Use
+// ScriptCoverage(), WriteScriptCoverage(), and ScriptTraces() to get the
+// results.
+//
+// Scripts run a bit slower when this is enabled. Libraries which were loaded
+// before this run their code again, in a new Lua state, on their next FCALL.
+func (m *Miniredis) EnableScriptCoverage() {
+	m.Lock()
+	defer m.Unlock()
+	if m.cover == nil {
+		m.cover = &scriptCover{
+			coverage: map[string]*ScriptCoverage{},
+		}
+	}
+}
+
+// ResetScriptCoverage forgets all coverage and traces recorded so far.
+func (m *Miniredis) ResetScriptCoverage() {
+	m.Lock()
+	defer m.Unlock()
+	if m.cover != nil {
+		m.cover.coverage = map[string]*ScriptCoverage{}
+		m.cover.traces = nil
+	}
+}
+
+// ScriptCoverage returns the coverage of every script and library which ran
+// since EnableScriptCoverage(), sorted by name.
+func (m *Miniredis) ScriptCoverage() []ScriptCoverage {
+	m.Lock()
+	defer m.Unlock()
+	if m.cover == nil {
+		return nil
+	}
+	var res []ScriptCoverage
+	for _, cov := range m.cover.coverage {
+		lines := map[int]int{}
+		for l, n := range cov.Lines {
+			lines[l] = n
+		}
+		res = append(res, ScriptCoverage{
+			Name:   cov.Name,
+			Source: cov.Source,
+			Lines:  lines,
+		})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// WriteScriptCoverage writes ScriptCoverage() in the lcov tracefile format,
+// which genhtml and most CI coverage tools read. Every script is a
+// "<name>.lua" source file.
+func (m *Miniredis) WriteScriptCoverage(w io.Writer) error {
+	for _, cov := range m.ScriptCoverage() {
+		var lines []int
+		hit := 0
+		for l, n := range cov.Lines {
+			lines = append(lines, l)
+			if n > 0 {
+				hit++
+			}
+		}
+		sort.Ints(lines)
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "TN:\nSF:%s.lua\n", cov.Name)
+		for _, l := range lines {
+			fmt.Fprintf(&b, "DA:%d,%d\n", l, cov.Lines[l])
+		}
+		fmt.Fprintf(&b, "LF:%d\nLH:%d\nend_of_record\n", len(lines), hit)
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScriptTraces returns every EVAL, EVALSHA, and FCALL since
+// EnableScriptCoverage(), in order, with the redis.call()s they made.
+func (m *Miniredis) ScriptTraces() []ScriptTrace {
+	m.Lock()
+	defer m.Unlock()
+	if m.cover == nil {
+		return nil
+	}
+	res := make([]ScriptTrace, 0, len(m.cover.traces))
+	for _, t := range m.cover.traces {
+		res = append(res, ScriptTrace{
+			Cmd:   t.Cmd,
+			Name:  t.Name,
+			Calls: append([]ScriptCall(nil), t.Calls...),
+		})
+	}
+	return res
+}
+
+// trace starts the trace of a script run.
+func (cv *scriptCover) trace(cmd, name string) *ScriptTrace {
+	t := &ScriptTrace{
+		Cmd:  strings.ToUpper(cmd),
+		Name: name,
+	}
+	cv.traces = append(cv.traces, t)
+	return t
+}
+
+func (t *ScriptTrace) add(args []string, reply string) {
+	t.Calls = append(t.Calls, ScriptCall{
+		Args:  append([]string(nil), args...),
+		Reply: reply,
+	})
+}
+
+// hook returns the line hook which counts the lines of a script.
+func (cv *scriptCover) hook(name, source string, lines []int) func(*lua.LState, int) {
+	cov, ok := cv.coverage[name]
+	if !ok {
+		cov = &ScriptCoverage{
+			Name:   name,
+			Source: source,
+			Lines:  map[int]int{},
+		}
+		cv.coverage[name] = cov
+	}
+	for _, line := range lines {
+		cov.Lines[line] += 0
+	}
+	return func(_ *lua.LState, line int) {
+		cov.Lines[line]++
+	}
+}
+
+// setLineHook sets the function which instrumented scripts call before every
+// statement.
+func setLineHook(l *lua.LState, hooks ...func(*lua.LState, int)) {
+	// raw, since the globals might be protected already
+	l.G.Global.RawSetString(lineHookName, l.NewFunction(func(l *lua.LState) int {
+		line := l.CheckInt(1)
+		for _, h := range hooks {
+			h(l, line)
+		}
+		return 0
+	}))
+}
+
+// compileHooked compiles a script where every statement first calls the line
+// hook with its line number.
+func compileHooked(script string) (*hookedScript, error) {
+	if val, ok := hookedScripts.Load(script); ok {
+		return val.(*hookedScript), nil
+	}
+	chunk, err := parse.Parse(strings.NewReader(script), "<string>")
+	if err != nil {
+		return nil, err
+	}
+	seen := map[int]bool{}
+	chunk = coverStmts(chunk, seen)
+	proto, err := lua.Compile(chunk, "")
+	if err != nil {
+		return nil, err
+	}
+	cs := &hookedScript{proto: proto}
+	for line := range seen {
+		cs.lines = append(cs.lines, line)
+	}
+	sort.Ints(cs.lines)
+	hookedScripts.Store(script, cs)
+	return cs, nil
+}
+
+// coverStmts instruments a block. Lines with a statement are added to seen.
+func coverStmts(stmts []ast.Stmt, seen map[int]bool) []ast.Stmt {
+	res := make([]ast.Stmt, 0, 2*len(stmts))
+	for _, st := range stmts {
+		coverStmt(st, seen)
+		if _, ok := st.(*ast.LabelStmt); !ok {
+			seen[st.Line()] = true
+			res = append(res, lineHook(st.Line()))
+		}
+		res = append(res, st)
+	}
+	return res
+}
+
+// lineHook is the statement `__miniredis_line(line)`.
+func lineHook(line int) ast.Stmt {
+	fn := &ast.IdentExpr{Value: lineHookName}
+	arg := &ast.NumberExpr{Value: strconv.Itoa(line)}
+	call := &ast.FuncCallExpr{Func: fn, Args: []ast.Expr{arg}}
+	st := &ast.FuncCallStmt{Expr: call}
+	for _, n := range []ast.PositionHolder{fn, arg, call, st} {
+		n.SetLine(line)
+		n.SetLastLine(line)
+	}
+	return st
+}
+
+// coverStmt instruments the blocks and function bodies in a statement.
+func coverStmt(st ast.Stmt, seen map[int]bool) {
+	switch s := st.(type) {
+	case *ast.AssignStmt:
+		coverExprs(s.Lhs, seen)
+		coverExprs(s.Rhs, seen)
+	case *ast.LocalAssignStmt:
+		coverExprs(s.Exprs, seen)
+	case *ast.FuncCallStmt:
+		coverExpr(s.Expr, seen)
+	case *ast.DoBlockStmt:
+		s.Stmts = coverStmts(s.Stmts, seen)
+	case *ast.WhileStmt:
+		coverExpr(s.Condition, seen)
+		s.Stmts = coverStmts(s.Stmts, seen)
+	case *ast.RepeatStmt:
+		coverExpr(s.Condition, seen)
+		s.Stmts = coverStmts(s.Stmts, seen)
+	case *ast.IfStmt:
+		coverExpr(s.Condition, seen)
+		s.Then = coverStmts(s.Then, seen)
+		s.Else = coverStmts(s.Else, seen)
+	case *ast.NumberForStmt:
+		coverExprs([]ast.Expr{s.Init, s.Limit, s.Step}, seen)
+		s.Stmts = coverStmts(s.Stmts, seen)
+	case *ast.GenericForStmt:
+		coverExprs(s.Exprs, seen)
+		s.Stmts = coverStmts(s.Stmts, seen)
+	case *ast.FuncDefStmt:
+		coverExpr(s.Func, seen)
+	case *ast.ReturnStmt:
+		coverExprs(s.Exprs, seen)
+	}
+}
+
+func coverExprs(exprs []ast.Expr, seen map[int]bool) {
+	for _, e := range exprs {
+		coverExpr(e, seen)
+	}
+}
+
+// coverExpr instruments the function bodies in an expression.
+func coverExpr(expr ast.Expr, seen map[int]bool) {
+	switch e := expr.(type) {
+	case *ast.FunctionExpr:
+		e.Stmts = coverStmts(e.Stmts, seen)
+	case *ast.AttrGetExpr:
+		coverExprs([]ast.Expr{e.Object, e.Key}, seen)
+	case *ast.TableExpr:
+		for _, f := range e.Fields {
+			coverExprs([]ast.Expr{f.Key, f.Value}, seen)
+		}
+	case *ast.FuncCallExpr:
+		coverExprs([]ast.Expr{e.Func, e.Receiver}, seen)
+		coverExprs(e.Args, seen)
+	case *ast.LogicalOpExpr:
+		coverExprs([]ast.Expr{e.Lhs, e.Rhs}, seen)
+	case *ast.RelationalOpExpr:
+		coverExprs([]ast.Expr{e.Lhs, e.Rhs}, seen)
+	case *ast.StringConcatOpExpr:
+		coverExprs([]ast.Expr{e.Lhs, e.Rhs}, seen)
+	case *ast.ArithmeticOpExpr:
+		coverExprs([]ast.Expr{e.Lhs, e.Rhs}, seen)
+	case *ast.UnaryMinusOpExpr:
+		coverExpr(e.Expr, seen)
+	case *ast.UnaryNotOpExpr:
+		coverExpr(e.Expr, seen)
+	case *ast.UnaryLenOpExpr:
+		coverExpr(e.Expr, seen)
+	}
+}
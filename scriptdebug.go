@@ -0,0 +1,621 @@
+package miniredis
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+const (
+	msgDebugUsage   = "ERR Use SCRIPT DEBUG YES/SYNC/NO"
+	msgDebugMulti   = "ERR SCRIPT DEBUG must be called outside MULTI"
+	msgDebugEvalsha = "ERR Please use EVAL instead of EVALSHA for debugging"
+)
+
+// scriptDebug is the mode set with SCRIPT DEBUG.
+type scriptDebug int
+
+const (
+	debugNo   scriptDebug = iota
+	debugYes              // changes are rolled back after the session
+	debugSync             // changes are kept
+)
+
+const (
+	ldbMaxLenDefault  = 256
+	ldbMaxBreakpoints = 64
+	ldbMaxDepth       = 9
+)
+
+// ldb is a Lua debugger session: the first EVAL after SCRIPT DEBUG YES or
+// SYNC. It talks the same protocol as Redis' LDB, so redis-cli --ldb works.
+// Everything runs with the m.Lock() held.
+type ldb struct {
+	c          *server.Peer
+	src        []string
+	logs       []string
+	current    int  // line
+	step       bool // stop at the next line
+	luabp      bool // redis.breakpoint() was called
+	bps        []int
+	maxlen     int
+	maxlenHint bool
+}
+
+func newLDB(c *server.Peer, script string) *ldb {
+	return &ldb{
+		c:      c,
+		src:    strings.Split(script, "\n"),
+		step:   true,
+		maxlen: ldbMaxLenDefault,
+	}
+}
+
+// debugScript runs EVAL in a debug session. When the script is done the
+// connection is closed, as Redis does. With SCRIPT DEBUG YES all changes
+// made by the script are rolled back. Needs the m.Lock().
+func (m *Miniredis) debugScript(c *server.Peer, ctx *connCtx, cmd, script string, readOnly bool, args []string) {
+	var snap map[int]*RedisDB
+	if ctx.scriptDebug == debugYes {
+		snap = m.snapshotDBs()
+	}
+
+	// The debugger talks to the client directly, the reply of the script
+	// comes after the session.
+	buf := &bytes.Buffer{}
+	wr := bufio.NewWriter(buf)
+	peer := server.NewPeer(wr)
+	peer.Ctx = c.Ctx
+	peer.Resp3 = c.Resp3
+
+	ctx.ldb = newLDB(c, script)
+	sha := sha1Hex(script)
+	if m.runLuaScript(peer, cmd, sha, script, readOnly, args) && snap == nil {
+		m.scripts[sha] = script
+	}
+	ctx.ldb.end()
+	ctx.ldb = nil
+	ctx.scriptDebug = debugNo
+
+	if snap != nil {
+		m.restoreDBs(snap)
+	}
+	wr.Flush()
+	c.WriteRaw(buf.String())
+	c.Close()
+}
+
+// snapshotDBs copies all databases, for restoreDBs().
+func (m *Miniredis) snapshotDBs() map[int]*RedisDB {
+	snap := map[int]*RedisDB{}
+	for id, db := range m.dbs {
+		cp := newRedisDB(id, m)
+		for k := range db.keys {
+			m.copy(db, k, &cp, k)
+		}
+		for k, fields := range db.hashTTLs {
+			ttls := map[string]time.Duration{}
+			for f, ttl := range fields {
+				ttls[f] = ttl
+			}
+			cp.hashTTLs[k] = ttls
+		}
+		for k, v := range db.lru {
+			cp.lru[k] = v
+		}
+		for k, v := range db.keyVersion {
+			cp.keyVersion[k] = v
+		}
+		snap[id] = &cp
+	}
+	return snap
+}
+
+// restoreDBs undoes all changes since snapshotDBs().
+func (m *Miniredis) restoreDBs(snap map[int]*RedisDB) {
+	for id, db := range m.dbs {
+		if cp, ok := snap[id]; ok {
+			*db = *cp
+		} else {
+			db.flush()
+		}
+	}
+}
+
+func (d *ldb) log(s string) {
+	d.logs = append(d.logs, s)
+}
+
+// logMaxLen logs, but trims the line to the "maxlen" setting.
+func (d *ldb) logMaxLen(s string) {
+	if d.maxlen == 0 || len(s) <= d.maxlen {
+		d.log(s)
+		return
+	}
+	d.log(s[:d.maxlen] + " ...")
+	if !d.maxlenHint {
+		d.maxlenHint = true
+		d.log("<hint> The above reply was trimmed. Use 'maxlen 0' to disable trimming.")
+	}
+}
+
+// send writes all pending log lines to the client.
+func (d *ldb) send() {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(d.logs))
+	for _, l := range d.logs {
+		b.WriteString("+")
+		b.WriteString(strings.NewReplacer("\r", " ", "\n", " ").Replace(l))
+		b.WriteString("\r\n")
+	}
+	d.logs = nil
+	d.c.WriteRaw(b.String())
+	d.c.Flush()
+}
+
+func (d *ldb) end() {
+	d.log("<endsession>")
+	d.send()
+}
+
+func (d *ldb) isBreakpoint(line int) bool {
+	for _, bp := range d.bps {
+		if bp == line {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *ldb) logSourceLine(n int) {
+	line := "<out of range source code line>"
+	if n >= 1 && n <= len(d.src) {
+		line = d.src[n-1]
+	}
+	bp, current := d.isBreakpoint(n), d.current == n
+	prefix := "   "
+	switch {
+	case current && bp:
+		prefix = "->#"
+	case current:
+		prefix = "-> "
+	case bp:
+		prefix = "  #"
+	}
+	d.log(fmt.Sprintf("%s%-3d %s", prefix, n, line))
+}
+
+// lineHook is called before every statement of the script.
+func (d *ldb) lineHook(l *lua.LState, line int) {
+	d.current = line
+	bp := d.isBreakpoint(line) || d.luabp
+	if !d.step && !bp {
+		return
+	}
+	reason := "step over"
+	if bp {
+		reason = "break point"
+		if d.luabp {
+			reason = "redis.breakpoint() called"
+		}
+	}
+	d.step, d.luabp = false, false
+	d.log(fmt.Sprintf("* Stopped at %d, stop reason = %s", line, reason))
+	d.logSourceLine(line)
+	d.send()
+	d.repl(l)
+}
+
+// repl reads debugger commands, until one continues the script.
+func (d *ldb) repl(l *lua.LState) {
+	for {
+		args, ok := d.c.ReadCommand()
+		if !ok {
+			l.RaiseError("LDB client closed the connection")
+		}
+		switch strings.ToLower(args[0]) {
+		case "h", "help":
+			d.help()
+		case "s", "step", "n", "next":
+			d.step = true
+			return
+		case "c", "continue":
+			return
+		case "t", "trace":
+			d.trace(l)
+		case "m", "maxlen":
+			d.maxLen(args)
+		case "b", "break":
+			d.breakpoints(args)
+		case "e", "eval":
+			d.eval(l, args)
+		case "a", "abort":
+			l.RaiseError("script aborted for user request")
+		case "r", "redis":
+			if len(args) < 2 {
+				d.log("<error> Unknown Redis Lua debugger command or wrong number of arguments.")
+				break
+			}
+			d.redis(l, args[1:])
+		case "p", "print":
+			if len(args) == 2 {
+				d.print(l, args[1])
+			} else {
+				d.printAll(l)
+			}
+		case "l", "list":
+			around, context := d.current, 5
+			if len(args) > 1 {
+				if n, _ := strconv.Atoi(args[1]); n > 0 {
+					around = n
+				}
+			}
+			if len(args) > 2 {
+				context, _ = strconv.Atoi(args[2])
+			}
+			d.list(around, context)
+		case "w", "whole":
+			d.list(1, 1000000)
+		default:
+			d.log("<error> Unknown Redis Lua debugger command or wrong number of arguments.")
+		}
+		d.send()
+	}
+}
+
+func (d *ldb) help() {
+	for _, l := range []string{
+		"Redis Lua debugger help:",
+		"[h]elp               Show this help.",
+		"[s]tep               Run current line and stop again.",
+		"[n]ext               Alias for step.",
+		"[c]ontinue           Run till next breakpoint.",
+		"[l]ist               List source code around current line.",
+		"[l]ist [line]        List source code around [line].",
+		"                     line = 0 means: current position.",
+		"[l]ist [line] [ctx]  In this form [ctx] specifies how many lines",
+		"                     to show before/after [line].",
+		"[w]hole              List all source code. Alias for 'list 1 1000000'.",
+		"[p]rint              Show all the local variables.",
+		"[p]rint <var>        Show the value of the specified variable.",
+		"                     Can also show global vars KEYS and ARGV.",
+		"[b]reak              Show all breakpoints.",
+		"[b]reak <line>       Add a breakpoint to the specified line.",
+		"[b]reak -<line>      Remove breakpoint from the specified line.",
+		"[b]reak 0            Remove all breakpoints.",
+		"[t]race              Show a backtrace.",
+		"[e]val <code>        Execute some Lua code (in a different callframe).",
+		"[r]edis <cmd>        Execute a Redis command.",
+		"[m]axlen [len]       Trim logged Redis replies and Lua var dumps to len.",
+		"                     Specifying zero as <len> means unlimited.",
+		"[a]bort              Stop the execution of the script. In sync",
+		"                     mode dataset changes will be retained.",
+		"",
+		"Debugger functions you can call from Lua scripts:",
+		"redis.debug()        Produce logs in the debugger console.",
+		"redis.breakpoint()   Stop execution like if there was a breakpoint in the",
+		"                     next line of code.",
+	} {
+		d.log(l)
+	}
+}
+
+func (d *ldb) list(around, context int) {
+	for n := 1; n <= len(d.src); n++ {
+		if around != 0 && (n < around-context || n > around+context) {
+			continue
+		}
+		d.logSourceLine(n)
+	}
+}
+
+func (d *ldb) maxLen(args []string) {
+	if len(args) == 2 {
+		n, _ := strconv.Atoi(args[1])
+		d.maxlenHint = true
+		if n != 0 && n <= 60 {
+			n = 60
+		}
+		d.maxlen = n
+	}
+	if d.maxlen != 0 {
+		d.log(fmt.Sprintf("<value> replies are truncated at %d bytes.", d.maxlen))
+	} else {
+		d.log("<value> replies are unlimited.")
+	}
+}
+
+func (d *ldb) breakpoints(args []string) {
+	if len(args) == 1 {
+		if len(d.bps) == 0 {
+			d.log("No breakpoints set. Use 'b <line>' to add one.")
+			return
+		}
+		d.log(fmt.Sprintf("%d breakpoints set:", len(d.bps)))
+		for _, bp := range d.bps {
+			d.logSourceLine(bp)
+		}
+		return
+	}
+	for _, arg := range args[1:] {
+		line, err := strconv.Atoi(arg)
+		switch {
+		case err != nil:
+			d.log(fmt.Sprintf("Invalid argument:'%s'", arg))
+		case line == 0:
+			d.bps = nil
+			d.log("All breakpoints removed.")
+		case line > 0:
+			if len(d.bps) == ldbMaxBreakpoints {
+				d.log("Too many breakpoints set.")
+			} else if line <= len(d.src) && !d.isBreakpoint(line) {
+				d.bps = append(d.bps, line)
+				d.list(line, 1)
+			} else {
+				d.log("Wrong line number.")
+			}
+		default:
+			if !d.isBreakpoint(-line) {
+				d.log("No breakpoint in the specified line.")
+				break
+			}
+			for i, bp := range d.bps {
+				if bp == -line {
+					d.bps = append(d.bps[:i], d.bps[i+1:]...)
+					break
+				}
+			}
+			d.log("Breakpoint removed.")
+		}
+	}
+}
+
+// trace logs the Lua stack. Level 0 is the line hook.
+func (d *ldb) trace(l *lua.LState) {
+	first := true
+	for level := 1; ; level++ {
+		dbg, ok := l.GetStack(level)
+		if !ok {
+			break
+		}
+		if _, err := l.GetInfo("Snl", dbg, lua.LNil); err != nil || dbg.What == "G" {
+			continue
+		}
+		name := dbg.Name
+		if dbg.What == "main" || name == "" {
+			name = "top level"
+		}
+		prefix := "From"
+		if first {
+			prefix = "In"
+			first = false
+		}
+		d.log(fmt.Sprintf("%s %s:", prefix, name))
+		d.logSourceLine(dbg.CurrentLine)
+	}
+	if first {
+		d.log("<error> Can't retrieve Lua stack.")
+	}
+}
+
+// print logs a local variable, or KEYS or ARGV.
+func (d *ldb) print(l *lua.LState, name string) {
+	for level := 1; ; level++ {
+		dbg, ok := l.GetStack(level)
+		if !ok {
+			break
+		}
+		for i := 1; ; i++ {
+			n, v := l.GetLocal(dbg, i)
+			if n == "" {
+				break
+			}
+			if n == name {
+				d.logMaxLen("<value> " + ldbRepr(v, 0))
+				return
+			}
+		}
+	}
+	if name == "KEYS" || name == "ARGV" {
+		d.logMaxLen("<value> " + ldbRepr(l.GetGlobal(name), 0))
+		return
+	}
+	d.log("No such variable.")
+}
+
+// printAll logs the local variables of the current function.
+func (d *ldb) printAll(l *lua.LState) {
+	vars := 0
+	if dbg, ok := l.GetStack(1); ok {
+		for i := 1; ; i++ {
+			n, v := l.GetLocal(dbg, i)
+			if n == "" {
+				break
+			}
+			if strings.HasPrefix(n, "(") {
+				// internal variables, such as "(for index)"
+				continue
+			}
+			d.logMaxLen(fmt.Sprintf("<value> %s = %s", n, ldbRepr(v, 0)))
+			vars++
+		}
+	}
+	if vars == 0 {
+		d.log("No local variables in the current context.")
+	}
+}
+
+// eval runs some Lua, as an expression if possible.
+func (d *ldb) eval(l *lua.LState, args []string) {
+	code := strings.Join(args[1:], " ")
+	fn, err := l.Load(strings.NewReader("return "+code), "@ldb_eval")
+	if err != nil {
+		fn, err = l.Load(strings.NewReader(code), "@ldb_eval")
+		if err != nil {
+			d.log("<error> " + err.Error())
+			return
+		}
+	}
+	l.Push(fn)
+	if err := l.PCall(0, 1, nil); err != nil {
+		d.log("<error> " + luaErrorMsg(err))
+		return
+	}
+	v := l.Get(-1)
+	l.Pop(1)
+	d.logMaxLen("<retval> " + ldbRepr(v, 0))
+}
+
+// redis runs a command with redis.call(), and logs it.
+func (d *ldb) redis(l *lua.LState, args []string) {
+	call := l.GetField(l.GetGlobal("redis"), "call")
+	var largs []lua.LValue
+	for _, a := range args {
+		largs = append(largs, lua.LString(a))
+	}
+	d.step = true
+	err := l.CallByParam(lua.P{
+		Fn:      call,
+		NRet:    1,
+		Protect: true,
+	}, largs...)
+	d.step = false
+	if err == nil {
+		l.Pop(1)
+	}
+}
+
+// redisCall logs a redis.call() from the script, when stepping.
+func (d *ldb) redisCall(args []string, reply string) {
+	if !d.step {
+		return
+	}
+	d.log("<redis> " + strings.Join(args, " "))
+	r, _ := ldbRespToHuman(reply)
+	d.logMaxLen("<reply> " + r)
+}
+
+// debug is redis.debug().
+func (d *ldb) debug(l *lua.LState) {
+	var vals []string
+	for i := 1; i <= l.GetTop(); i++ {
+		vals = append(vals, ldbRepr(l.Get(i), 0))
+	}
+	d.log(fmt.Sprintf("<debug> line %d: %s", d.current, strings.Join(vals, ", ")))
+}
+
+// ldbRepr formats a Lua value the way the Redis debugger does.
+func ldbRepr(v lua.LValue, level int) string {
+	if level == ldbMaxDepth {
+		return "<max recursion level reached! Nested table?>"
+	}
+	level++
+	switch t := v.(type) {
+	case lua.LString:
+		return monitorQuote(string(t))
+	case lua.LBool:
+		if t {
+			return "true"
+		}
+		return "false"
+	case lua.LNumber:
+		return fmt.Sprintf("%.6g", float64(t))
+	case *lua.LNilType:
+		return "nil"
+	case *lua.LTable:
+		var (
+			array    = true
+			expected = 1
+			asArray  []string
+			asTable  []string
+		)
+		t.ForEach(func(k, v lua.LValue) {
+			if n, ok := k.(lua.LNumber); !ok || int(n) != expected || float64(n) != float64(int(n)) {
+				array = false
+			}
+			asArray = append(asArray, ldbRepr(v, level))
+			asTable = append(asTable, "["+ldbRepr(k, level)+"]="+ldbRepr(v, level))
+			expected++
+		})
+		if array {
+			return "{" + strings.Join(asArray, "; ") + "}"
+		}
+		return "{" + strings.Join(asTable, "; ") + "}"
+	case *lua.LFunction:
+		return fmt.Sprintf(`"function@%p"`, t)
+	case *lua.LUserData:
+		return fmt.Sprintf(`"userdata@%p"`, t)
+	case *lua.LState:
+		return fmt.Sprintf(`"thread@%p"`, t)
+	default:
+		return `"<unknown-lua-type>"`
+	}
+}
+
+// ldbRespToHuman formats a RESP reply the way the Redis debugger does.
+// Returns the formatted reply and the rest of the input.
+func ldbRespToHuman(r string) (string, string) {
+	i := strings.Index(r, "\r\n")
+	if i < 1 {
+		return r, ""
+	}
+	line, rest := r[:i], r[i+2:]
+	switch line[0] {
+	case ':':
+		return line[1:], rest
+	case '$', '=':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 || n > len(rest) {
+			return "NULL", rest
+		}
+		return monitorQuote(rest[:n]), strings.TrimPrefix(rest[n:], "\r\n")
+	case '*', '~', '%', '>':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return "NULL", rest
+		}
+		open, sep, end := "[", ",", "]"
+		switch line[0] {
+		case '~':
+			open, end = "~(", ")"
+		case '%':
+			open, end = "{", "}"
+		}
+		var b strings.Builder
+		b.WriteString(open)
+		for j := 0; j < n; j++ {
+			if j > 0 {
+				b.WriteString(sep)
+			}
+			var s string
+			s, rest = ldbRespToHuman(rest)
+			b.WriteString(s)
+			if line[0] == '%' {
+				s, rest = ldbRespToHuman(rest)
+				b.WriteString(" => ")
+				b.WriteString(s)
+			}
+		}
+		b.WriteString(end)
+		return b.String(), rest
+	case '_':
+		return "(null)", rest
+	case '#':
+		if line == "#t" {
+			return "#true", rest
+		}
+		return "#false", rest
+	case ',':
+		return "(double) " + line[1:], rest
+	default:
+		// "+OK", "-ERR ...", and big numbers
+		return line, rest
+	}
+}
@@ -0,0 +1,193 @@
+package miniredis
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+const (
+	msgNotBusy        = "NOTBUSY No scripts in execution right now."
+	msgUnkillable     = "UNKILLABLE Sorry the script already executed write commands against the dataset. You can either wait the script termination or kill the server in a hard way using the SHUTDOWN NOSAVE command."
+	msgBusyFunction   = "BUSY Redis is busy running a script. You can only call FUNCTION KILL or SHUTDOWN NOSAVE."
+	msgScriptKilled   = "ERR Script killed by user with SCRIPT KILL..."
+	msgFunctionKilled = "ERR Script killed by user with FUNCTION KILL..."
+)
+
+// defaultBusyScriptTime is Redis' default "busy-reply-threshold".
+const defaultBusyScriptTime = 5 * time.Second
+
+// scriptRun is the script or function which is running, if any. This has its
+// own lock, since the running script holds the main lock.
+type scriptRun struct {
+	mu       sync.Mutex
+	busyTime time.Duration // SetBusyScriptTime()
+	running  bool
+	function bool             // FCALL, not EVAL
+	fn       *runningFunction // FCALL only
+	start    time.Time
+	written  bool
+	killed   bool
+	cancel   context.CancelFunc
+	done     chan struct{} // closed by end()
+}
+
+// runningFunction is what FUNCTION STATS shows about a running function.
+type runningFunction struct {
+	name string
+	cmd  []string
+	libs map[string]*luaLibrary // m.libraries when the function started
+}
+
+// SetBusyScriptTime sets how long a script can run before other clients get
+// "-BUSY" errors, as "busy-reply-threshold" (or "lua-time-limit") does in
+// Redis. The default is 5 seconds. Once a script is busy it can be stopped
+// with SCRIPT KILL (or FUNCTION KILL), unless it already wrote something.
+func (m *Miniredis) SetBusyScriptTime(d time.Duration) {
+	m.script.mu.Lock()
+	defer m.script.mu.Unlock()
+	m.script.busyTime = d
+}
+
+// begin registers a running script, or a function if fn is given. The context
+// is cancelled by SCRIPT KILL.
+func (s *scriptRun) begin(fn *runningFunction) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = true
+	s.function = fn != nil
+	s.fn = fn
+	s.start = time.Now()
+	s.written = false
+	s.killed = false
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	return ctx
+}
+
+// end is called when the script is done. Returns whether it was killed.
+func (s *scriptRun) end() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cancel()
+	s.running = false
+	s.fn = nil
+	close(s.done)
+	return s.killed
+}
+
+// write is called when the running script calls a write command.
+func (s *scriptRun) write() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.written = true
+}
+
+// busy gives the BUSY error for a command, if a script is running for too
+// long. A command which comes in while a script runs waits here, until either
+// the script is done or it's running for too long, as it would in Redis.
+func (s *scriptRun) busy(cmd string) string {
+	if busyCmds[strings.ToUpper(cmd)] {
+		return ""
+	}
+	for {
+		s.mu.Lock()
+		if !s.running {
+			s.mu.Unlock()
+			return ""
+		}
+		left := s.busyTime - time.Since(s.start)
+		if left <= 0 {
+			defer s.mu.Unlock()
+			if s.function {
+				return msgBusyFunction
+			}
+			return msgBusy
+		}
+		done := s.done
+		s.mu.Unlock()
+
+		t := time.NewTimer(left)
+		select {
+		case <-done:
+		case <-t.C:
+		}
+		t.Stop()
+	}
+}
+
+// kill handles SCRIPT KILL and FUNCTION KILL for a running script. Returns
+// false if there is no running script.
+func (s *scriptRun) kill(function bool) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case !s.running:
+		return "", false
+	case s.function && !function:
+		return msgBusyFunction, true
+	case !s.function && function:
+		return msgBusy, true
+	case s.written:
+		return msgUnkillable, true
+	}
+	s.killed = true
+	s.cancel()
+	return "", true
+}
+
+// scriptKill handles SCRIPT KILL and FUNCTION KILL for a running script, and
+// in StateBusy. Returns true if it did.
+func (m *Miniredis) scriptKill(c *server.Peer, cmd string, args []string) bool {
+	if len(args) != 1 || !strings.EqualFold(args[0], "KILL") || getCtx(c).nested {
+		return false
+	}
+	var function bool
+	switch cmd {
+	case "SCRIPT":
+	case "FUNCTION":
+		function = true
+	default:
+		return false
+	}
+
+	if msg, ok := m.script.kill(function); ok {
+		if msg != "" {
+			c.WriteError(msg)
+		} else {
+			c.WriteOK()
+		}
+		return true
+	}
+
+	m.errors.mu.Lock()
+	defer m.errors.mu.Unlock()
+	if m.errors.state != StateBusy {
+		return false
+	}
+	m.errors.state = StateNormal
+	c.WriteOK()
+	return true
+}
+
+// functionStats handles FUNCTION STATS while a function runs, since that can't
+// wait for the main lock. Returns true if it did.
+func (m *Miniredis) functionStats(c *server.Peer, cmd string, args []string) bool {
+	if cmd != "FUNCTION" || len(args) != 1 || !strings.EqualFold(args[0], "STATS") || getCtx(c).nested {
+		return false
+	}
+
+	m.script.mu.Lock()
+	defer m.script.mu.Unlock()
+	fn := m.script.fn
+	if !m.script.running || fn == nil {
+		return false
+	}
+	writeFunctionStats(c, fn.libs, fn, time.Since(m.script.start))
+	return true
+}
@@ -1,9 +1,15 @@
 package server
 
+import (
+	"strings"
+)
+
 // cmdMeta holds metadata about a registered command
 type cmdMeta struct {
 	handler  Cmd
 	readOnly bool
+	write    bool
+	writeSub map[string]bool // subcommands which are writes
 }
 
 // CmdOption is a function that configures command metadata
@@ -15,3 +21,32 @@ func ReadOnlyOption() CmdOption {
 		meta.readOnly = true
 	}
 }
+
+// WriteOption marks a command as one which can change data, or replicate. These
+// are held by CLIENT PAUSE WRITE.
+func WriteOption() CmdOption {
+	return func(meta *cmdMeta) {
+		meta.write = true
+	}
+}
+
+// WriteSubcommandsOption marks some subcommands of a command as writes, such as
+// FUNCTION LOAD. See WriteOption().
+func WriteSubcommandsOption(subcmds ...string) CmdOption {
+	return func(meta *cmdMeta) {
+		if meta.writeSub == nil {
+			meta.writeSub = map[string]bool{}
+		}
+		for _, sub := range subcmds {
+			meta.writeSub[strings.ToUpper(sub)] = true
+		}
+	}
+}
+
+// isWrite is whether a call with these arguments is a write.
+func (meta *cmdMeta) isWrite(args []string) bool {
+	if meta.write {
+		return true
+	}
+	return len(args) > 0 && meta.writeSub[strings.ToUpper(args[0])]
+}
@@ -0,0 +1,247 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// AcceptMode is what the server does with new connections. See
+// SetAcceptMode().
+type AcceptMode int
+
+const (
+	AcceptNormal    AcceptMode = iota
+	AcceptRefuse               // new connections are closed right away
+	AcceptBlackhole            // new connections are accepted, but never get a reply
+)
+
+// FaultAction is what a Fault does.
+type FaultAction int
+
+const (
+	// FaultClose closes the connection. The command doesn't run.
+	FaultClose FaultAction = iota
+	// FaultPartialReply runs the command, sends the first half of the
+	// reply, and then closes the connection.
+	FaultPartialReply
+	// FaultStall stops reading from all connections for Fault.Duration,
+	// see Stall(). The command runs when the stall is over.
+	FaultStall
+)
+
+// Fault is a network fault for matching commands. Add them with AddFault().
+// Faults only apply to commands from network connections.
+type Fault struct {
+	Cmd      string        // command name, case insensitive. "" matches every command
+	Skip     int           // let this many matching commands pass before the fault fires
+	Count    int           // fire this many times, then the fault is removed. 0 is no limit
+	Action   FaultAction   // what to do
+	Duration time.Duration // for FaultStall
+}
+
+// FaultRule is a Fault added with AddFault().
+type FaultRule struct {
+	fault Fault
+	seen  int
+	fired int
+	s     *Server
+}
+
+// AddFault adds a fault. For example, to close the connection on the 4th
+// XREADGROUP:
+//
+//	s.AddFault(server.Fault{Cmd: "XREADGROUP", Skip: 3, Count: 1, Action: server.FaultClose})
+func (s *Server) AddFault(f Fault) *FaultRule {
+	r := &FaultRule{
+		fault: f,
+		s:     s,
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, r)
+	return r
+}
+
+// ClearFaults removes all faults added with AddFault().
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// Fired returns how often the fault fired.
+func (r *FaultRule) Fired() int {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	return r.fired
+}
+
+// Remove removes the fault. It's fine to call this more than once.
+func (r *FaultRule) Remove() {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	r.s.removeFault(r)
+}
+
+func (s *Server) removeFault(r *FaultRule) {
+	for i, o := range s.faults {
+		if o == r {
+			s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			return
+		}
+	}
+}
+
+// fault finds the fault for a command, if any.
+func (s *Server) fault(cmd string) *Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.faults {
+		if r.fault.Cmd != "" && !strings.EqualFold(r.fault.Cmd, cmd) {
+			continue
+		}
+		r.seen++
+		if r.seen <= r.fault.Skip {
+			continue
+		}
+		r.fired++
+		if r.fault.Count > 0 && r.fired >= r.fault.Count {
+			s.removeFault(r)
+		}
+		f := r.fault
+		return &f
+	}
+	return nil
+}
+
+// SetAcceptMode changes what happens with new connections. Existing
+// connections are not changed.
+func (s *Server) SetAcceptMode(mode AcceptMode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.acceptMode = mode
+}
+
+// blackhole reads and ignores everything from a connection.
+func (s *Server) blackhole(conn net.Conn) {
+	s.wg.Add(1)
+	s.mu.Lock()
+	s.blackholes[conn] = struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		defer s.wg.Done()
+		defer conn.Close()
+
+		io.Copy(io.Discard, conn)
+
+		s.mu.Lock()
+		delete(s.blackholes, conn)
+		s.mu.Unlock()
+	}()
+}
+
+// DropConnections closes all connections for which match returns true, also
+// when they are in the middle of a command. A nil match closes all
+// connections, including connections accepted with AcceptBlackhole. Returns
+// the number of closed connections.
+func (s *Server) DropConnections(match func(*Peer) bool) int {
+	s.mu.Lock()
+	var peers []*Peer
+	for _, p := range s.peers {
+		if match == nil || match(p) {
+			peers = append(peers, p)
+		}
+	}
+	n := len(peers)
+	if match == nil {
+		for c := range s.blackholes {
+			c.Close()
+			n++
+		}
+	}
+	s.mu.Unlock()
+
+	for _, p := range peers {
+		p.Kill()
+	}
+	return n
+}
+
+// Stall stops reading commands from all connections for d, as if there is a
+// network partition. Connections don't read from their socket during the
+// stall, so whatever clients send stays in the OS buffers. A read which was
+// already waiting for data still gets its command, and commands already
+// buffered by a connection are parsed, but none of them run before the stall
+// is over. Commands which are already running are not stopped.
+// Calling Stall again extends the stall if needed.
+func (s *Server) Stall(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if s.stall == nil {
+		s.stall = make(chan struct{})
+	}
+	if until.After(s.stallUntil) {
+		s.stallUntil = until
+	}
+	ch := s.stall
+	time.AfterFunc(d, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.stall == ch && !time.Now().Before(s.stallUntil) {
+			close(ch)
+			s.stall = nil
+		}
+	})
+}
+
+// Unstall ends a Stall() right away.
+func (s *Server) Unstall() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stall != nil {
+		close(s.stall)
+		s.stall = nil
+	}
+}
+
+// waitStall waits until a Stall() is over.
+func (s *Server) waitStall() {
+	s.mu.Lock()
+	ch := s.stall
+	s.mu.Unlock()
+	if ch != nil {
+		<-ch
+	}
+}
+
+// dispatchPartial runs a command, but only writes the first half of the
+// reply.
+func (s *Server) dispatchPartial(conn net.Conn, peer *Peer, args []string) {
+	buf := &bytes.Buffer{}
+	peer.mu.Lock()
+	w := peer.w
+	w.Flush()
+	peer.w = bufio.NewWriter(buf)
+	peer.mu.Unlock()
+
+	s.Dispatch(peer, args)
+	delay, held := peer.release()
+	time.Sleep(delay)
+	peer.mu.Lock()
+	peer.w.Write(held)
+	peer.mu.Unlock()
+	peer.Flush()
+
+	peer.mu.Lock()
+	peer.w = w
+	peer.mu.Unlock()
+	b := buf.Bytes()
+	conn.Write(b[:len(b)/2])
+}
@@ -11,8 +11,28 @@ type Simple string
 // ErrProtocol is the general error for unexpected input
 var ErrProtocol = errors.New("invalid request")
 
-// client always sends arrays with bulk strings
+// inlineMaxSize is the longest inline command, PROTO_INLINE_MAX_SIZE in Redis.
+const inlineMaxSize = 64 * 1024
+
+// protocolError is a malformed request. The client gets it as an error reply,
+// and is then disconnected.
+type protocolError string
+
+func (e protocolError) Error() string {
+	return "Protocol error: " + string(e)
+}
+
+// client sends arrays with bulk strings, or inline commands, as typed in
+// telnet. Returns nil for empty commands.
 func readArray(rd *bufio.Reader) ([]string, error) {
+	b, err := rd.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if b[0] != '*' {
+		return readInline(rd)
+	}
+
 	line, err := rd.ReadString('\n')
 	if err != nil {
 		return nil, err
@@ -21,27 +41,156 @@ func readArray(rd *bufio.Reader) ([]string, error) {
 		return nil, ErrProtocol
 	}
 
-	switch line[0] {
-	default:
-		return nil, ErrProtocol
-	case '*':
-		l, err := strconv.Atoi(line[1 : len(line)-2])
+	l, err := strconv.Atoi(line[1 : len(line)-2])
+	if err != nil {
+		return nil, err
+	}
+	// l can be -1
+	var fields []string
+	for ; l > 0; l-- {
+		s, err := readString(rd)
 		if err != nil {
 			return nil, err
 		}
-		// l can be -1
-		var fields []string
-		for ; l > 0; l-- {
-			s, err := readString(rd)
-			if err != nil {
-				return nil, err
+		fields = append(fields, s)
+	}
+	return fields, nil
+}
+
+// readInline reads an inline command: `SET foo "bar baz"\r\n`.
+func readInline(rd *bufio.Reader) ([]string, error) {
+	var line []byte
+	for {
+		part, err := rd.ReadSlice('\n')
+		line = append(line, part...)
+		if err == nil {
+			break
+		}
+		if err != bufio.ErrBufferFull {
+			return nil, err
+		}
+		if len(line) > inlineMaxSize {
+			return nil, protocolError("too big inline request")
+		}
+	}
+	// both "\r\n" and "\n" are fine
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+
+	args, ok := splitArgs(string(line))
+	if !ok {
+		return nil, protocolError("unbalanced quotes in request")
+	}
+	return args, nil
+}
+
+// splitArgs splits a line the way redis-cli and inline commands do, which is
+// sdssplitargs() in Redis. Arguments are separated by whitespace, and can use
+// "double quotes", with escapes such as "\n" and "\x41", or 'single quotes',
+// where only \' is an escape. A closing quote must be followed by whitespace.
+// Returns false for unbalanced quotes.
+func splitArgs(line string) ([]string, bool) {
+	var (
+		args []string
+		i    = 0
+	)
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i == len(line) {
+			return args, true
+		}
+
+		var (
+			cur        []byte
+			inDQ, inSQ bool
+			done       bool
+		)
+		for !done {
+			end := i >= len(line)
+			switch {
+			case inDQ:
+				switch {
+				case end:
+					return nil, false
+				case line[i] == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHex(line[i+2]) && isHex(line[i+3]):
+					n, _ := strconv.ParseUint(line[i+2:i+4], 16, 8)
+					cur = append(cur, byte(n))
+					i += 3
+				case line[i] == '\\' && i+1 < len(line):
+					i++
+					switch c := line[i]; c {
+					case 'n':
+						cur = append(cur, '\n')
+					case 'r':
+						cur = append(cur, '\r')
+					case 't':
+						cur = append(cur, '\t')
+					case 'b':
+						cur = append(cur, '\b')
+					case 'a':
+						cur = append(cur, '\a')
+					default:
+						cur = append(cur, c)
+					}
+				case line[i] == '"':
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, false
+					}
+					done = true
+				default:
+					cur = append(cur, line[i])
+				}
+			case inSQ:
+				switch {
+				case end:
+					return nil, false
+				case line[i] == '\\' && i+1 < len(line) && line[i+1] == '\'':
+					i++
+					cur = append(cur, '\'')
+				case line[i] == '\'':
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, false
+					}
+					done = true
+				default:
+					cur = append(cur, line[i])
+				}
+			default:
+				switch {
+				case end, line[i] == ' ', line[i] == '\n', line[i] == '\r', line[i] == '\t', line[i] == 0:
+					done = true
+				case line[i] == '"':
+					inDQ = true
+				case line[i] == '\'':
+					inSQ = true
+				default:
+					cur = append(cur, line[i])
+				}
+			}
+			if !end {
+				i++
 			}
-			fields = append(fields, s)
 		}
-		return fields, nil
+		args = append(args, string(cur))
 	}
 }
 
+func isSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
+	}
+	return false
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
 func readString(rd *bufio.Reader) (string, error) {
 	line, err := rd.ReadString('\n')
 	if err != nil {
@@ -40,6 +40,29 @@ func TestReadArray(t *testing.T) {
 		{
 			payload: "*-1\r\n", // not sure this is legal in a request
 		},
+		{
+			payload: "PING\r\n",
+			res:     []string{"PING"},
+		},
+		{
+			payload: "PING\n",
+			res:     []string{"PING"},
+		},
+		{
+			payload: "  SET  foo \"bar baz\"\t'q\\'s'\r\n",
+			res:     []string{"SET", "foo", "bar baz", "q's"},
+		},
+		{
+			payload: "\r\n",
+		},
+		{
+			payload: "SET foo \"bar\r\n",
+			err:     protocolError("unbalanced quotes in request"),
+		},
+		{
+			payload: strings.Repeat("A", 70*1024),
+			err:     protocolError("too big inline request"),
+		},
 	} {
 		res, err := readArray(bufio.NewReader(bytes.NewBufferString(c.payload)))
 		if have, want := err, c.err; have != want {
@@ -52,6 +75,39 @@ func TestReadArray(t *testing.T) {
 	}
 }
 
+func TestSplitArgs(t *testing.T) {
+	type cas struct {
+		line string
+		res  []string
+	}
+	for i, c := range []cas{
+		{line: "", res: nil},
+		{line: "   ", res: nil},
+		{line: "PING", res: []string{"PING"}},
+		{line: " a  b\tc ", res: []string{"a", "b", "c"}},
+		{line: `"a b" 'c d'`, res: []string{"a b", "c d"}},
+		{line: `""`, res: []string{""}},
+		{line: `"\n\r\t\b\a\"\\\q"`, res: []string{"\n\r\t\b\a\"\\q"}},
+		{line: `"\x41\x4a\x4Z"`, res: []string{"AJx4Z"}},
+		{line: `'it\'s' 'a\nb'`, res: []string{"it's", `a\nb`}},
+		{line: `a"b"`, res: []string{"ab"}},
+		{line: `"foo`},
+		{line: `'foo`},
+		{line: `"foo"bar`},
+		{line: `'foo'bar`},
+		{line: `"foo\`},
+	} {
+		res, ok := splitArgs(c.line)
+		if have, want := ok, c.res != nil || strings.TrimSpace(c.line) == ""; have != want {
+			t.Errorf("case %d: have %v, want %v", i, have, want)
+			continue
+		}
+		if have, want := res, c.res; !reflect.DeepEqual(have, want) {
+			t.Errorf("case %d: have %q, want %q", i, have, want)
+		}
+	}
+}
+
 func TestReadString(t *testing.T) {
 	type cas struct {
 		payload string
@@ -2,11 +2,16 @@ package server
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"net"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 	"unicode"
 
 	"github.com/alicebob/miniredis/v2/fpconv"
@@ -31,16 +36,38 @@ type DisconnectHandler func(c *Peer)
 // Hook is can be added to run before every cmd. Return true if the command is done.
 type Hook func(*Peer, string, ...string) bool
 
+// PostHook is called after every known command, with the command as sent by
+// the client, and how long the command took.
+type PostHook func(c *Peer, cmd []string, d time.Duration)
+
+// PauseMode is the mode set by CLIENT PAUSE
+type PauseMode int
+
+const (
+	PauseOff   PauseMode = iota
+	PauseWrite           // hold commands not registered with ReadOnlyOption()
+	PauseAll             // hold all commands
+)
+
 // Server is a simple redis server
 type Server struct {
-	l         net.Listener
-	cmds      map[string]*cmdMeta
-	preHook   Hook
-	peers     map[net.Conn]struct{}
-	mu        sync.Mutex
-	wg        sync.WaitGroup
-	infoConns int
-	infoCmds  int
+	l          net.Listener
+	cmds       map[string]*cmdMeta
+	preHook    Hook
+	postHook   PostHook
+	peers      map[net.Conn]*Peer
+	mu         sync.Mutex
+	wg         sync.WaitGroup
+	infoConns  int
+	infoCmds   int
+	lastID     int
+	pause      PauseMode
+	unpaused   *sync.Cond // signalled by Unpause()
+	faults     []*FaultRule
+	acceptMode AcceptMode
+	blackholes map[net.Conn]struct{} // connections from AcceptBlackhole
+	stall      chan struct{}         // closed when the Stall() is over. nil if not stalled
+	stallUntil time.Time
 }
 
 // NewServer makes a server listening on addr. Close with .Close().
@@ -62,10 +89,12 @@ func NewServerTLS(addr string, cfg *tls.Config) (*Server, error) {
 
 func newServer(l net.Listener) *Server {
 	s := Server{
-		cmds:  map[string]*cmdMeta{},
-		peers: map[net.Conn]struct{}{},
-		l:     l,
+		cmds:       map[string]*cmdMeta{},
+		peers:      map[net.Conn]*Peer{},
+		blackholes: map[net.Conn]struct{}{},
+		l:          l,
 	}
+	s.unpaused = sync.NewCond(&s.mu)
 
 	s.wg.Add(1)
 	go func() {
@@ -76,6 +105,9 @@ func newServer(l net.Listener) *Server {
 		for c := range s.peers {
 			c.Close()
 		}
+		for c := range s.blackholes {
+			c.Close()
+		}
 		s.mu.Unlock()
 	}()
 	return &s
@@ -88,21 +120,50 @@ func (s *Server) SetPreHook(h Hook) {
 	s.mu.Unlock()
 }
 
+// (un)set a hook which is ran after every call.
+func (s *Server) SetPostHook(h PostHook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.postHook = h
+}
+
 func (s *Server) serve(l net.Listener) {
 	for {
 		conn, err := l.Accept()
 		if err != nil {
 			return
 		}
-		s.ServeConn(conn)
+		s.mu.Lock()
+		mode := s.acceptMode
+		s.mu.Unlock()
+		switch mode {
+		case AcceptRefuse:
+			conn.Close()
+		case AcceptBlackhole:
+			s.blackhole(conn)
+		default:
+			s.ServeConn(conn)
+		}
 	}
 }
 
 // ServeConn handles a net.Conn. Nice with net.Pipe()
 func (s *Server) ServeConn(conn net.Conn) {
+	peer := &Peer{
+		w:       bufio.NewWriter(conn),
+		srv:     s,
+		conn:    conn,
+		addr:    conn.RemoteAddr().String(),
+		laddr:   conn.LocalAddr().String(),
+		created: time.Now(),
+	}
+	peer.lastActive = peer.created
+
 	s.wg.Add(1)
 	s.mu.Lock()
-	s.peers[conn] = struct{}{}
+	s.lastID++
+	peer.id = s.lastID
+	s.peers[conn] = peer
 	s.infoConns++
 	s.mu.Unlock()
 
@@ -110,7 +171,7 @@ func (s *Server) ServeConn(conn net.Conn) {
 		defer s.wg.Done()
 		defer conn.Close()
 
-		s.servePeer(conn)
+		s.servePeer(conn, peer)
 
 		s.mu.Lock()
 		delete(s.peers, conn)
@@ -138,9 +199,44 @@ func (s *Server) Close() {
 	s.l = nil
 	s.mu.Unlock()
 
+	// paused and stalled commands would wait forever
+	s.Unpause()
+	s.Unstall()
+
 	s.wg.Wait()
 }
 
+// Pause holds commands in Dispatch() until Unpause() is called, the same as
+// CLIENT PAUSE. Commands from peers made with NewPeer() are never held.
+func (s *Server) Pause(mode PauseMode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pause = mode
+	if mode == PauseOff {
+		s.unpaused.Broadcast()
+	}
+}
+
+// Unpause releases all commands held by Pause().
+func (s *Server) Unpause() {
+	s.Pause(PauseOff)
+}
+
+// paused returns whether a command should be held. Needs s.mu.
+func (s *Server) paused(c *Peer, meta *cmdMeta, args []string) bool {
+	if c.conn == nil || c.Closed() {
+		return false
+	}
+	switch s.pause {
+	case PauseAll:
+		return true
+	case PauseWrite:
+		return meta.isWrite(args)
+	default:
+		return false
+	}
+}
+
 // Register a command. It can't have been registered before. Safe to call on a
 // running server.
 func (s *Server) Register(cmd string, f Cmd, options ...CmdOption) error {
@@ -163,11 +259,8 @@ func (s *Server) Register(cmd string, f Cmd, options ...CmdOption) error {
 	return nil
 }
 
-func (s *Server) servePeer(c net.Conn) {
+func (s *Server) servePeer(c net.Conn, peer *Peer) {
 	r := bufio.NewReader(c)
-	peer := &Peer{
-		w: bufio.NewWriter(c),
-	}
 
 	defer func() {
 		for _, f := range peer.onDisconnect {
@@ -176,34 +269,81 @@ func (s *Server) servePeer(c net.Conn) {
 	}()
 
 	readCh := make(chan []string)
+	peer.mu.Lock()
+	peer.next = readCh
+	peer.mu.Unlock()
 
+	var readErr error
 	go func() {
 		defer close(readCh)
 
 		for {
+			s.waitStall()
 			args, err := readArray(r)
 			if err != nil {
-				peer.Close()
+				if _, ok := err.(protocolError); !ok {
+					peer.Close()
+				}
+				readErr = err
 				return
 			}
+			if len(args) == 0 {
+				continue
+			}
 
 			readCh <- args
 		}
 	}()
 
 	for args := range readCh {
+		s.waitStall()
+		if f := s.fault(args[0]); f != nil {
+			switch f.Action {
+			case FaultClose:
+				c.Close()
+				for range readCh {
+				}
+				return
+			case FaultPartialReply:
+				s.dispatchPartial(c, peer, args)
+				c.Close()
+				for range readCh {
+				}
+				return
+			case FaultStall:
+				s.Stall(f.Duration)
+				s.waitStall()
+			}
+		}
+
 		s.Dispatch(peer, args)
+		delay, held := peer.release()
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+		peer.mu.Lock()
+		peer.w.Write(held)
+		peer.mu.Unlock()
 		peer.Flush()
 
 		if peer.Closed() {
 			c.Close()
 		}
 	}
+
+	if err, ok := readErr.(protocolError); ok {
+		// after the replies to the commands before it
+		peer.WriteError("ERR " + err.Error())
+		peer.Flush()
+	}
 }
 
 func (s *Server) Dispatch(c *Peer, args []string) {
 	cmd, args := args[0], args[1:]
 	cmdUp := strings.ToUpper(cmd)
+	c.mu.Lock()
+	c.lastActive = time.Now()
+	c.mu.Unlock()
 	s.mu.Lock()
 	h := s.preHook
 	s.mu.Unlock()
@@ -222,11 +362,35 @@ func (s *Server) Dispatch(c *Peer, args []string) {
 	}
 
 	s.mu.Lock()
+	for s.paused(c, cmdMeta, args) {
+		s.unpaused.Wait()
+		if c.Closed() {
+			// killed while it waited
+			s.mu.Unlock()
+			return
+		}
+	}
 	s.infoCmds++
 	s.mu.Unlock()
+	c.mu.Lock()
+	c.lastCmd = strings.ToLower(cmd)
+	c.cmd = append([]string{cmd}, args...)
+	c.skip = c.replyOff || c.skipNext
+	c.skipNext = false
+	c.mu.Unlock()
+	start := time.Now()
 	cmdMeta.handler(c, cmdUp, args)
+	took := time.Since(start)
+	s.mu.Lock()
+	post := s.postHook
+	s.mu.Unlock()
+	if post != nil {
+		post(c, append([]string{cmd}, args...), took)
+	}
 	if c.SwitchResp3 != nil {
+		c.mu.Lock()
 		c.Resp3 = *c.SwitchResp3
+		c.mu.Unlock()
 		c.SwitchResp3 = nil
 	}
 }
@@ -247,6 +411,29 @@ func (s *Server) IsRegisteredCommand(cmd string) bool {
 	return ok
 }
 
+// IsWriteCall checks if a command, with its arguments, is a write: the command
+// is marked with WriteOption(), or the subcommand with
+// WriteSubcommandsOption().
+func (s *Server) IsWriteCall(cmd []string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cmdMeta, ok := s.cmds[strings.ToUpper(cmd[0])]; ok {
+		return cmdMeta.isWrite(cmd[1:])
+	}
+	return false
+}
+
+// IsWriteCommand checks if a command is marked with WriteOption()
+func (s *Server) IsWriteCommand(cmd string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cmdUp := strings.ToUpper(cmd)
+	if cmdMeta, ok := s.cmds[cmdUp]; ok {
+		return cmdMeta.write
+	}
+	return false
+}
+
 // IsReadOnlyCommand checks if a command is marked as read-only
 func (s *Server) IsReadOnlyCommand(cmd string) bool {
 	s.mu.Lock()
@@ -265,6 +452,22 @@ func (s *Server) ClientsLen() int {
 	return len(s.peers)
 }
 
+// Peers gives all connected clients, ordered by ID. Closed clients are
+// skipped.
+func (s *Server) Peers() []*Peer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ps := make([]*Peer, 0, len(s.peers))
+	for _, p := range s.peers {
+		if p.Closed() {
+			continue
+		}
+		ps = append(ps, p)
+	}
+	sort.Slice(ps, func(i, j int) bool { return ps[i].id < ps[j].id })
+	return ps
+}
+
 // TotalConnections give the number of clients connected since the server
 // started, including the currently connected ones
 func (s *Server) TotalConnections() int {
@@ -283,8 +486,35 @@ type Peer struct {
 	onDisconnect []func()    // list of callbacks
 	mu           sync.Mutex  // for Block()
 	ClientName   string      // client name set by CLIENT SETNAME
+	LibName      string      // set by CLIENT SETINFO
+	LibVer       string      // set by CLIENT SETINFO
+	conn         net.Conn    // nil for peers made with NewPeer()
+	srv          *Server     // nil for peers made with NewPeer()
+	id           int
+	addr         string
+	laddr        string
+	created      time.Time
+	lastActive   time.Time
+	lastCmd      string
+	cmd          []string        // the last command, with arguments
+	replyOff     bool            // CLIENT REPLY OFF
+	skipNext     bool            // CLIENT REPLY SKIP, for the next command
+	skip         bool            // don't send replies for the current command
+	delay        time.Duration   // wait this long before sending the reply
+	next         <-chan []string // commands read from the connection
+	streams      []stream        // RESP2 streamed aggregates, see Writer.WriteStreamedLen()
+	held         *stream         // the reply held back by Delay()
 }
 
+// ReplyMode is the mode set by CLIENT REPLY
+type ReplyMode int
+
+const (
+	ReplyOn ReplyMode = iota
+	ReplyOff
+	ReplySkip
+)
+
 func NewPeer(w *bufio.Writer) *Peer {
 	return &Peer{
 		w: w,
@@ -301,8 +531,81 @@ func (c *Peer) Flush() {
 // Close the client connection after the current command is done.
 func (c *Peer) Close() {
 	c.mu.Lock()
-	defer c.mu.Unlock()
 	c.closed = true
+	c.mu.Unlock()
+	c.wakePaused()
+}
+
+// ReadCommand reads the next command from the connection, while the current
+// command is still running. It's for commands which talk their own protocol
+// with the client, such as the Lua debugger. Returns false if the connection
+// is closed, or the peer was made with NewPeer().
+func (c *Peer) ReadCommand() ([]string, bool) {
+	c.mu.Lock()
+	next := c.next
+	c.mu.Unlock()
+	if next == nil {
+		return nil, false
+	}
+	args, ok := <-next
+	return args, ok
+}
+
+// Kill closes the client connection right away. Use Close() to close the
+// connection after the current command.
+func (c *Peer) Kill() {
+	c.mu.Lock()
+	c.closed = true
+	conn := c.conn
+	c.mu.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+	c.wakePaused()
+}
+
+// wakePaused wakes up the commands held by Pause(), so a closed peer stops
+// waiting.
+func (c *Peer) wakePaused() {
+	if c.srv == nil {
+		return
+	}
+	c.srv.mu.Lock()
+	defer c.srv.mu.Unlock()
+	c.srv.unpaused.Broadcast()
+}
+
+// Delay makes the reply of the current command wait d before it's sent. No
+// locks are held while waiting. Calls add up. Everything written after the
+// first call is held back until the command is done, so call it before the
+// reply is written. Peers made with NewPeer() are not delayed.
+func (c *Peer) Delay(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d <= 0 || c.conn == nil {
+		return
+	}
+	c.delay += d
+	if c.held == nil {
+		c.held = &stream{out: c.w, buf: &bytes.Buffer{}}
+		c.w = bufio.NewWriter(c.held.buf)
+	}
+}
+
+// release ends a Delay(). It returns the delay, and the reply written since.
+func (c *Peer) release() (time.Duration, []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d := c.delay
+	c.delay = 0
+	if c.held == nil {
+		return d, nil
+	}
+	c.w.Flush()
+	c.w = c.held.out
+	b := c.held.buf.Bytes()
+	c.held = nil
+	return d, b
 }
 
 // Return true if the peer connection closed.
@@ -318,11 +621,98 @@ func (c *Peer) OnDisconnect(f func()) {
 	c.onDisconnect = append(c.onDisconnect, f)
 }
 
+// ID is the unique client ID. 0 for peers made with NewPeer().
+func (c *Peer) ID() int {
+	return c.id
+}
+
+// Addr is the address of the client, as "ip:port"
+func (c *Peer) Addr() string {
+	return c.addr
+}
+
+// LocalAddr is the address of the server side of the connection
+func (c *Peer) LocalAddr() string {
+	return c.laddr
+}
+
+// Created is when the client connected
+func (c *Peer) Created() time.Time {
+	return c.created
+}
+
+// LastActive is when the client sent its last command
+func (c *Peer) LastActive() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastActive
+}
+
+// LastCmd is the (lowercase) name of the last known command
+func (c *Peer) LastCmd() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastCmd
+}
+
+// Cmd is the command being run, or the last command run, with its arguments.
+func (c *Peer) Cmd() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cmd
+}
+
+// Inspect calls f with the peer lock held. Use it to read the state (such as
+// Ctx) of other peers. f can't call other Peer methods.
+func (c *Peer) Inspect(f func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f()
+}
+
+// SetReplyMode changes whether replies are sent, as CLIENT REPLY does. With
+// ReplyOff and ReplySkip the reply of the current command is not sent either.
+func (c *Peer) SetReplyMode(m ReplyMode) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch m {
+	case ReplyOn:
+		c.replyOff = false
+		c.skipNext = false
+		c.skip = false
+	case ReplyOff:
+		c.replyOff = true
+		c.skip = true
+	case ReplySkip:
+		c.skipNext = true
+		c.skip = true
+	}
+}
+
 // issue multiple calls, guarded with a mutex
 func (c *Peer) Block(f func(*Writer)) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	f(&Writer{c.w, c.Resp3})
+	if c.skip {
+		f(&Writer{w: bufio.NewWriter(io.Discard), resp3: c.Resp3})
+		return
+	}
+	w := &Writer{w: c.w, resp3: c.Resp3, streams: c.streams}
+	f(w)
+	c.w, c.streams = w.w, w.streams
+}
+
+// Push is Block() for out-of-band messages, such as pubsub messages. They are
+// sent regardless of CLIENT REPLY.
+func (c *Peer) Push(f func(*Writer)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := c.w
+	if len(c.streams) > 0 {
+		// not part of the streamed reply
+		w = c.streams[0].out
+	}
+	f(&Writer{w: w, resp3: c.Resp3})
 }
 
 // WriteError writes a redis 'Error'
@@ -400,6 +790,77 @@ func (c *Peer) WriteFloat(n float64) {
 	})
 }
 
+// WriteBool writes a boolean
+func (c *Peer) WriteBool(b bool) {
+	c.Block(func(w *Writer) {
+		w.WriteBool(b)
+	})
+}
+
+// WriteBigNumber writes a big number, given as a string of digits
+func (c *Peer) WriteBigNumber(n string) {
+	c.Block(func(w *Writer) {
+		w.WriteBigNumber(n)
+	})
+}
+
+// WriteVerbatim writes a verbatim string, with a 3 letter format such as "txt"
+func (c *Peer) WriteVerbatim(format, s string) {
+	c.Block(func(w *Writer) {
+		w.WriteVerbatim(format, s)
+	})
+}
+
+// WriteBlobError writes an error which can contain newlines
+func (c *Peer) WriteBlobError(e string) {
+	c.Block(func(w *Writer) {
+		w.WriteBlobError(e)
+	})
+}
+
+// WriteAttributeLen starts attributes with the given length (number of keys).
+// Writes nothing for RESP2.
+func (c *Peer) WriteAttributeLen(n int) {
+	c.Block(func(w *Writer) {
+		w.WriteAttributeLen(n)
+	})
+}
+
+// WriteStreamedString writes a string in chunks
+func (c *Peer) WriteStreamedString(chunks []string) {
+	c.Block(func(w *Writer) {
+		w.WriteStreamedString(chunks)
+	})
+}
+
+// WriteStreamedLen starts an array of unknown length.
+func (c *Peer) WriteStreamedLen() {
+	c.Block(func(w *Writer) {
+		w.WriteStreamedLen()
+	})
+}
+
+// WriteStreamedMapLen starts a map of unknown length.
+func (c *Peer) WriteStreamedMapLen() {
+	c.Block(func(w *Writer) {
+		w.WriteStreamedMapLen()
+	})
+}
+
+// WriteStreamedSetLen starts a set of unknown length.
+func (c *Peer) WriteStreamedSetLen() {
+	c.Block(func(w *Writer) {
+		w.WriteStreamedSetLen()
+	})
+}
+
+// WriteStreamedEnd ends a streamed array, map, or set.
+func (c *Peer) WriteStreamedEnd() {
+	c.Block(func(w *Writer) {
+		w.WriteStreamedEnd()
+	})
+}
+
 // WriteRaw writes a raw redis response
 func (c *Peer) WriteRaw(s string) {
 	c.Block(func(w *Writer) {
@@ -425,8 +886,18 @@ func toInline(s string) string {
 
 // A Writer is given to the callback in Block()
 type Writer struct {
-	w     *bufio.Writer
-	resp3 bool
+	w       *bufio.Writer
+	resp3   bool
+	streams []stream
+}
+
+// stream is output which is buffered until it's complete. For a RESP2 streamed
+// aggregate that's needed because RESP2 has no aggregates of unknown length, so
+// the elements are buffered until the end, and then written as an array. It's
+// also used for the reply held back by Peer.Delay().
+type stream struct {
+	out *bufio.Writer // where the buffered output goes
+	buf *bytes.Buffer
 }
 
 // WriteError writes a redis 'Error'
@@ -435,6 +906,11 @@ func (w *Writer) WriteError(e string) {
 }
 
 func (w *Writer) WriteLen(n int) {
+	if n < 0 && w.resp3 {
+		// RESP3 has no "null array"
+		w.WriteNull()
+		return
+	}
 	fmt.Fprintf(w.w, "*%d\r\n", n)
 }
 
@@ -498,6 +974,179 @@ func (w *Writer) WriteNull() {
 	fmt.Fprintf(w.w, "$-1\r\n")
 }
 
+// WriteBool writes a boolean. RESP2 has no booleans, and gets 1 or 0.
+func (w *Writer) WriteBool(b bool) {
+	if w.resp3 {
+		if b {
+			fmt.Fprint(w.w, "#t\r\n")
+		} else {
+			fmt.Fprint(w.w, "#f\r\n")
+		}
+		return
+	}
+	if b {
+		w.WriteInt(1)
+	} else {
+		w.WriteInt(0)
+	}
+}
+
+// WriteBigNumber writes a big number, given as a string of digits. RESP2 gets a
+// bulk string.
+func (w *Writer) WriteBigNumber(n string) {
+	if w.resp3 {
+		fmt.Fprintf(w.w, "(%s\r\n", n)
+		return
+	}
+	w.WriteBulk(n)
+}
+
+// WriteVerbatim writes a verbatim string, with a 3 letter format such as "txt"
+// or "mkd". RESP2 gets a bulk string, without the format.
+func (w *Writer) WriteVerbatim(format, s string) {
+	if w.resp3 {
+		fmt.Fprintf(w.w, "=%d\r\n%s:%s\r\n", len(format)+1+len(s), format, s)
+		return
+	}
+	w.WriteBulk(s)
+}
+
+// WriteBlobError writes an error which can contain newlines. RESP2 gets a
+// normal error.
+func (w *Writer) WriteBlobError(e string) {
+	if w.resp3 {
+		fmt.Fprintf(w.w, "!%d\r\n%s\r\n", len(e), e)
+		return
+	}
+	w.WriteError(e)
+}
+
+// WriteAttributeLen starts attributes with the given length (number of keys).
+// The attributes are followed by the actual reply. RESP2 has no attributes,
+// and this writes nothing, so check Resp3() before writing the attributes
+// themselves.
+func (w *Writer) WriteAttributeLen(n int) {
+	if !w.resp3 {
+		return
+	}
+	fmt.Fprintf(w.w, "|%d\r\n", n)
+}
+
+// WriteStreamedString writes a string in chunks. RESP2 gets a single bulk
+// string.
+func (w *Writer) WriteStreamedString(chunks []string) {
+	if !w.resp3 {
+		w.WriteBulk(strings.Join(chunks, ""))
+		return
+	}
+	fmt.Fprint(w.w, "$?\r\n")
+	for _, c := range chunks {
+		if c == "" {
+			// an empty chunk would end the string
+			continue
+		}
+		fmt.Fprintf(w.w, ";%d\r\n%s\r\n", len(c), c)
+	}
+	fmt.Fprint(w.w, ";0\r\n")
+}
+
+// WriteStreamedLen starts an array of unknown length. End it with
+// WriteStreamedEnd(). RESP2 has no streamed types, and gets a normal array,
+// which is only written when it ends.
+func (w *Writer) WriteStreamedLen() {
+	if !w.resp3 {
+		w.startStream()
+		return
+	}
+	fmt.Fprint(w.w, "*?\r\n")
+}
+
+// WriteStreamedMapLen starts a map of unknown length. See WriteStreamedLen().
+func (w *Writer) WriteStreamedMapLen() {
+	if !w.resp3 {
+		w.startStream()
+		return
+	}
+	fmt.Fprint(w.w, "%?\r\n")
+}
+
+// WriteStreamedSetLen starts a set of unknown length. See WriteStreamedLen().
+func (w *Writer) WriteStreamedSetLen() {
+	if !w.resp3 {
+		w.startStream()
+		return
+	}
+	fmt.Fprint(w.w, "~?\r\n")
+}
+
+// WriteStreamedEnd ends a streamed array, map, or set.
+func (w *Writer) WriteStreamedEnd() {
+	if w.resp3 {
+		fmt.Fprint(w.w, ".\r\n")
+		return
+	}
+	if len(w.streams) == 0 {
+		return
+	}
+	st := w.streams[len(w.streams)-1]
+	w.streams = w.streams[:len(w.streams)-1]
+	w.w.Flush()
+	w.w = st.out
+	b := st.buf.Bytes()
+	w.WriteLen(countValues(b))
+	w.w.Write(b)
+}
+
+// startStream buffers everything until the next WriteStreamedEnd().
+func (w *Writer) startStream() {
+	buf := &bytes.Buffer{}
+	w.streams = append(w.streams, stream{out: w.w, buf: buf})
+	w.w = bufio.NewWriter(buf)
+}
+
+// countValues counts the RESP2 values in b.
+func countValues(b []byte) int {
+	n := 0
+	for len(b) > 0 {
+		b = skipValue(b)
+		n++
+	}
+	return n
+}
+
+// skipValue returns what's left after the first RESP2 value in b.
+func skipValue(b []byte) []byte {
+	i := bytes.Index(b, []byte("\r\n"))
+	if i < 1 {
+		return nil
+	}
+	line, rest := b[1:i], b[i+2:]
+	switch b[0] {
+	case '$':
+		n, _ := strconv.Atoi(string(line))
+		if n < 0 {
+			return rest
+		}
+		if len(rest) < n+2 {
+			return nil
+		}
+		return rest[n+2:]
+	case '*':
+		n, _ := strconv.Atoi(string(line))
+		for ; n > 0; n-- {
+			rest = skipValue(rest)
+		}
+		return rest
+	default:
+		return rest
+	}
+}
+
+// Resp3 is whether the peer uses RESP3.
+func (w *Writer) Resp3() bool {
+	return w.resp3
+}
+
 // WriteInline writes a redis inline string
 func (w *Writer) WriteInline(s string) {
 	fmt.Fprintf(w.w, "+%s\r\n", toInline(s))
@@ -1,13 +1,16 @@
 package server
 
 import (
+	"bufio"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/alicebob/miniredis/v2/proto"
 )
@@ -272,6 +275,111 @@ func TestFormatFloat(t *testing.T) {
 	eq(t, "4.8", a)
 }
 
+func TestWriterResp3Types(t *testing.T) {
+	write := func(resp3 bool, f func(*Writer)) string {
+		buf := &strings.Builder{}
+		bw := bufio.NewWriter(buf)
+		f(&Writer{w: bw, resp3: resp3})
+		bw.Flush()
+		return buf.String()
+	}
+	eq := func(t *testing.T, want2, want3 string, f func(*Writer)) {
+		t.Helper()
+		if have := write(false, f); have != want2 {
+			t.Errorf("RESP2 have: %q, want: %q", have, want2)
+		}
+		if have := write(true, f); have != want3 {
+			t.Errorf("RESP3 have: %q, want: %q", have, want3)
+		}
+	}
+
+	eq(t, proto.Int(1), proto.Bool(true), func(w *Writer) { w.WriteBool(true) })
+	eq(t, proto.Int(0), proto.Bool(false), func(w *Writer) { w.WriteBool(false) })
+	eq(t,
+		proto.String("3492890328409238509324850943850943825024385"),
+		proto.BigNumber("3492890328409238509324850943850943825024385"),
+		func(w *Writer) { w.WriteBigNumber("3492890328409238509324850943850943825024385") },
+	)
+	eq(t,
+		proto.String("Some string"),
+		proto.Verbatim("Some string"),
+		func(w *Writer) { w.WriteVerbatim("txt", "Some string") },
+	)
+	eq(t,
+		proto.Error("SYNTAX invalid syntax"),
+		proto.BlobError("SYNTAX invalid\nsyntax"),
+		func(w *Writer) { w.WriteBlobError("SYNTAX invalid\nsyntax") },
+	)
+	eq(t,
+		proto.String("Hello world"),
+		proto.StreamedString("Hell", "o wor", "ld"),
+		func(w *Writer) { w.WriteStreamedString([]string{"Hell", "o wor", "", "ld"}) },
+	)
+
+	// RESP3 only
+	have := write(true, func(w *Writer) {
+		w.WriteAttributeLen(1)
+		w.WriteBulk("key-popularity")
+		w.WriteFloat(0.1923)
+		w.WriteLen(1)
+		w.WriteInt(2039123)
+	})
+	want := proto.Attribute(
+		proto.Ints(2039123),
+		proto.String("key-popularity"), ",0.1923\r\n",
+	)
+	if have != want {
+		t.Errorf("have: %q, want: %q", have, want)
+	}
+
+	eq(t,
+		proto.Array(
+			proto.Int(1),
+			proto.Array(proto.String("a")),
+			proto.Array(proto.String("b"), proto.Int(2)),
+			proto.Array(proto.Nil, proto.String("c\r\nd")),
+		),
+		proto.StreamedArray(
+			proto.Int(1),
+			proto.StreamedSet(proto.String("a")),
+			proto.StreamedMap(proto.String("b"), proto.Int(2)),
+			proto.Array(proto.NilResp3, proto.String("c\r\nd")),
+		),
+		func(w *Writer) {
+			w.WriteStreamedLen()
+			w.WriteInt(1)
+			w.WriteStreamedSetLen()
+			w.WriteBulk("a")
+			w.WriteStreamedEnd()
+			w.WriteStreamedMapLen()
+			w.WriteBulk("b")
+			w.WriteInt(2)
+			w.WriteStreamedEnd()
+			w.WriteLen(2)
+			w.WriteNull()
+			w.WriteBulk("c\r\nd")
+			w.WriteStreamedEnd()
+		},
+	)
+
+	// RESP2 has no attributes
+	eq(t, "", "|1\r\n", func(w *Writer) { w.WriteAttributeLen(1) })
+
+	t.Run("peer", func(t *testing.T) {
+		buf := &strings.Builder{}
+		c := NewPeer(bufio.NewWriter(buf))
+		c.WriteStreamedLen()
+		c.WriteInt(1)
+		c.Push(func(w *Writer) { w.WriteInline("pushed") })
+		c.WriteBulk("a")
+		c.WriteStreamedEnd()
+		c.Flush()
+		if have, want := buf.String(), proto.Inline("pushed")+proto.Array(proto.Int(1), proto.String("a")); have != want {
+			t.Errorf("have: %q, want: %q", have, want)
+		}
+	})
+}
+
 func TestReadOnlyOption(t *testing.T) {
 	srv, err := NewServer("127.0.0.1:0")
 	if err != nil {
@@ -328,3 +436,339 @@ func TestIsRegisteredCommand(t *testing.T) {
 		t.Error("NONEXISTENT should not be registered")
 	}
 }
+
+func TestPeers(t *testing.T) {
+	srv, err := NewServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	srv.Register("WHOAMI", func(c *Peer, cmd string, args []string) {
+		c.WriteInt(c.ID())
+	})
+
+	c1, err := proto.Dial(srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	c2, err := proto.Dial(srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+
+	res, err := c2.Do("WHOAMI")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := res, proto.Int(2); have != want {
+		t.Errorf("have: %s, want: %s", have, want)
+	}
+
+	peers := srv.Peers()
+	if have, want := len(peers), 2; have != want {
+		t.Fatalf("have: %d, want: %d", have, want)
+	}
+	p := peers[1]
+	if have, want := p.ID(), 2; have != want {
+		t.Errorf("have: %d, want: %d", have, want)
+	}
+	if have, want := p.LastCmd(), "whoami"; have != want {
+		t.Errorf("have: %s, want: %s", have, want)
+	}
+	if have, want := p.LocalAddr(), srv.Addr().String(); have != want {
+		t.Errorf("have: %s, want: %s", have, want)
+	}
+
+	p.Kill()
+	if _, err := c2.Do("WHOAMI"); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestPause(t *testing.T) {
+	srv, err := NewServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	srv.Register("GET", func(c *Peer, cmd string, args []string) {
+		c.WriteNull()
+	}, ReadOnlyOption())
+	srv.Register("SET", func(c *Peer, cmd string, args []string) {
+		c.WriteOK()
+	}, WriteOption())
+	srv.Register("PING", func(c *Peer, cmd string, args []string) {
+		c.WriteInline("PONG")
+	})
+
+	c, err := proto.Dial(srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	srv.Pause(PauseWrite)
+	// neither read-only, nor a write
+	if res, err := c.Do("PING"); err != nil || res != proto.Inline("PONG") {
+		t.Fatalf("have: %q %v", res, err)
+	}
+	if res, err := c.Do("GET"); err != nil || res != proto.Nil {
+		t.Fatalf("have: %q %v", res, err)
+	}
+	done := make(chan string)
+	go func() {
+		res, _ := c.Do("SET")
+		done <- res
+	}()
+	select {
+	case <-done:
+		t.Fatal("SET should be paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+	srv.Unpause()
+	if have, want := <-done, proto.Inline("OK"); have != want {
+		t.Errorf("have: %s, want: %s", have, want)
+	}
+
+	t.Run("subcommands", func(t *testing.T) {
+		srv.Register("FUNCTION", func(c *Peer, cmd string, args []string) {
+			c.WriteOK()
+		}, WriteSubcommandsOption("load"))
+		srv.Pause(PauseWrite)
+		defer srv.Unpause()
+		if res, err := c.Do("FUNCTION", "LIST"); err != nil || res != proto.Inline("OK") {
+			t.Fatalf("have: %q %v", res, err)
+		}
+		if !srv.IsWriteCall([]string{"function", "Load"}) {
+			t.Error("FUNCTION LOAD should be a write")
+		}
+	})
+
+	t.Run("killed", func(t *testing.T) {
+		c2, err := proto.Dial(srv.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c2.Close()
+
+		srv.Pause(PauseAll)
+		defer srv.Unpause()
+		go c2.Do("SET")
+		time.Sleep(20 * time.Millisecond)
+		srv.DropConnections(nil)
+		for i := 0; len(srv.Peers()) > 0; i++ {
+			if i > 100 {
+				t.Fatal("peers still waiting")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+}
+
+func TestFaults(t *testing.T) {
+	srv, err := NewServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	srv.Register("PING", func(c *Peer, cmd string, args []string) {
+		c.WriteInline("PONG")
+	})
+	srv.Register("ECHO", func(c *Peer, cmd string, args []string) {
+		c.WriteBulk(args[0])
+	})
+	addr := srv.Addr().String()
+
+	dial := func(t *testing.T) *proto.Client {
+		t.Helper()
+		c, err := proto.Dial(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	ping := func(t *testing.T, c *proto.Client) {
+		t.Helper()
+		if res, err := c.Do("PING"); err != nil || res != proto.Inline("PONG") {
+			t.Fatalf("have: %q %v", res, err)
+		}
+	}
+
+	t.Run("close", func(t *testing.T) {
+		c := dial(t)
+		defer c.Close()
+
+		f := srv.AddFault(Fault{Cmd: "echo", Skip: 1, Count: 1, Action: FaultClose})
+		if res, err := c.Do("ECHO", "hello"); err != nil || res != proto.String("hello") {
+			t.Fatalf("have: %q %v", res, err)
+		}
+		if _, err := c.Do("ECHO", "hello"); err == nil {
+			t.Fatal("expected an error")
+		}
+		if have, want := f.Fired(), 1; have != want {
+			t.Errorf("have: %d, want: %d", have, want)
+		}
+
+		c2 := dial(t)
+		defer c2.Close()
+		if res, err := c2.Do("ECHO", "hello"); err != nil || res != proto.String("hello") {
+			t.Fatalf("have: %q %v", res, err)
+		}
+	})
+
+	t.Run("partial reply", func(t *testing.T) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		f := srv.AddFault(Fault{Cmd: "ECHO", Action: FaultPartialReply})
+		defer f.Remove()
+		if _, err := conn.Write([]byte(proto.Strings("ECHO", "hello"))); err != nil {
+			t.Fatal(err)
+		}
+		res, err := ioutil.ReadAll(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := string(res), "$5\r\nh"; have != want {
+			t.Errorf("have: %q, want: %q", have, want)
+		}
+	})
+
+	t.Run("stall", func(t *testing.T) {
+		c := dial(t)
+		defer c.Close()
+
+		srv.Stall(50 * time.Millisecond)
+		start := time.Now()
+		ping(t, c)
+		if took := time.Since(start); took < 50*time.Millisecond {
+			t.Errorf("too fast: %s", took)
+		}
+
+		f := srv.AddFault(Fault{Cmd: "PING", Count: 1, Action: FaultStall, Duration: 50 * time.Millisecond})
+		start = time.Now()
+		ping(t, c)
+		if took := time.Since(start); took < 50*time.Millisecond {
+			t.Errorf("too fast: %s", took)
+		}
+		if have, want := f.Fired(), 1; have != want {
+			t.Errorf("have: %d, want: %d", have, want)
+		}
+
+		srv.Stall(time.Hour)
+		srv.Unstall()
+		ping(t, c)
+	})
+
+	t.Run("accept modes", func(t *testing.T) {
+		c := dial(t)
+		defer c.Close()
+		ping(t, c)
+		defer srv.SetAcceptMode(AcceptNormal)
+
+		srv.SetAcceptMode(AcceptRefuse)
+		c2 := dial(t)
+		if _, err := c2.Do("PING"); err == nil {
+			t.Fatal("expected an error")
+		}
+		c2.Close()
+		ping(t, c)
+
+		srv.SetAcceptMode(AcceptBlackhole)
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte(proto.Strings("PING"))); err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+		if _, err := conn.Read(make([]byte, 10)); err == nil {
+			t.Fatal("expected a timeout")
+		}
+		ping(t, c)
+
+		srv.SetAcceptMode(AcceptNormal)
+		c3 := dial(t)
+		defer c3.Close()
+		ping(t, c3)
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		c := dial(t)
+		defer c.Close()
+		ping(t, c)
+
+		if have := srv.DropConnections(nil); have < 1 {
+			t.Errorf("have: %d", have)
+		}
+		if _, err := c.Do("PING"); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func TestInline(t *testing.T) {
+	s, err := NewServer(":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	s.Register("PING", func(c *Peer, cmd string, args []string) {
+		c.WriteInline("PONG")
+	})
+	s.Register("ECHO", func(c *Peer, cmd string, args []string) {
+		if len(args) != 1 {
+			c.WriteError(errWrongNumberOfArgs)
+			return
+		}
+		c.WriteBulk(args[0])
+	})
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(
+		"PING\r\n" +
+			"echo \"hello\\tworld\"\n" +
+			"\r\n" + // ignored
+			"*1\r\n$4\r\nPING\r\n" +
+			"ECHO 'oops\r\n" +
+			"PING\r\n", // never runs
+	)); err != nil {
+		t.Fatal(err)
+	}
+
+	r := bufio.NewReader(conn)
+	for _, want := range []string{
+		proto.Inline("PONG"),
+		proto.String("hello\tworld"),
+		proto.Inline("PONG"),
+		proto.Error("ERR Protocol error: unbalanced quotes in request"),
+	} {
+		have, err := proto.Read(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have != want {
+			t.Errorf("have %q, want %q", have, want)
+		}
+	}
+	// and the connection is closed
+	if _, err := proto.Read(r); err == nil {
+		t.Errorf("connection not closed")
+	}
+}
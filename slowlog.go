@@ -0,0 +1,120 @@
+package miniredis
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+const (
+	slowlogMaxArgc   = 32  // Redis' SLOWLOG_ENTRY_MAX_ARGC
+	slowlogMaxString = 128 // Redis' SLOWLOG_ENTRY_MAX_STRING
+)
+
+// slowlogEntry is a single SLOWLOG entry.
+type slowlogEntry struct {
+	id       int
+	time     time.Time
+	duration time.Duration
+	cmd      []string
+	addr     string
+	name     string
+}
+
+// slowlog has the SLOWLOG entries and config.
+type slowlog struct {
+	slowerThan time.Duration            // "slowlog-log-slower-than". Negative disables the log.
+	maxLen     int                      // "slowlog-max-len"
+	entries    []slowlogEntry           // newest first
+	nextID     int                      // not reset by SLOWLOG RESET
+	durations  map[string]time.Duration // fake durations, by uppercase command
+}
+
+func newSlowlog() slowlog {
+	return slowlog{
+		slowerThan: 10 * time.Millisecond,
+		maxLen:     128,
+		durations:  map[string]time.Duration{},
+	}
+}
+
+// SetSlowlog changes "slowlog-log-slower-than" and "slowlog-max-len". Commands
+// which take at least slowerThan are logged, 0 logs every command, and a
+// negative value disables the slowlog. The defaults are 10ms and 128 entries.
+func (m *Miniredis) SetSlowlog(slowerThan time.Duration, maxLen int) {
+	m.Lock()
+	defer m.Unlock()
+	m.slowlog.slowerThan = slowerThan
+	m.slowlog.maxLen = maxLen
+	m.slowlog.trim()
+}
+
+// SetSlowlogDuration makes the slowlog use d as the duration of every call to
+// cmd, instead of the time it actually took. This makes slowlog entries
+// predictable in tests. Use 0 to go back to the real duration.
+func (m *Miniredis) SetSlowlogDuration(cmd string, d time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+	cmd = strings.ToUpper(cmd)
+	if d == 0 {
+		delete(m.slowlog.durations, cmd)
+		return
+	}
+	m.slowlog.durations[cmd] = d
+}
+
+// add logs a command if it's slow enough. Needs the main lock.
+func (s *slowlog) add(now time.Time, c *server.Peer, cmd []string, d time.Duration) {
+	if fake, ok := s.durations[strings.ToUpper(cmd[0])]; ok {
+		d = fake
+	}
+	if s.slowerThan < 0 || d.Microseconds() < s.slowerThan.Microseconds() {
+		return
+	}
+	var name string
+	c.Inspect(func() {
+		name = c.ClientName
+	})
+	s.entries = append([]slowlogEntry{{
+		id:       s.nextID,
+		time:     now,
+		duration: d,
+		cmd:      slowlogArgs(redactCmd(cmd)),
+		addr:     c.Addr(),
+		name:     name,
+	}}, s.entries...)
+	s.nextID++
+	s.trim()
+}
+
+func (s *slowlog) trim() {
+	if s.maxLen < 0 {
+		s.entries = nil
+		return
+	}
+	if len(s.entries) > s.maxLen {
+		s.entries = s.entries[:s.maxLen]
+	}
+}
+
+// slowlogArgs shortens long commands the way Redis does.
+func slowlogArgs(cmd []string) []string {
+	argc := len(cmd)
+	if argc > slowlogMaxArgc {
+		argc = slowlogMaxArgc
+	}
+	res := make([]string, 0, argc)
+	for i := 0; i < argc; i++ {
+		a := cmd[i]
+		switch {
+		case argc != len(cmd) && i == argc-1:
+			a = fmt.Sprintf("... (%d more arguments)", len(cmd)-argc+1)
+		case len(a) > slowlogMaxString:
+			a = fmt.Sprintf("%s... (%d more bytes)", a[:slowlogMaxString], len(a)-slowlogMaxString)
+		}
+		res = append(res, a)
+	}
+	return res
+}
@@ -0,0 +1,322 @@
+package miniredis
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// State is a simulated server state. See SetState().
+type State int
+
+const (
+	// StateNormal is the default.
+	StateNormal State = iota
+	// StateLoading is a server which is loading its dataset.
+	StateLoading
+	// StateBusy is a server running a slow script. SCRIPT KILL and FUNCTION
+	// KILL end this state.
+	StateBusy
+	// StateMasterDown is a replica which lost the link with its master, with
+	// replica-serve-stale-data set to "no".
+	StateMasterDown
+	// StateClusterDown is a cluster node in a failed cluster.
+	StateClusterDown
+	// StateReadOnly is a read only replica.
+	StateReadOnly
+)
+
+const (
+	msgLoading     = "LOADING Redis is loading the dataset in memory"
+	msgBusy        = "BUSY Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSAVE."
+	msgMasterDown  = "MASTERDOWN Link with MASTER is down and replica-serve-stale-data is set to 'no'."
+	msgClusterDown = "CLUSTERDOWN The cluster is down"
+	msgReadOnly    = "READONLY You can't write against a read only replica."
+)
+
+// loadingStaleCmds are the commands with the "loading" and "stale" flags, which
+// work in StateLoading and StateMasterDown.
+var loadingStaleCmds = map[string]bool{
+	"AUTH":         true,
+	"CLIENT":       true,
+	"CLUSTER":      true,
+	"COMMAND":      true,
+	"DISCARD":      true,
+	"EXEC":         true,
+	"HELLO":        true,
+	"INFO":         true,
+	"LATENCY":      true,
+	"MONITOR":      true,
+	"MULTI":        true,
+	"PSUBSCRIBE":   true,
+	"PUBLISH":      true,
+	"PUBSUB":       true,
+	"PUNSUBSCRIBE": true,
+	"QUIT":         true,
+	"SELECT":       true,
+	"SLOWLOG":      true,
+	"SUBSCRIBE":    true,
+	"TIME":         true,
+	"UNSUBSCRIBE":  true,
+	"UNWATCH":      true,
+	"WATCH":        true,
+}
+
+// staleCmds are the commands with the "stale" flag, but without the "loading"
+// flag. Scripts check their own "allow-stale" flag when they run.
+var staleCmds = map[string]bool{
+	"EVAL":       true,
+	"EVALSHA":    true,
+	"EVAL_RO":    true,
+	"EVALSHA_RO": true,
+	"FCALL":      true,
+	"FCALL_RO":   true,
+}
+
+// busyCmds are the commands with the "allow-busy" flag, which work in
+// StateBusy.
+var busyCmds = map[string]bool{
+	"AUTH":    true,
+	"DISCARD": true,
+	"EXEC":    true,
+	"HELLO":   true,
+	"MULTI":   true,
+	"QUIT":    true,
+	"UNWATCH": true,
+	"WATCH":   true,
+}
+
+// replicaCmds are marked as writes, but work on a read only replica. Writes
+// from scripts are refused when they are called.
+var replicaCmds = map[string]bool{
+	"EVAL":    true,
+	"EVALSHA": true,
+	"EXEC":    true,
+	"FCALL":   true,
+	"PUBLISH": true,
+}
+
+// keyCmds are the commands which always have keys, and which Redis refuses in
+// StateClusterDown. Scripts are refused when they have keys, see scriptCmds.
+var keyCmds = map[string]bool{
+	"APPEND":               true,
+	"BITCOUNT":             true,
+	"BITOP":                true,
+	"BITPOS":               true,
+	"BLMOVE":               true,
+	"BLPOP":                true,
+	"BRPOP":                true,
+	"BRPOPLPUSH":           true,
+	"COPY":                 true,
+	"DECR":                 true,
+	"DECRBY":               true,
+	"DEL":                  true,
+	"DELEX":                true,
+	"DUMP":                 true,
+	"EXISTS":               true,
+	"EXPIRE":               true,
+	"EXPIREAT":             true,
+	"EXPIRETIME":           true,
+	"GEOADD":               true,
+	"GEODIST":              true,
+	"GEOPOS":               true,
+	"GEORADIUS":            true,
+	"GEORADIUSBYMEMBER":    true,
+	"GEORADIUSBYMEMBER_RO": true,
+	"GEORADIUS_RO":         true,
+	"GET":                  true,
+	"GETBIT":               true,
+	"GETDEL":               true,
+	"GETEX":                true,
+	"GETRANGE":             true,
+	"GETSET":               true,
+	"HDEL":                 true,
+	"HEXISTS":              true,
+	"HEXPIRE":              true,
+	"HGET":                 true,
+	"HGETALL":              true,
+	"HINCRBY":              true,
+	"HINCRBYFLOAT":         true,
+	"HKEYS":                true,
+	"HLEN":                 true,
+	"HMGET":                true,
+	"HMSET":                true,
+	"HRANDFIELD":           true,
+	"HSCAN":                true,
+	"HSET":                 true,
+	"HSETNX":               true,
+	"HSTRLEN":              true,
+	"HVALS":                true,
+	"INCR":                 true,
+	"INCRBY":               true,
+	"INCRBYFLOAT":          true,
+	"LINDEX":               true,
+	"LINSERT":              true,
+	"LLEN":                 true,
+	"LMOVE":                true,
+	"LPOP":                 true,
+	"LPOS":                 true,
+	"LPUSH":                true,
+	"LPUSHX":               true,
+	"LRANGE":               true,
+	"LREM":                 true,
+	"LSET":                 true,
+	"LTRIM":                true,
+	"MEMORY":               true,
+	"MGET":                 true,
+	"MOVE":                 true,
+	"MSET":                 true,
+	"MSETNX":               true,
+	"OBJECT":               true,
+	"PERSIST":              true,
+	"PEXPIRE":              true,
+	"PEXPIREAT":            true,
+	"PEXPIRETIME":          true,
+	"PFADD":                true,
+	"PFCOUNT":              true,
+	"PFMERGE":              true,
+	"PSETEX":               true,
+	"PTTL":                 true,
+	"RENAME":               true,
+	"RENAMENX":             true,
+	"RESTORE":              true,
+	"RPOP":                 true,
+	"RPOPLPUSH":            true,
+	"RPUSH":                true,
+	"RPUSHX":               true,
+	"SADD":                 true,
+	"SCARD":                true,
+	"SDIFF":                true,
+	"SDIFFSTORE":           true,
+	"SET":                  true,
+	"SETBIT":               true,
+	"SETEX":                true,
+	"SETNX":                true,
+	"SETRANGE":             true,
+	"SINTER":               true,
+	"SINTERCARD":           true,
+	"SINTERSTORE":          true,
+	"SISMEMBER":            true,
+	"SMEMBERS":             true,
+	"SMISMEMBER":           true,
+	"SMOVE":                true,
+	"SPOP":                 true,
+	"SRANDMEMBER":          true,
+	"SREM":                 true,
+	"SSCAN":                true,
+	"STRLEN":               true,
+	"SUNION":               true,
+	"SUNIONSTORE":          true,
+	"TOUCH":                true,
+	"TTL":                  true,
+	"TYPE":                 true,
+	"UNLINK":               true,
+	"WATCH":                true,
+	"XACK":                 true,
+	"XADD":                 true,
+	"XAUTOCLAIM":           true,
+	"XCLAIM":               true,
+	"XDEL":                 true,
+	"XGROUP":               true,
+	"XINFO":                true,
+	"XLEN":                 true,
+	"XPENDING":             true,
+	"XRANGE":               true,
+	"XREAD":                true,
+	"XREADGROUP":           true,
+	"XREVRANGE":            true,
+	"XTRIM":                true,
+	"ZADD":                 true,
+	"ZCARD":                true,
+	"ZCOUNT":               true,
+	"ZINCRBY":              true,
+	"ZINTER":               true,
+	"ZINTERSTORE":          true,
+	"ZLEXCOUNT":            true,
+	"ZMSCORE":              true,
+	"ZPOPMAX":              true,
+	"ZPOPMIN":              true,
+	"ZRANDMEMBER":          true,
+	"ZRANGE":               true,
+	"ZRANGEBYLEX":          true,
+	"ZRANGEBYSCORE":        true,
+	"ZRANK":                true,
+	"ZREM":                 true,
+	"ZREMRANGEBYLEX":       true,
+	"ZREMRANGEBYRANK":      true,
+	"ZREMRANGEBYSCORE":     true,
+	"ZREVRANGE":            true,
+	"ZREVRANGEBYLEX":       true,
+	"ZREVRANGEBYSCORE":     true,
+	"ZREVRANK":             true,
+	"ZSCAN":                true,
+	"ZSCORE":               true,
+	"ZUNION":               true,
+	"ZUNIONSTORE":          true,
+}
+
+// scriptCmds have a numkeys argument, which can be 0.
+var scriptCmds = map[string]bool{
+	"EVAL":       true,
+	"EVALSHA":    true,
+	"EVAL_RO":    true,
+	"EVALSHA_RO": true,
+	"FCALL":      true,
+	"FCALL_RO":   true,
+}
+
+// SetState makes miniredis behave as a Redis server in that state: commands
+// which Redis refuses in that state get the same error Redis gives, other
+// commands work as usual. The state is also visible in INFO persistence and
+// INFO replication. Use StateNormal to go back to normal.
+func (m *Miniredis) SetState(s State) {
+	m.errors.mu.Lock()
+	defer m.errors.mu.Unlock()
+	m.errors.state = s
+}
+
+// State returns the state set with SetState().
+func (m *Miniredis) State() State {
+	m.errors.mu.Lock()
+	defer m.errors.mu.Unlock()
+	return m.errors.state
+}
+
+// stateError returns the error for a command in the current state, if any.
+// Needs the errorRules lock.
+func (r *errorRules) stateError(srv *server.Server, cmd []string) string {
+	name := strings.ToUpper(cmd[0])
+	switch r.state {
+	case StateLoading:
+		if !loadingStaleCmds[name] {
+			return msgLoading
+		}
+	case StateBusy:
+		if !busyCmds[name] {
+			return msgBusy
+		}
+	case StateMasterDown:
+		if !loadingStaleCmds[name] && !staleCmds[name] {
+			return msgMasterDown
+		}
+	case StateClusterDown:
+		if keyCmds[name] || (scriptCmds[name] && scriptHasKeys(cmd[1:])) {
+			return msgClusterDown
+		}
+	case StateReadOnly:
+		if srv.IsWriteCall(cmd) && !replicaCmds[name] {
+			return msgReadOnly
+		}
+	}
+	return ""
+}
+
+// scriptHasKeys is true for `script numkeys ...` with a numkeys above 0.
+func scriptHasKeys(args []string) bool {
+	if len(args) < 2 {
+		return false
+	}
+	n, err := strconv.Atoi(args[1])
+	return err == nil && n > 0
+}
@@ -0,0 +1,398 @@
+package miniredis
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// trackingChannel is where RESP2 clients get invalidation messages, using
+// CLIENT TRACKING's REDIRECT.
+const trackingChannel = "__redis__:invalidate"
+
+// tracking is the CLIENT TRACKING state of a single connection.
+type tracking struct {
+	bcast       bool
+	prefixes    []string // only with bcast
+	optin       bool
+	optout      bool
+	noloop      bool
+	caching     bool // CLIENT CACHING was called, for the next command only
+	redirect    int  // client ID, or 0
+	brokenRedir bool // the redirect client is gone
+}
+
+// matches checks a key against the BCAST prefixes.
+func (t *tracking) matches(key string) bool {
+	if len(t.prefixes) == 0 {
+		return true
+	}
+	for _, p := range t.prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// flags as used in CLIENT TRACKINGINFO
+func (t *tracking) flags() []string {
+	if t == nil {
+		return []string{"off"}
+	}
+	fl := []string{"on"}
+	if t.bcast {
+		fl = append(fl, "bcast")
+	}
+	if t.optin {
+		fl = append(fl, "optin")
+		if t.caching {
+			fl = append(fl, "caching-yes")
+		}
+	}
+	if t.optout {
+		fl = append(fl, "optout")
+		if t.caching {
+			fl = append(fl, "caching-no")
+		}
+	}
+	if t.noloop {
+		fl = append(fl, "noloop")
+	}
+	if t.brokenRedir {
+		fl = append(fl, "broken_redirect")
+	}
+	return fl
+}
+
+// trackingTable has all the CLIENT TRACKING state of the server.
+type trackingTable struct {
+	clients map[int]*server.Peer        // by client ID
+	keys    map[string]map[int]struct{} // keys read by (non BCAST) clients
+	pending []func()                    // messages for the current client
+}
+
+func newTrackingTable() trackingTable {
+	return trackingTable{
+		clients: map[int]*server.Peer{},
+		keys:    map[string]map[int]struct{}{},
+	}
+}
+
+// ids returns the tracking clients, sorted.
+func (tt *trackingTable) ids() []int {
+	ids := make([]int, 0, len(tt.clients))
+	for id := range tt.clients {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// remove forgets a client, and all the keys it read.
+func (tt *trackingTable) remove(id int) {
+	delete(tt.clients, id)
+	for k, ids := range tt.keys {
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(tt.keys, k)
+		}
+	}
+}
+
+// enableTracking turns on CLIENT TRACKING, or changes the options.
+func (m *Miniredis) enableTracking(c *server.Peer, ctx *connCtx, t tracking) {
+	if old := ctx.tracking; old != nil {
+		// prefixes are added to the existing ones
+		t.prefixes = append(old.prefixes, t.prefixes...)
+	}
+	ctx.tracking = &t
+
+	id := c.ID()
+	if _, ok := m.tracking.clients[id]; !ok {
+		m.tracking.clients[id] = c
+		c.OnDisconnect(func() {
+			m.Lock()
+			defer m.Unlock()
+			m.tracking.remove(id)
+		})
+	}
+}
+
+// disableTracking turns off CLIENT TRACKING.
+func (m *Miniredis) disableTracking(c *server.Peer, ctx *connCtx) {
+	ctx.tracking = nil
+	m.tracking.remove(c.ID())
+}
+
+// checkPrefixes returns an error if BCAST prefixes overlap.
+func checkPrefixes(old, new []string) error {
+	overlap := func(a, b string) bool {
+		return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+	}
+	for i, p := range new {
+		for _, o := range old {
+			if overlap(p, o) {
+				return fmt.Errorf("ERR Prefix '%s' overlaps with an existing prefix '%s'. Prefixes for a single client must not overlap.", p, o)
+			}
+		}
+		for _, o := range new[i+1:] {
+			if overlap(p, o) {
+				return fmt.Errorf("ERR Prefix '%s' overlaps with another provided prefix '%s'. Prefixes for a single client must not overlap.", p, o)
+			}
+		}
+	}
+	return nil
+}
+
+// trackKeys remembers the keys read by a command, for the client which runs
+// the current command. Called after every command. No locks!
+func (m *Miniredis) trackKeys(ctx *connCtx, cmd []string) {
+	c := m.curPeer
+	if c == nil || len(cmd) == 0 {
+		return
+	}
+	t := getCtx(c).tracking
+	if t == nil {
+		return
+	}
+
+	caching := t.caching
+	if !ctx.nested && !inTx(ctx) && !strings.EqualFold(cmd[0], "CLIENT") {
+		// CLIENT CACHING is only valid for the next command
+		t.caching = false
+	}
+
+	if t.bcast || !m.srv.IsReadOnlyCommand(cmd[0]) {
+		return
+	}
+	if n := strings.ToUpper(cmd[0]); n == "EVAL_RO" || n == "EVALSHA_RO" || n == "FCALL_RO" {
+		// the keys used by the script are tracked
+		return
+	}
+	if (t.optin && !caching) || (t.optout && caching) {
+		return
+	}
+	for _, k := range cmdKeys(cmd) {
+		ids, ok := m.tracking.keys[k]
+		if !ok {
+			ids = map[int]struct{}{}
+			m.tracking.keys[k] = ids
+		}
+		ids[c.ID()] = struct{}{}
+	}
+}
+
+// cmdKeys returns the keys a command uses. Mostly that's the first argument.
+func cmdKeys(cmd []string) []string {
+	name, args := strings.ToUpper(cmd[0]), cmd[1:]
+	switch name {
+	case "AUTH", "CLIENT", "CLUSTER", "COMMAND", "DBSIZE", "DISCARD", "ECHO",
+		"EXEC", "FLUSHALL", "FLUSHDB", "FUNCTION", "HELLO", "INFO", "KEYS",
+		"LATENCY", "MEMORY", "MONITOR", "MULTI", "PING", "PSUBSCRIBE", "PUBLISH",
+		"PUBSUB", "PUNSUBSCRIBE", "QUIT", "RANDOMKEY", "SCAN", "SCRIPT", "SELECT",
+		"SLOWLOG", "SUBSCRIBE", "SWAPDB", "TIME", "UNSUBSCRIBE", "UNWATCH",
+		"WAIT", "WATCH":
+		// no keys, or not tracked
+		return nil
+	case "DEL", "EXISTS", "MGET", "PFCOUNT", "PFMERGE", "SDIFF", "SDIFFSTORE",
+		"SINTER", "SINTERSTORE", "SUNION", "SUNIONSTORE", "TOUCH", "UNLINK":
+		return args
+	case "BLPOP", "BRPOP":
+		// key [key ...] timeout
+		if len(args) == 0 {
+			return nil
+		}
+		return args[:len(args)-1]
+	case "BITOP":
+		// operation destkey key [key ...]
+		if len(args) == 0 {
+			return nil
+		}
+		return args[1:]
+	case "BLMOVE", "BRPOPLPUSH", "COPY", "LMOVE", "RENAME", "RENAMENX",
+		"RPOPLPUSH", "SMOVE":
+		// source destination ...
+		if len(args) < 2 {
+			return args
+		}
+		return args[:2]
+	case "EVAL", "EVALSHA", "EVAL_RO", "EVALSHA_RO", "FCALL", "FCALL_RO",
+		"ZINTERSTORE", "ZUNIONSTORE":
+		// script numkeys key [key ...], or destination numkeys key [key ...]
+		if len(args) < 2 {
+			return nil
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 || n > len(args)-2 {
+			return nil
+		}
+		if strings.HasSuffix(name, "STORE") {
+			return append([]string{args[0]}, args[2:n+2]...)
+		}
+		return args[2 : n+2]
+	case "MSET", "MSETNX":
+		// key value [key value ...]
+		var keys []string
+		for i := 0; i < len(args); i += 2 {
+			keys = append(keys, args[i])
+		}
+		return keys
+	case "SINTERCARD", "ZINTER", "ZUNION":
+		// numkeys key [key ...]
+		if len(args) == 0 {
+			return nil
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 || n > len(args)-1 {
+			return nil
+		}
+		return args[1 : n+1]
+	case "OBJECT", "XGROUP", "XINFO":
+		// subcommand key
+		if len(args) < 2 {
+			return nil
+		}
+		return args[1:2]
+	case "XREAD", "XREADGROUP":
+		// ... STREAMS key [key ...] id [id ...]
+		for i, a := range args {
+			if strings.ToUpper(a) == "STREAMS" {
+				streams := args[i+1:]
+				return streams[:len(streams)/2]
+			}
+		}
+		return nil
+	default:
+		if len(args) == 0 {
+			return nil
+		}
+		return args[:1]
+	}
+}
+
+// trackingInvalidate is called for every changed key. No locks!
+func (m *Miniredis) trackingInvalidate(key string) {
+	tt := &m.tracking
+	if len(tt.clients) == 0 {
+		return
+	}
+	readBy := tt.keys[key]
+	delete(tt.keys, key)
+	for _, id := range tt.ids() {
+		c := tt.clients[id]
+		t := getCtx(c).tracking
+		if t.bcast {
+			if !t.matches(key) {
+				continue
+			}
+		} else {
+			if _, ok := readBy[id]; !ok {
+				continue
+			}
+		}
+		if t.noloop && c == m.curPeer {
+			continue
+		}
+		m.sendInvalidation(c, t, []string{key})
+	}
+}
+
+// trackingInvalidateAll is used for FLUSHALL and FLUSHDB. All tracking
+// clients get a "null" invalidation. No locks!
+func (m *Miniredis) trackingInvalidateAll() {
+	tt := &m.tracking
+	for _, id := range tt.ids() {
+		c := tt.clients[id]
+		m.sendInvalidation(c, getCtx(c).tracking, nil)
+	}
+	tt.keys = map[string]map[int]struct{}{}
+}
+
+// sendInvalidation sends an "invalidate" message to a client, or to its
+// REDIRECT client. nil keys is the flush message. No locks!
+func (m *Miniredis) sendInvalidation(c *server.Peer, t *tracking, keys []string) {
+	writeKeys := func(w *server.Writer) {
+		if keys == nil {
+			w.WriteNull()
+			return
+		}
+		w.WriteStrings(keys)
+	}
+
+	target := c
+	if t.redirect != 0 {
+		target = m.peer(t.redirect)
+		if target == nil {
+			if !t.brokenRedir {
+				t.brokenRedir = true
+				if isResp3(c) {
+					m.trackingPush(c, func(w *server.Writer) {
+						w.WritePushLen(2)
+						w.WriteBulk("tracking-redir-broken")
+						w.WriteInt(t.redirect)
+					})
+				}
+			}
+			return
+		}
+	}
+
+	var sub *Subscriber
+	target.Inspect(func() {
+		if ctx, ok := target.Ctx.(*connCtx); ok {
+			sub = ctx.subscriber
+		}
+	})
+	switch {
+	case isResp3(target):
+		m.trackingPush(target, func(w *server.Writer) {
+			w.WritePushLen(2)
+			w.WriteBulk("invalidate")
+			writeKeys(w)
+		})
+	case t.redirect != 0 && sub != nil && sub.isSubscribed(trackingChannel):
+		m.trackingPush(target, func(w *server.Writer) {
+			w.WriteLen(3)
+			w.WriteBulk("message")
+			w.WriteBulk(trackingChannel)
+			writeKeys(w)
+		})
+	}
+}
+
+// trackingPush sends a message. If the message is for the client which runs
+// the current command it's sent after the reply. No locks!
+func (m *Miniredis) trackingPush(c *server.Peer, f func(*server.Writer)) {
+	send := func() {
+		c.Push(func(w *server.Writer) {
+			f(w)
+			w.Flush()
+		})
+	}
+	if c == m.curPeer {
+		m.tracking.pending = append(m.tracking.pending, send)
+		return
+	}
+	send()
+}
+
+// sendPendingInvalidations sends the messages for the current client, after
+// its command is done. No locks!
+func (m *Miniredis) sendPendingInvalidations() {
+	for _, f := range m.tracking.pending {
+		f()
+	}
+	m.tracking.pending = nil
+}
+
+func isResp3(c *server.Peer) bool {
+	var resp3 bool
+	c.Inspect(func() {
+		resp3 = c.Resp3
+	})
+	return resp3
+}